@@ -3,12 +3,45 @@
 package discord
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
 	"github.com/TheDiscordian/onebot/onelib"
 	"github.com/bwmarrin/discordgo"
 )
 
 var DiscordAdminId onelib.UUID
 
+// Outbox queues every message sent to Discord. discordgo already waits out Discord's rate limits, so sends are only
+// spaced out enough to stay under the global limit of 50 requests per second.
+var Outbox = onelib.NewOutbox("discord", 20*time.Millisecond)
+
+// send queues a message to be sent to the channel to (see Outbox), returning a handle to it once it's sent.
+func send(to onelib.UUID, send func() (*discordgo.Message, error)) (*onelib.SentMessage, error) {
+	var m *discordgo.Message
+	err := Outbox.Send(to, func() (err error) {
+		m, err = send()
+		return retryable(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return onelib.NewSentMessage(onelib.UUID(m.ID), to, "discord"), nil
+}
+
+// retryable marks errors from Discord's servers being down as temporary, so the send is retried.
+func retryable(err error) error {
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode >= http.StatusInternalServerError {
+		return onelib.RetryAfter(err, 0)
+	}
+	return err
+}
+
 // Literally just to expose the session so other features of discordgo can be used if needed: https://pkg.go.dev/github.com/bwmarrin/discordgo
 type DiscordLocation struct {
 	Client                       *DiscordClient // pointer to originating client
@@ -33,16 +66,75 @@ func (ml *DiscordLocation) UUID() onelib.UUID {
 	return ml.Uuid
 }
 
-func (ml *DiscordLocation) Send(msg onelib.Message) {
-	ml.Client.Send(ml.Uuid, msg)
+func (ml *DiscordLocation) Send(msg onelib.Message) (*onelib.SentMessage, error) {
+	return ml.Client.Send(ml.Uuid, msg)
+}
+
+func (ml *DiscordLocation) SendText(text string) (*onelib.SentMessage, error) {
+	return ml.Client.SendText(ml.Uuid, text)
+}
+
+func (ml *DiscordLocation) SendFormattedText(text, formattedText string) (*onelib.SentMessage, error) {
+	return ml.Client.SendFormattedText(ml.Uuid, text, formattedText)
+}
+
+// SendDocument sends the document as Discord markdown.
+func (ml *DiscordLocation) SendDocument(doc *onelib.Document) (*onelib.SentMessage, error) {
+	return ml.Client.SendText(ml.Uuid, doc.Markdown(ml))
+}
+
+// Reply sends text in reply to the message to. Discord threads are channels of their own, so the reply is already in
+// the thread if to is.
+func (ml *DiscordLocation) Reply(to onelib.Message, text, formattedText string) (*onelib.SentMessage, error) {
+	return ml.Client.SendReply(ml.Uuid, to.UUID(), markdown(text, formattedText))
+}
+
+// React adds emoji as a reaction to the message. Custom emojis are given as "name:id".
+func (ml *DiscordLocation) React(messageID onelib.UUID, emoji string) error {
+	return ml.Client.MessageReactionAdd(string(ml.Uuid), string(messageID), emoji)
+}
+
+// Unreact removes the bot's emoji reaction from the message. Custom emojis are given as "name:id".
+func (ml *DiscordLocation) Unreact(messageID onelib.UUID, emoji string) error {
+	return ml.Client.MessageReactionRemove(string(ml.Uuid), string(messageID), emoji, "@me")
 }
 
-func (ml *DiscordLocation) SendText(text string) {
-	ml.Client.SendText(ml.Uuid, text)
+// Edit replaces the text of a message the bot sent.
+func (ml *DiscordLocation) Edit(messageID onelib.UUID, text, formattedText string) error {
+	return ml.Client.Edit(ml.Uuid, messageID, text, formattedText)
 }
 
-func (ml *DiscordLocation) SendFormattedText(text, formattedText string) {
-	ml.Client.SendFormattedText(ml.Uuid, text, formattedText)
+// Delete deletes the message.
+func (ml *DiscordLocation) Delete(messageID onelib.UUID) error {
+	return ml.Client.Delete(ml.Uuid, messageID)
+}
+
+// SendAttachment uploads the file to the channel, with text.
+func (ml *DiscordLocation) SendAttachment(ctx context.Context, attachment *onelib.Attachment, text string) (*onelib.SentMessage, error) {
+	data, err := attachment.Data(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return send(ml.Uuid, func() (*discordgo.Message, error) {
+		return ml.Client.ChannelMessageSendComplex(string(ml.Uuid), &discordgo.MessageSend{
+			Content: text,
+			Files:   []*discordgo.File{{Name: attachment.Name, ContentType: attachment.MIMEType, Reader: bytes.NewReader(data)}},
+		})
+	})
+}
+
+// Mention returns the mention as Discord writes it (Ex: "<@123>").
+func (ml *DiscordLocation) Mention(mention *onelib.Mention) (string, string) {
+	var text string
+	switch mention.Type {
+	case onelib.MentionRole:
+		text = "<@&" + string(mention.UUID) + ">"
+	case onelib.MentionLocation:
+		text = "<#" + string(mention.UUID) + ">"
+	default:
+		text = "<@" + string(mention.UUID) + ">"
+	}
+	return text, text
 }
 
 func (ml *DiscordLocation) Protocol() string {
@@ -54,20 +146,60 @@ type DiscordClient struct {
 }
 
 // Send sends a Message object to a location specified by to (usually a location or sender UUID).
-func (dc *DiscordClient) Send(to onelib.UUID, msg onelib.Message) {
-	// code here
+func (dc *DiscordClient) Send(to onelib.UUID, msg onelib.Message) (*onelib.SentMessage, error) {
+	return dc.SendFormattedText(to, msg.Text(), msg.FormattedText())
 }
 
 // SendText sends text to a location specified by to (usually a location or sender UUID).
-func (dc *DiscordClient) SendText(to onelib.UUID, text string) {
-	_, err := dc.Session.ChannelMessageSend(string(to), text)
-	if err != nil {
-		onelib.Error.Println(err)
-	}
+func (dc *DiscordClient) SendText(to onelib.UUID, text string) (*onelib.SentMessage, error) {
+	return send(to, func() (*discordgo.Message, error) {
+		return dc.Session.ChannelMessageSend(string(to), text)
+	})
+}
+
+// SendFormattedText sends formatted text to a location specified by to (usually a location or sender UUID). The
+// formatted text is converted to markdown, if there's none, text is sent.
+func (dc *DiscordClient) SendFormattedText(to onelib.UUID, text, formattedText string) (*onelib.SentMessage, error) {
+	return dc.SendText(to, markdown(text, formattedText))
+}
+
+// Edit replaces the text of a message the bot sent to a location specified by to, with formatted text converted to
+// markdown (see SendFormattedText).
+func (dc *DiscordClient) Edit(to, messageID onelib.UUID, text, formattedText string) error {
+	content := markdown(text, formattedText)
+	_, err := send(to, func() (*discordgo.Message, error) {
+		return dc.Session.ChannelMessageEdit(string(to), string(messageID), content)
+	})
+	return err
+}
+
+// Delete deletes the message in a location specified by to.
+func (dc *DiscordClient) Delete(to, messageID onelib.UUID) error {
+	return Outbox.Send(to, func() error {
+		return retryable(dc.Session.ChannelMessageDelete(string(to), string(messageID)))
+	})
+}
+
+// messageReply is a message sent in reply to another, which MessageSend doesn't support yet.
+type messageReply struct {
+	Content          string            `json:"content"`
+	MessageReference *messageReference `json:"message_reference"`
+}
+
+type messageReference struct {
+	MessageID       string `json:"message_id"`
+	FailIfNotExists bool   `json:"fail_if_not_exists"` // if false, the reply is sent as a normal message if replyTo was deleted
 }
 
-// SendFormattedText sends formatted text to a location specified by to (usually a location or sender UUID).
-// FIXME currently ignores formatted text
-func (dc *DiscordClient) SendFormattedText(to onelib.UUID, text, formattedText string) {
-	dc.SendText(to, text)
+// SendReply sends text to a location specified by to, in reply to the message replyTo.
+func (dc *DiscordClient) SendReply(to, replyTo onelib.UUID, text string) (*onelib.SentMessage, error) {
+	endpoint := discordgo.EndpointChannelMessages(string(to))
+	return send(to, func() (*discordgo.Message, error) {
+		body, err := dc.Session.RequestWithBucketID("POST", endpoint, &messageReply{Content: text, MessageReference: &messageReference{MessageID: string(replyTo)}}, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		m := new(discordgo.Message)
+		return m, json.Unmarshal(body, m)
+	})
 }
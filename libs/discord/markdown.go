@@ -0,0 +1,160 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package discord
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/TheDiscordian/onebot/onelib"
+)
+
+// htmlTag matches an opening, closing, or self-closing HTML tag. Discord's own syntax (Ex: "<@123>", "<#123>",
+// "<:name:123>") doesn't match, so it's left as is.
+var htmlTag = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)(\s[^<>]*?)?\s*/?>`)
+
+// htmlHref matches the href attribute of a link.
+var htmlHref = regexp.MustCompile(`href\s*=\s*"([^"]*)"`)
+
+// discordSyntax matches Discord's own syntax for mentions, custom emojis, and timestamps (Ex: "<@123>", "<#123>",
+// "<:name:123>", "<t:1700000000>").
+var discordSyntax = regexp.MustCompile(`<(?:@[!&]?|#|a?:[\w~]+:|t:)\d+(?::[tTdDfFR])?>`)
+
+// escapeMarkdown escapes text so it's displayed as is, leaving Discord's own syntax intact (see discordSyntax).
+func escapeMarkdown(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range discordSyntax.FindAllStringIndex(text, -1) {
+		b.WriteString(onelib.EscapeMarkdown(text[last:loc[0]]))
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(onelib.EscapeMarkdown(text[last:]))
+	return b.String()
+}
+
+// markdownTags are the tags with a markdown equivalent, as they're opened and closed.
+var markdownTags = map[string][2]string{
+	"strong": {"**", "**"}, "b": {"**", "**"}, "h1": {"**", "**\n"}, "h2": {"**", "**\n"}, "h3": {"**", "**\n"},
+	"em": {"*", "*"}, "i": {"*", "*"},
+	"u":   {"__", "__"},
+	"del": {"~~", "~~"}, "s": {"~~", "~~"}, "strike": {"~~", "~~"},
+	"blockquote": {"> ", "\n"},
+	"li":         {"- ", "\n"},
+	"p":          {"", "\n"}, "div": {"", "\n"}, "tr": {"", "\n"},
+	"td": {"", " "}, "th": {"", " "},
+}
+
+// strippedTags are the tags with no markdown equivalent, which are removed while keeping their contents.
+var strippedTags = map[string]bool{"span": true, "font": true, "ul": true, "ol": true, "table": true, "thead": true,
+	"tbody": true, "details": true, "summary": true, "sup": true, "sub": true, "h4": true, "h5": true, "h6": true}
+
+// markdown returns the markdown to send to Discord for text and formattedText. The formatted text is converted if
+// there is any, otherwise text is sent as is.
+func markdown(text, formattedText string) string {
+	if formattedText == "" {
+		return text
+	}
+	return htmlToMarkdown(formattedText)
+}
+
+// htmlToMarkdown converts formatted text, as HTML, to Discord's markdown. Only tags with a markdown equivalent are
+// converted, other known tags are removed keeping their contents, and anything else is left as is.
+func htmlToMarkdown(formattedText string) string {
+	var b strings.Builder
+	var (
+		code, pre int      // How deep in <code> and <pre> tags
+		hrefs     []string // The URL of each open link
+		linkStart []int    // Where the label of each open link starts in b
+		spoilers  []bool   // If each open <span> is a spoiler
+	)
+	text := func(s string) {
+		s = html.UnescapeString(s)
+		if code == 0 && pre == 0 {
+			s = escapeMarkdown(s)
+		}
+		b.WriteString(s)
+	}
+	last := 0
+	for _, loc := range htmlTag.FindAllStringSubmatchIndex(formattedText, -1) {
+		closing := loc[3] > loc[2]
+		name := strings.ToLower(formattedText[loc[4]:loc[5]])
+		var attrs string
+		if loc[6] != -1 {
+			attrs = formattedText[loc[6]:loc[7]]
+		}
+		_, converted := markdownTags[name]
+		known := converted || strippedTags[name] || name == "br" || name == "code" || name == "pre" || name == "a"
+		if !known {
+			continue
+		}
+		text(formattedText[last:loc[0]])
+		last = loc[1]
+		switch {
+		case name == "br":
+			b.WriteString("\n")
+		case name == "pre" && !closing:
+			pre++
+			b.WriteString("```\n")
+		case name == "pre":
+			if pre > 0 {
+				pre--
+			}
+			b.WriteString("\n```\n")
+		case name == "code" && !closing:
+			code++
+			if pre == 0 {
+				b.WriteString("`")
+			}
+		case name == "code":
+			if code > 0 {
+				code--
+			}
+			if pre == 0 {
+				b.WriteString("`")
+			}
+		case name == "a" && !closing:
+			href := ""
+			if m := htmlHref.FindStringSubmatch(attrs); m != nil {
+				href = html.UnescapeString(m[1])
+			}
+			hrefs = append(hrefs, href)
+			linkStart = append(linkStart, b.Len())
+		case name == "a":
+			if len(linkStart) == 0 {
+				break
+			}
+			href, start := hrefs[len(hrefs)-1], linkStart[len(linkStart)-1]
+			hrefs, linkStart = hrefs[:len(hrefs)-1], linkStart[:len(linkStart)-1]
+			label := b.String()[start:]
+			if href != "" && label != href {
+				rest := b.String()[:start]
+				b.Reset()
+				b.WriteString(rest + "[" + label + "](" + href + ")")
+			}
+		case name == "span" && !closing:
+			spoiler := strings.Contains(attrs, "data-mx-spoiler")
+			spoilers = append(spoilers, spoiler)
+			if spoiler {
+				b.WriteString("||")
+			}
+		case name == "span":
+			if len(spoilers) > 0 {
+				if spoilers[len(spoilers)-1] {
+					b.WriteString("||")
+				}
+				spoilers = spoilers[:len(spoilers)-1]
+			}
+		case converted:
+			md := markdownTags[name]
+			if closing {
+				b.WriteString(md[1])
+			} else {
+				b.WriteString(md[0])
+			}
+		}
+	}
+	text(formattedText[last:])
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package discord
+
+import "testing"
+
+func TestHTMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		html, want string
+	}{
+		{"", ""},
+		{"plain text", "plain text"},
+		{"You gain <strong>$5</strong>!", "You gain **$5**!"},
+		{"<b>bold</b> <em>it</em> <i>i</i> <u>u</u> <del>d</del>", "**bold** *it* *i* __u__ ~~d~~"},
+		{"Usage: <code>,alias &lt;UUID&gt;</code>", "Usage: `,alias <UUID>`"},
+		{"<code>a*b_c</code> and a*b_c", "`a*b_c` and a\\*b\\_c"},
+		{"<pre><code>x < y\n</code></pre>after", "```\nx < y\n\n```\nafter"},
+		{"line<br>break<br />again", "line\nbreak\nagain"},
+		{`<a href="https://x.org/?a=1&amp;b=2">site</a>`, "[site](https://x.org/?a=1&b=2)"},
+		{`<a href="https://x.org">https://x.org</a>`, "https://x.org"},
+		{`<a href="https://x.org"><strong>site</strong></a>`, "[**site**](https://x.org)"},
+		{"<span data-mx-spoiler>secret</span> <span>shown</span>", "||secret|| shown"},
+		{"<span data-mx-spoiler>a <span>b</span> c</span>", "||a b c||"},
+		{"<ul><li>one</li><li>two</li></ul>", "- one\n- two"},
+		{`<font color="#fff">white</font>`, "white"},
+		{"<@123> <#456> <@&789> <:smile:42> <t:1700000000>", "<@123> <#456> <@&789> <:smile:42> <t:1700000000>"},
+		{"<unknown>kept</unknown>", "<unknown\\>kept</unknown\\>"},
+		{"1 &lt; 2 &amp;&amp; 3 &gt; 2", "1 < 2 && 3 \\> 2"},
+	}
+	for _, test := range tests {
+		if got := htmlToMarkdown(test.html); got != test.want {
+			t.Errorf("htmlToMarkdown(%q) = %q, want %q", test.html, got, test.want)
+		}
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	if got := markdown("**text**", ""); got != "**text**" {
+		t.Errorf("markdown() without formatted text = %q, want the text as is", got)
+	}
+	if got := markdown("text", "<strong>text</strong>"); got != "**text**" {
+		t.Errorf("markdown() = %q, want the formatted text converted", got)
+	}
+}
@@ -58,11 +58,24 @@ func main() {
 
 	defer func() {
 		Info.Println("Shutting down...")
+		Shutdown()
 		UnloadPlugins()
 		UnloadProtocols()
 		Db.Close()
 	}()
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	signal.Notify(Quit, os.Interrupt, syscall.SIGTERM)
-	<-Quit
+	for {
+		select {
+		case <-hup:
+			Info.Println("Reloading config...")
+			if _, _, err := ReloadConfig(); err != nil {
+				Error.Println("Failed to reload config:", err)
+			}
+		case <-Quit:
+			return
+		}
+	}
 }
@@ -0,0 +1,301 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ArgType is the type of value an Arg accepts.
+type ArgType int
+
+const (
+	// ArgString is a single word, or several words wrapped in double quotes (Ex: "Hello World").
+	ArgString ArgType = iota
+	// ArgText is the remainder of the message, it must be the last arg.
+	ArgText
+	// ArgInt is a whole number, bounded by Min and Max if set, or "all" if AllowAll is set.
+	ArgInt
+	// ArgDuration is a length of time in Go's format (Ex: "1h30m").
+	ArgDuration
+	// ArgUser is a user mention (Ex: "<@123>" on Discord), or the UUID or name of a user mentioned in the message.
+	ArgUser
+	// ArgRole is a role mention (Ex: "<@&123>" on Discord), or the UUID or name of a role mentioned in the message.
+	ArgRole
+	// ArgLocation is a location mention (Ex: "<#123>" on Discord), or the UUID or name of a location mentioned in the
+	// message.
+	ArgLocation
+	// ArgCID is an IPFS content identifier (Ex: "bafy...", "Qm...").
+	ArgCID
+)
+
+// Arg describes a single argument taken by a command.
+type Arg struct {
+	Name     string  // Name shown in usage, and used to retrieve the value (ex: "sides")
+	Type     ArgType // The type of value accepted
+	Optional bool    // If true, the arg may be omitted. Optional args must come after required ones.
+	Default  string  // Parsed in place of the arg if it's optional and omitted (ex: "20")
+	Min, Max *int    // Bounds for ArgInt, ignored when nil (see Bound)
+	AllowAll bool    // If true, an ArgInt will also accept "all"
+}
+
+// Bound returns a pointer to n, for setting Arg.Min and Arg.Max (Ex: Min: onelib.Bound(1)).
+func Bound(n int) *int {
+	return &n
+}
+
+// usage returns the arg as it's shown in usage text (Ex: "<amount/all>").
+func (arg *Arg) usage() string {
+	name := arg.Name
+	if arg.Type == ArgInt && arg.AllowAll {
+		name += "/all"
+	}
+	if arg.Optional {
+		return "[" + name + "]"
+	}
+	return "<" + name + ">"
+}
+
+// parse converts raw into the type accepted by the arg. mentions are the mentions in the message, used to resolve an
+// ArgUser, ArgRole, or ArgLocation.
+func (arg *Arg) parse(raw string, mentions []*Mention) (interface{}, error) {
+	switch arg.Type {
+	case ArgString, ArgText:
+		return raw, nil
+	case ArgInt:
+		if arg.AllowAll && strings.ToLower(raw) == "all" {
+			return allValue{}, nil
+		}
+		num, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a whole number", arg.Name)
+		}
+		if arg.Min != nil && num < *arg.Min {
+			return nil, fmt.Errorf("%s must be at least %d", arg.Name, *arg.Min)
+		}
+		if arg.Max != nil && num > *arg.Max {
+			return nil, fmt.Errorf("%s must be at most %d", arg.Name, *arg.Max)
+		}
+		return num, nil
+	case ArgDuration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a duration (ex: 1h30m)", arg.Name)
+		}
+		return d, nil
+	case ArgUser:
+		if strings.HasPrefix(raw, "<@&") {
+			return nil, fmt.Errorf("%s must be a mention of a user", arg.Name)
+		}
+		return resolveMention(arg.Name, raw, MentionUser, mentions, "<@!", "<@")
+	case ArgRole:
+		return resolveMention(arg.Name, raw, MentionRole, mentions, "<@&")
+	case ArgLocation:
+		return resolveMention(arg.Name, raw, MentionLocation, mentions, "<#")
+	case ArgCID:
+		if !isCID(raw) {
+			return nil, fmt.Errorf("%s must be a CID", arg.Name)
+		}
+		return raw, nil
+	}
+	return nil, fmt.Errorf("%s has an unknown type", arg.Name)
+}
+
+// allValue is stored for an ArgInt given "all".
+type allValue struct{}
+
+// mentionNames are what each type of mention is called in errors.
+var mentionNames = map[MentionType]string{MentionUser: "user", MentionRole: "role", MentionLocation: "location"}
+
+// resolveMention returns the UUID raw refers to. raw may be a mention wrapped with one of the opening sequences in
+// starts (Ex: "<@123>"), or the UUID or display name (optionally starting with "@" or "#") of one of mentions of typ.
+func resolveMention(name, raw string, typ MentionType, mentions []*Mention, starts ...string) (UUID, error) {
+	if id, ok := unwrapMention(raw, starts...); ok && id != "" {
+		return UUID(id), nil
+	}
+	for _, mention := range mentions {
+		if mention.Type != typ {
+			continue
+		}
+		if string(mention.UUID) == raw || (mention.DisplayName != "" && (mention.DisplayName == raw ||
+			mention.DisplayName == strings.TrimLeft(raw, "@#"))) {
+			return mention.UUID, nil
+		}
+	}
+	return "", fmt.Errorf("%s must be a mention of a %s", name, mentionNames[typ])
+}
+
+// unwrapMention returns the ID inside of a mention such as "<@123>", and true if s is wrapped with any of the opening
+// sequences in starts.
+func unwrapMention(s string, starts ...string) (string, bool) {
+	if !strings.HasSuffix(s, ">") {
+		return s, false
+	}
+	for _, start := range starts {
+		if strings.HasPrefix(s, start) {
+			return s[len(start) : len(s)-1], true
+		}
+	}
+	return s, false
+}
+
+// isCID returns true if s looks like a CIDv0 or a base32 / base36 CIDv1.
+func isCID(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	if strings.HasPrefix(s, "Qm") {
+		return len(s) == 46
+	}
+	return len(s) >= 50 && (s[0] == 'b' || s[0] == 'k') && strings.ToLower(s) == s
+}
+
+// splitArgs splits text on whitespace, keeping words wrapped in double quotes together, stopping after limit tokens if
+// limit is positive. The returned offsets are where each token starts in text.
+func splitArgs(text string, limit int) (tokens []string, offsets []int, err error) {
+	i := 0
+	for i < len(text) && (limit <= 0 || len(tokens) < limit) {
+		if text[i] == ' ' || text[i] == '\t' || text[i] == '\n' {
+			i++
+			continue
+		}
+		offsets = append(offsets, i)
+		if text[i] == '"' {
+			end := strings.IndexByte(text[i+1:], '"')
+			if end == -1 {
+				return nil, nil, fmt.Errorf("missing closing quote")
+			}
+			tokens = append(tokens, text[i+1:i+1+end])
+			i += end + 2
+			continue
+		}
+		end := strings.IndexAny(text[i:], " \t\n")
+		if end == -1 {
+			end = len(text) - i
+		}
+		tokens = append(tokens, text[i:i+end])
+		i += end
+	}
+	return tokens, offsets, nil
+}
+
+// Args holds the parsed arguments of a command call, see CommandArgs.
+type Args struct {
+	values map[string]interface{}
+}
+
+// ParseArgs parses text into the values described by args. mentions are the mentions in the message (see Mentions),
+// an ArgUser, ArgRole, or ArgLocation must be one of them, or in the protocol's mention format.
+func ParseArgs(args []*Arg, text string, mentions []*Mention) (*Args, error) {
+	limit := 0
+	if len(args) > 0 && args[len(args)-1].Type == ArgText {
+		limit = len(args)
+	}
+	text = strings.TrimSpace(text)
+	tokens, offsets, err := splitArgs(text, limit)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &Args{values: make(map[string]interface{}, len(args))}
+	for i, arg := range args {
+		var raw string
+		switch {
+		case i < len(tokens) && arg.Type == ArgText:
+			raw = text[offsets[i]:]
+		case i < len(tokens):
+			raw = tokens[i]
+		case arg.Optional && arg.Default == "":
+			continue
+		case arg.Optional:
+			raw = arg.Default
+		default:
+			return nil, fmt.Errorf("missing %s", arg.Name)
+		}
+		value, err := arg.parse(raw, mentions)
+		if err != nil {
+			return nil, err
+		}
+		parsed.values[arg.Name] = value
+	}
+	if len(tokens) > len(args) {
+		return nil, fmt.Errorf("too many arguments")
+	}
+	return parsed, nil
+}
+
+// ArgsUsage returns the usage text for args (Ex: "<messageID> <emoji> [@role]").
+func ArgsUsage(args []*Arg) string {
+	usage := make([]string, len(args))
+	for i, arg := range args {
+		usage[i] = arg.usage()
+	}
+	return strings.Join(usage, " ")
+}
+
+// Has returns true if the arg was given, or has a default.
+func (a *Args) Has(name string) bool {
+	_, ok := a.values[name]
+	return ok
+}
+
+// String returns the value of an ArgString, ArgText, or ArgCID.
+func (a *Args) String(name string) string {
+	s, _ := a.values[name].(string)
+	return s
+}
+
+// Int returns the value of an ArgInt, it's 0 if "all" was given (see All).
+func (a *Args) Int(name string) int {
+	num, _ := a.values[name].(int)
+	return num
+}
+
+// All returns true if an ArgInt was given "all".
+func (a *Args) All(name string) bool {
+	_, ok := a.values[name].(allValue)
+	return ok
+}
+
+// Duration returns the value of an ArgDuration.
+func (a *Args) Duration(name string) time.Duration {
+	d, _ := a.values[name].(time.Duration)
+	return d
+}
+
+// UUID returns the value of an ArgUser, ArgRole, or ArgLocation.
+func (a *Args) UUID(name string) UUID {
+	uuid, _ := a.values[name].(UUID)
+	return uuid
+}
+
+// argsMessage is a Message carrying the args parsed from it. Protocols' optional interfaces are found by unwrapping it,
+// see UnwrapMessage.
+type argsMessage struct {
+	Message
+	args *Args
+}
+
+// StripPrefix returns a copy of the message with the prefix stripped, keeping the parsed args.
+func (am *argsMessage) StripPrefix(prefix string) Message {
+	return &argsMessage{Message: am.Message.StripPrefix(prefix), args: am.args}
+}
+
+// Unwrap returns the message the args were parsed from.
+func (am *argsMessage) Unwrap() Message {
+	return am.Message
+}
+
+// CommandArgs returns the args parsed from a command call. If the command doesn't declare any args, the returned Args
+// is empty.
+func CommandArgs(msg Message) *Args {
+	if am, ok := msg.(*argsMessage); ok {
+		return am.args
+	}
+	return &Args{values: make(map[string]interface{})}
+}
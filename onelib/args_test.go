@@ -0,0 +1,139 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testMessage is a Message implementing the optional message interfaces.
+type testMessage struct {
+	uuid     UUID // "msg" if blank
+	text     string
+	reaction *Emoji
+	replyTo  UUID
+	thread   UUID
+	mentions []*Mention
+}
+
+func (tm *testMessage) Text() string          { return tm.text }
+func (tm *testMessage) FormattedText() string { return tm.text }
+func (tm *testMessage) Raw() []byte           { return []byte(tm.text) }
+func (tm *testMessage) Mentioned() bool       { return false }
+func (tm *testMessage) Reaction() *Emoji      { return tm.reaction }
+func (tm *testMessage) ReplyTo() UUID         { return tm.replyTo }
+func (tm *testMessage) Thread() UUID          { return tm.thread }
+func (tm *testMessage) Mentions() []*Mention  { return tm.mentions }
+func (tm *testMessage) Attachments() []*Attachment {
+	return []*Attachment{{Name: "a.png"}}
+}
+
+func (tm *testMessage) UUID() UUID {
+	if tm.uuid == "" {
+		return "msg"
+	}
+	return tm.uuid
+}
+
+func (tm *testMessage) StripPrefix(prefix string) Message {
+	stripped := *tm
+	stripped.text = strings.TrimPrefix(tm.text, prefix)
+	return &stripped
+}
+
+func TestArgsMessageKeepsInterfaces(t *testing.T) {
+	mention := &Mention{Type: MentionUser, UUID: "123", DisplayName: "User"}
+	inv := &Invocation{
+		Spec:    &CommandSpec{Name: "give", Args: []*Arg{{Name: "user", Type: ArgUser}, {Name: "amount", Type: ArgInt}}},
+		Message: &testMessage{text: "<@123> 5", replyTo: "parent", thread: "root", mentions: []*Mention{mention}},
+	}
+	if !parseArgs(inv) {
+		t.Fatal("parseArgs refused the call")
+	}
+	if args := CommandArgs(inv.Message); args.UUID("user") != "123" || args.Int("amount") != 5 {
+		t.Errorf("args = %v, want user 123 and amount 5", args.values)
+	}
+	if replyTo, thread := ReplyTo(inv.Message); replyTo != "parent" || thread != "root" {
+		t.Errorf("ReplyTo() = %q, %q, want \"parent\", \"root\"", replyTo, thread)
+	}
+	if mentions := Mentions(inv.Message); len(mentions) != 1 || mentions[0] != mention {
+		t.Errorf("Mentions() = %v, want the message's mention", mentions)
+	}
+	if attachments := Attachments(inv.Message); len(attachments) != 1 {
+		t.Errorf("Attachments() returned %d attachments, want 1", len(attachments))
+	}
+	stripped := inv.Message.StripPrefix("<@123> ")
+	if CommandArgs(stripped).Int("amount") != 5 {
+		t.Error("StripPrefix lost the parsed args")
+	}
+	if _, thread := ReplyTo(stripped); thread != "root" {
+		t.Errorf("ReplyTo() after StripPrefix = %q, want \"root\"", thread)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	mentions := []*Mention{
+		{Type: MentionUser, UUID: "@alice:example.org", DisplayName: "Alice"},
+		{Type: MentionRole, UUID: "456", DisplayName: "mods"},
+	}
+	tests := []struct {
+		name    string
+		args    []*Arg
+		text    string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{"string and text", []*Arg{{Name: "a"}, {Name: "rest", Type: ArgText}}, `"hello world"  the  rest`,
+			map[string]interface{}{"a": "hello world", "rest": "the  rest"}, ""},
+		{"missing closing quote", []*Arg{{Name: "a"}}, `"hello`, nil, "missing closing quote"},
+		{"missing required", []*Arg{{Name: "a"}, {Name: "b"}}, "x", nil, "missing b"},
+		{"too many", []*Arg{{Name: "a"}}, "x y", nil, "too many arguments"},
+		{"optional default", []*Arg{{Name: "sides", Type: ArgInt, Optional: true, Default: "20"}}, "",
+			map[string]interface{}{"sides": 20}, ""},
+		{"optional omitted", []*Arg{{Name: "a", Optional: true}}, "", map[string]interface{}{}, ""},
+		{"not a number", []*Arg{{Name: "n", Type: ArgInt}}, "ten", nil, "n must be a whole number"},
+		{"all", []*Arg{{Name: "n", Type: ArgInt, AllowAll: true}}, "ALL", map[string]interface{}{"n": allValue{}}, ""},
+		{"all not allowed", []*Arg{{Name: "n", Type: ArgInt}}, "all", nil, "n must be a whole number"},
+		{"no bounds", []*Arg{{Name: "n", Type: ArgInt}}, "-5", map[string]interface{}{"n": -5}, ""},
+		{"min zero", []*Arg{{Name: "n", Type: ArgInt, Min: Bound(0)}}, "-1", nil, "n must be at least 0"},
+		{"min zero allows zero", []*Arg{{Name: "n", Type: ArgInt, Min: Bound(0)}}, "0", map[string]interface{}{"n": 0}, ""},
+		{"max", []*Arg{{Name: "n", Type: ArgInt, Max: Bound(10)}}, "11", nil, "n must be at most 10"},
+		{"duration", []*Arg{{Name: "d", Type: ArgDuration}}, "1h30m", map[string]interface{}{"d": 90 * time.Minute}, ""},
+		{"bad duration", []*Arg{{Name: "d", Type: ArgDuration}}, "soon", nil, "d must be a duration (ex: 1h30m)"},
+		{"user mention", []*Arg{{Name: "u", Type: ArgUser}}, "<@!123>", map[string]interface{}{"u": UUID("123")}, ""},
+		{"role mention as user", []*Arg{{Name: "u", Type: ArgUser}}, "<@&123>", nil, "u must be a mention of a user"},
+		{"user by name", []*Arg{{Name: "u", Type: ArgUser}}, "@Alice",
+			map[string]interface{}{"u": UUID("@alice:example.org")}, ""},
+		{"user by UUID", []*Arg{{Name: "u", Type: ArgUser}}, "@alice:example.org",
+			map[string]interface{}{"u": UUID("@alice:example.org")}, ""},
+		{"user not mentioned", []*Arg{{Name: "u", Type: ArgUser}}, "bob", nil, "u must be a mention of a user"},
+		{"role mention", []*Arg{{Name: "r", Type: ArgRole}}, "<@&789>", map[string]interface{}{"r": UUID("789")}, ""},
+		{"role by name", []*Arg{{Name: "r", Type: ArgRole}}, "mods", map[string]interface{}{"r": UUID("456")}, ""},
+		{"user is not a role", []*Arg{{Name: "r", Type: ArgRole}}, "Alice", nil, "r must be a mention of a role"},
+		{"location mention", []*Arg{{Name: "l", Type: ArgLocation}}, "<#42>", map[string]interface{}{"l": UUID("42")}, ""},
+		{"empty mention", []*Arg{{Name: "l", Type: ArgLocation}}, "<#>", nil, "l must be a mention of a location"},
+		{"CIDv0", []*Arg{{Name: "c", Type: ArgCID}}, "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+			map[string]interface{}{"c": "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"}, ""},
+		{"not a CID", []*Arg{{Name: "c", Type: ArgCID}}, "hello", nil, "c must be a CID"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args, err := ParseArgs(test.args, test.text, mentions)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("ParseArgs() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseArgs() error = %v", err)
+			}
+			if !reflect.DeepEqual(args.values, test.want) {
+				t.Errorf("ParseArgs() = %v, want %v", args.values, test.want)
+			}
+		})
+	}
+}
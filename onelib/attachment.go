@@ -0,0 +1,119 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// MaxAttachmentSize is the largest attachment Attachment.Data will read, in bytes.
+var MaxAttachmentSize int64 = 50 << 20
+
+// Attachment is a file (ex: an image) sent with a message, or to be sent to a location.
+type Attachment struct {
+	Name     string    // The file name (ex: "comic.png")
+	MIMEType string    // The MIME type (ex: "image/png"), if blank when sending it's guessed from Name, or the data
+	Size     int64     // The size in bytes, 0 if unknown
+	URL      string    // Where the file can be downloaded from, if known
+	Reader   io.Reader // The file's data, read in place of downloading URL if set (it can only be read once)
+	Alt      string    // A description of the file for those who can't see it, if any
+}
+
+// IsImage returns true if the attachment's MIME type is an image.
+func (a *Attachment) IsImage() bool {
+	return strings.HasPrefix(a.MIMEType, "image/")
+}
+
+// Open returns the attachment's data, from Reader if set, otherwise downloading it from URL. It should be closed once
+// read.
+func (a *Attachment) Open(ctx context.Context) (io.ReadCloser, error) {
+	if a.Reader != nil {
+		if rc, ok := a.Reader.(io.ReadCloser); ok {
+			return rc, nil
+		}
+		return io.NopCloser(a.Reader), nil
+	}
+	if a.URL == "" {
+		return nil, fmt.Errorf("attachment '%s' has no data or URL", a.Name)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", a.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading attachment '%s' failed: %s", a.Name, resp.Status)
+	}
+	if a.MIMEType == "" {
+		a.MIMEType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	}
+	return resp.Body, nil
+}
+
+// Data reads the attachment (see Open), setting Size, and MIMEType if it's blank. Attachments larger than
+// MaxAttachmentSize return an error.
+func (a *Attachment) Data(ctx context.Context) ([]byte, error) {
+	rc, err := a.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, MaxAttachmentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MaxAttachmentSize {
+		return nil, fmt.Errorf("attachment '%s' is larger than %d bytes", a.Name, MaxAttachmentSize)
+	}
+	a.Size = int64(len(data))
+	if a.MIMEType == "" {
+		a.MIMEType = mime.TypeByExtension(path.Ext(a.Name))
+	}
+	if a.MIMEType == "" {
+		a.MIMEType = http.DetectContentType(data)
+	}
+	if a.Name == "" {
+		a.Name = "file"
+		if exts, _ := mime.ExtensionsByType(a.MIMEType); len(exts) > 0 {
+			a.Name += exts[0]
+		}
+	}
+	return data, nil
+}
+
+// AttachmentMessage can optionally be implemented by a Message which can carry attachments.
+type AttachmentMessage interface {
+	Attachments() []*Attachment // The files sent with the message
+}
+
+// AttachmentSender can optionally be implemented by a Location which files can be sent to.
+type AttachmentSender interface {
+	SendAttachment(ctx context.Context, attachment *Attachment, text string) (*SentMessage, error) // Sends the file, with text if supported
+}
+
+// Attachments returns the files sent with msg, if the protocol supports them (see AttachmentMessage).
+func Attachments(msg Message) []*Attachment {
+	if am, ok := UnwrapMessage(msg).(AttachmentMessage); ok {
+		return am.Attachments()
+	}
+	return nil
+}
+
+// SendAttachment sends attachment to location with text, if the location supports files (see AttachmentSender).
+// Otherwise ErrNotSupported is returned.
+func SendAttachment(ctx context.Context, location Location, attachment *Attachment, text string) (*SentMessage, error) {
+	if as, ok := location.(AttachmentSender); ok {
+		return as.SendAttachment(ctx, attachment, text)
+	}
+	return nil, ErrNotSupported
+}
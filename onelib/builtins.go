@@ -0,0 +1,400 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// BuiltinPlugin is the plugin name given to commands built into OneBot.
+	BuiltinPlugin = "onebot"
+)
+
+// loadBuiltins puts the commands and middlewares built into OneBot into place.
+func loadBuiltins() {
+	loadBuiltinMiddlewares()
+	Commands.PutSpec(&CommandSpec{
+		Name:        "help",
+		Aliases:     []string{"commands"},
+		Description: "Lists the available commands, or explains how to use one.",
+		Usage:       "[command]",
+		Plugin:      BuiltinPlugin,
+		Command:     help,
+	})
+	Commands.PutSpec(&CommandSpec{
+		Name:        "prefix",
+		Description: "Shows the command prefix used here, or changes it. Use 'reset' to go back to the protocol's prefix.",
+		Usage:       "[new prefix/reset]",
+		Permission:  PermissionModerator,
+		Plugin:      BuiltinPlugin,
+		Command:     locationPrefix,
+	})
+	Commands.PutSpec(&CommandSpec{
+		Name:        "protocolprefix",
+		Description: "Shows the command prefix used on this protocol, or changes it. Use 'reset' to go back to the default prefix.",
+		Usage:       "[new prefix/reset]",
+		Permission:  PermissionAdmin,
+		Plugin:      BuiltinPlugin,
+		Command:     protocolPrefix,
+	})
+	Commands.PutSpec(&CommandSpec{
+		Name:        "restartplugin",
+		Description: "Restarts a plugin running as its own process, picking up any changes to it.",
+		Args:        []*Arg{{Name: "plugin", Type: ArgString}},
+		Permission:  PermissionAdmin,
+		Plugin:      BuiltinPlugin,
+		Command:     restartPlugin,
+	})
+	Commands.PutSpec(&CommandSpec{
+		Name: "schedule",
+		Description: "Schedules text to be posted here 'in' a duration, 'at' a time, 'every' interval, or on a 'cron' " +
+			`expression (ex: schedule cron "0 9 * * mon" Good morning!).`,
+		Args: []*Arg{
+			{Name: "in/at/every/cron", Type: ArgString},
+			{Name: "when", Type: ArgString},
+			{Name: "text", Type: ArgText},
+		},
+		Permission: PermissionModerator,
+		Plugin:     BuiltinPlugin,
+		Command:    scheduleCommand,
+	})
+	Commands.PutSpec(&CommandSpec{
+		Name:        "unschedule",
+		Description: "Removes a job scheduled here.",
+		Args:        []*Arg{{Name: "job ID", Type: ArgString}},
+		Permission:  PermissionModerator,
+		Plugin:      BuiltinPlugin,
+		Command:     unscheduleCommand,
+	})
+	Commands.PutSpec(&CommandSpec{
+		Name:        "jobs",
+		Description: "Lists the jobs scheduled here.",
+		Permission:  PermissionModerator,
+		Plugin:      BuiltinPlugin,
+		Command:     listJobs,
+	})
+	Commands.PutSpec(&CommandSpec{
+		Name:        "loglevel",
+		Description: "Shows the log levels, or sets the level logged for a plugin or protocol (debug, info, error, or reset), or 'default'.",
+		Args: []*Arg{
+			{Name: "plugin/protocol/default", Type: ArgString, Optional: true},
+			{Name: "level", Type: ArgString, Optional: true},
+		},
+		Permission: PermissionAdmin,
+		Plugin:     BuiltinPlugin,
+		Command:    logLevelCommand,
+	})
+	Commands.PutSpec(&CommandSpec{
+		Name:        "reloadconfig",
+		Description: "Reads the config file again, applying changes which don't need a restart.",
+		Permission:  PermissionAdmin,
+		Plugin:      BuiltinPlugin,
+		Command:     reloadConfigCommand,
+	})
+	Commands.PutSpec(&CommandSpec{
+		Name:        "config",
+		Description: "Describes the config of a plugin or protocol, with the values in use. Secrets are hidden.",
+		Args:        []*Arg{{Name: "plugin/protocol", Type: ArgString}},
+		Permission:  PermissionAdmin,
+		Plugin:      BuiltinPlugin,
+		Command:     describeConfigCommand,
+	})
+	Scheduler.Handle(BuiltinPlugin, "say", sayJob)
+}
+
+// pluginLongName returns the display name of a loaded plugin, falling back on its name.
+func pluginLongName(name string) string {
+	if name == BuiltinPlugin {
+		return "OneBot"
+	}
+	if plug := Plugins.Get(name); plug != nil {
+		return plug.LongName()
+	}
+	return name
+}
+
+// describeCommand returns a text and formatted text explanation of a command.
+func describeCommand(prefix string, spec *CommandSpec) (text, formattedText string) {
+	call := strings.TrimSpace(prefix + spec.Name + " " + spec.UsageText())
+	text = "`" + call + "`"
+	formattedText = "<code>" + html.EscapeString(call) + "</code>"
+	if len(spec.Aliases) > 0 {
+		text += " (aliases: " + strings.Join(spec.Aliases, ", ") + ")"
+		aliases := make([]string, len(spec.Aliases))
+		for i, alias := range spec.Aliases {
+			aliases[i] = "<code>" + html.EscapeString(alias) + "</code>"
+		}
+		formattedText += " (aliases: " + strings.Join(aliases, ", ") + ")"
+	}
+	if spec.Description != "" {
+		text += "\n" + spec.Description
+		formattedText += "<br />\n" + html.EscapeString(spec.Description)
+	}
+	if spec.Permission > PermissionUser {
+		text += "\nRequires: " + spec.Permission.String()
+		formattedText += "<br />\nRequires: <strong>" + spec.Permission.String() + "</strong>"
+	}
+	return
+}
+
+// help lists every command the sender may call, grouped by plugin, or explains a single command.
+func help(msg Message, sender Sender) {
+	prefix := SenderPrefix(sender)
+	if name := strings.TrimPrefix(strings.TrimSpace(msg.Text()), prefix); name != "" {
+		spec := Commands.GetSpec(name)
+		if spec == nil || !HasPermission(sender, spec.Permission) {
+			sender.Location().SendText(fmt.Sprintf("Unknown command '%s'. Try '%shelp' for a list of commands.", name, prefix))
+			return
+		}
+		text, formattedText := describeCommand(prefix, spec)
+		sender.Location().SendFormattedText(text, formattedText)
+		return
+	}
+
+	text := fmt.Sprintf("Commands (use `%shelp <command>` for details):", prefix)
+	formattedText := fmt.Sprintf("<strong>Commands</strong> (use <code>%shelp &lt;command&gt;</code> for details):", html.EscapeString(prefix))
+	var lastPlugin string
+	for _, spec := range Commands.List() {
+		if spec.Hidden || !HasPermission(sender, spec.Permission) {
+			continue
+		}
+		if spec.Plugin != lastPlugin {
+			longName := pluginLongName(spec.Plugin)
+			text += fmt.Sprintf("\n**%s**: %s", longName, spec.Name)
+			formattedText += fmt.Sprintf("<br />\n<strong>%s</strong>: %s", html.EscapeString(longName), html.EscapeString(spec.Name))
+			lastPlugin = spec.Plugin
+			continue
+		}
+		text += ", " + spec.Name
+		formattedText += ", " + html.EscapeString(spec.Name)
+	}
+	sender.Location().SendFormattedText(text, formattedText)
+}
+
+// setPrefix shows or changes the prefix for location on the sender's protocol, location is blank for the protocol.
+func setPrefix(msg Message, sender Sender, location UUID) {
+	prefix := strings.TrimSpace(msg.Text())
+	switch prefix {
+	case "":
+		current := GetPrefix(sender.Protocol(), location)
+		sender.Location().SendFormattedText(fmt.Sprintf("The prefix is `%s`.", current), fmt.Sprintf("The prefix is <code>%s</code>.", html.EscapeString(current)))
+		return
+	case "reset":
+		prefix = ""
+	}
+	if err := SetPrefix(sender.Protocol(), location, prefix); err != nil {
+		sender.Location().SendText(fmt.Sprintf("Couldn't set prefix: %s.", err))
+		return
+	}
+	current := GetPrefix(sender.Protocol(), location)
+	sender.Location().SendFormattedText(fmt.Sprintf("The prefix is now `%s`.", current), fmt.Sprintf("The prefix is now <code>%s</code>.", html.EscapeString(current)))
+}
+
+// locationPrefix shows or changes the prefix for the sender's location.
+func locationPrefix(msg Message, sender Sender) {
+	setPrefix(msg, sender, sender.Location().UUID())
+}
+
+// protocolPrefix shows or changes the prefix for the sender's protocol.
+func protocolPrefix(msg Message, sender Sender) {
+	setPrefix(msg, sender, "")
+}
+
+// restartPlugin restarts an RPC plugin.
+func restartPlugin(msg Message, sender Sender) {
+	name := CommandArgs(msg).String("plugin")
+	rp, ok := Plugins.Get(name).(*RPCPlugin)
+	if !ok {
+		sender.Location().SendText(fmt.Sprintf("'%s' isn't a plugin running as its own process.", name))
+		return
+	}
+	if err := rp.Restart(); err != nil {
+		sender.Location().SendText(fmt.Sprintf("Couldn't restart '%s': %s", name, err))
+		return
+	}
+	sender.Location().SendText(fmt.Sprintf("Restarted '%s' version %s.", rp.LongName(), rp.Version()))
+}
+
+// sayJob posts the job's data to the location it was scheduled from.
+func sayJob(ctx context.Context, job *Job) error {
+	proto := Protocols.Get(job.Protocol)
+	if proto == nil {
+		return fmt.Errorf("protocol '%s' not loaded", job.Protocol)
+	}
+	_, err := proto.SendText(job.Location, job.Data)
+	return err
+}
+
+// parseTime parses a time of day ("15:04"), or a date and time ("2006-01-02 15:04"), in local time. A time of day is
+// the next time it comes around.
+func parseTime(s string) (time.Time, error) {
+	now := time.Now()
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	t, err := time.ParseInLocation("15:04", s, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("time must be in the format '15:04' or '2006-01-02 15:04'")
+	}
+	t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// scheduleCommand schedules text to be posted in the sender's location.
+func scheduleCommand(msg Message, sender Sender) {
+	args := CommandArgs(msg)
+	job := &Job{Owner: BuiltinPlugin, Handler: "say", Data: args.String("text"), Protocol: sender.Protocol(),
+		Location: sender.Location().UUID(), Persist: true}
+	when := args.String("when")
+	var err error
+	switch kind := strings.ToLower(args.String("in/at/every/cron")); kind {
+	case "in", "every":
+		var d time.Duration
+		if d, err = time.ParseDuration(when); err != nil {
+			err = fmt.Errorf("duration must be in the format '1h30m'")
+		} else if kind == "in" {
+			job.At = time.Now().Add(d)
+		} else {
+			job.Every = d
+		}
+	case "at":
+		job.At, err = parseTime(when)
+	case "cron":
+		job.Cron = when
+	default:
+		err = fmt.Errorf("expected 'in', 'at', 'every', or 'cron', got '%s'", kind)
+	}
+	if err == nil {
+		err = Scheduler.Schedule(job)
+	}
+	if err != nil {
+		sender.Location().SendText(fmt.Sprintf("Couldn't schedule: %s.", err))
+		return
+	}
+	sender.Location().SendFormattedText(
+		fmt.Sprintf("Scheduled job `%s` to run %s, next in %s.", job.ID, job.Describe(), FormatDuration(time.Until(job.Next))),
+		fmt.Sprintf("Scheduled job <code>%s</code> to run %s, next in %s.", job.ID, html.EscapeString(job.Describe()), FormatDuration(time.Until(job.Next))))
+}
+
+// unscheduleCommand removes a job scheduled in the sender's location. Admins may remove any job.
+func unscheduleCommand(msg Message, sender Sender) {
+	id := CommandArgs(msg).String("job ID")
+	job := Scheduler.Get(id)
+	if job == nil || (!HasPermission(sender, PermissionAdmin) && (job.Protocol != sender.Protocol() || job.Location != sender.Location().UUID())) {
+		sender.Location().SendText(fmt.Sprintf("No job '%s' is scheduled here.", id))
+		return
+	}
+	if err := Scheduler.Unschedule(id); err != nil {
+		sender.Location().SendText(fmt.Sprintf("Couldn't unschedule: %s.", err))
+		return
+	}
+	sender.Location().SendText(fmt.Sprintf("Unscheduled job '%s'.", id))
+}
+
+// listJobs lists the jobs scheduled in the sender's location.
+func listJobs(msg Message, sender Sender) {
+	text := "Jobs scheduled here:"
+	formattedText := "<strong>Jobs scheduled here:</strong>"
+	var found bool
+	for _, job := range Scheduler.List() {
+		if job.Protocol != sender.Protocol() || job.Location != sender.Location().UUID() {
+			continue
+		}
+		found = true
+		text += fmt.Sprintf("\n`%s` %s, next in %s: %s", job.ID, job.Describe(), FormatDuration(time.Until(job.Next)), job.Data)
+		formattedText += fmt.Sprintf("<br />\n<code>%s</code> %s, next in %s: %s", job.ID, html.EscapeString(job.Describe()),
+			FormatDuration(time.Until(job.Next)), html.EscapeString(job.Data))
+	}
+	if !found {
+		sender.Location().SendText("No jobs are scheduled here.")
+		return
+	}
+	sender.Location().SendFormattedText(text, formattedText)
+}
+
+// logLevelCommand shows the log levels, or sets one.
+func logLevelCommand(msg Message, sender Sender) {
+	args := CommandArgs(msg)
+	name := args.String("plugin/protocol/default")
+	if name == "default" {
+		name = ""
+	}
+	if !args.Has("level") {
+		if args.Has("plugin/protocol/default") {
+			sender.Location().SendText(fmt.Sprintf("Logging %s and above for '%s'.", LogLevel(name), args.String("plugin/protocol/default")))
+			return
+		}
+		levels := LogLevels()
+		text := fmt.Sprintf("Logging %s and above by default.", levels[""])
+		names := make([]string, 0, len(levels))
+		for name := range levels {
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			text += fmt.Sprintf("\n%s: %s", name, levels[name])
+		}
+		sender.Location().SendText(text)
+		return
+	}
+	if args.String("level") == "reset" {
+		if name == "" {
+			sender.Location().SendText("The default level can't be reset, set it instead.")
+			return
+		}
+		ResetLogLevel(name)
+		sender.Location().SendText(fmt.Sprintf("'%s' now logs at the default level (%s).", name, LogLevel("")))
+		return
+	}
+	level, err := ParseLevel(args.String("level"))
+	if err != nil {
+		sender.Location().SendText(capitalize(err.Error()) + ".")
+		return
+	}
+	SetLogLevel(name, level)
+	Info.Printf("%s set the log level for '%s' to %s.\n", sender.UUID(), args.String("plugin/protocol/default"), level)
+	sender.Location().SendText(fmt.Sprintf("Logging %s and above for '%s'.", level, args.String("plugin/protocol/default")))
+}
+
+// reloadConfigCommand reloads the config file, listing the sections which changed and any problems found in them.
+func reloadConfigCommand(msg Message, sender Sender) {
+	changed, invalid, err := ReloadConfig()
+	if err != nil {
+		Error.Println("Failed to reload config:", err)
+		sender.Location().SendText(fmt.Sprintf("Couldn't reload the config: %s", err))
+		return
+	}
+	if len(changed) == 0 {
+		sender.Location().SendText("Config reloaded, nothing changed.")
+		return
+	}
+	text := fmt.Sprintf("Config reloaded, changed: %s.", strings.Join(changed, ", "))
+	for _, problem := range invalid {
+		text += fmt.Sprintf("\n%s.", capitalize(problem.Error()))
+	}
+	sender.Location().SendText(text)
+}
+
+// describeConfigCommand describes the config section of a plugin or protocol.
+func describeConfigCommand(msg Message, sender Sender) {
+	section := CommandArgs(msg).String("plugin/protocol")
+	text, err := DescribeConfig(section)
+	if err != nil {
+		sender.Location().SendText(capitalize(err.Error()) + ".")
+		return
+	}
+	sender.Location().SendText(fmt.Sprintf("[%s]\n%s", section, text))
+}
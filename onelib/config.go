@@ -4,19 +4,49 @@ package onelib
 
 import (
 	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 	"github.com/pelletier/go-toml"
 )
 
-var config *toml.Tree
+var (
+	config *toml.Tree
+	// configLock guards config, and the settings read from it which can change on reload
+	configLock = new(sync.RWMutex)
+)
+
+// ConfigFile is the path of the config file read by LoadConfig and ReloadConfig.
+var ConfigFile = "onebot.toml"
+
+// restartKeys are the parts of the config which are only read on startup.
+var restartKeys = []string{"general.default_nickname", "general.default_avatar", "general.plugin_path", "general.plugins",
+	"general.protocol_path", "general.protocols", "database", "rpc_plugins", "metrics"}
+
+// configGet returns the value at key (Ex: "money.cute_time") in the config file, or nil if it isn't set.
+func configGet(key string) interface{} {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if config == nil {
+		return nil
+	}
+	return config.Get(key)
+}
 
 // GetTextConfig returns a config value, checking the DB first, expecting a string.
 func GetTextConfig(plugin, key string) string {
 	if txt, _ := Db.GetString(plugin, key); txt != "" {
 		return txt
 	}
-	if cfg := config.Get(fmt.Sprintf("%s.%s", plugin, key)); cfg != nil {
-		return cfg.(string)
+	if cfg := configGet(fmt.Sprintf("%s.%s", plugin, key)); cfg != nil {
+		if txt, err := convertConfig(ConfigString, cfg); err == nil {
+			return txt.(string)
+		}
+		Error.Printf("Config key '%s.%s' should be a string.\n", plugin, key)
 	}
 	return ""
 }
@@ -30,8 +60,8 @@ func GetBoolConfig(plugin, key string) bool {
 		}
 		return b
 	}
-	if cfg := config.Get(fmt.Sprintf("%s.%s", plugin, key)); cfg != nil {
-		return cfg.(bool)
+	if b, ok := configGet(fmt.Sprintf("%s.%s", plugin, key)).(bool); ok {
+		return b
 	}
 	return false
 }
@@ -41,8 +71,12 @@ func GetIntConfig(plugin, key string) (int, error) {
 	if num, err := Db.GetInt(plugin, key); err == nil {
 		return num, nil
 	}
-	if cfg := config.Get(fmt.Sprintf("%s.%s", plugin, key)); cfg != nil {
-		return int(cfg.(int64)), nil
+	if cfg := configGet(fmt.Sprintf("%s.%s", plugin, key)); cfg != nil {
+		num, err := convertConfig(ConfigInt, cfg)
+		if err != nil {
+			return 0, fmt.Errorf("config key '%s.%s' %s", plugin, key, err)
+		}
+		return num.(int), nil
 	}
 	return 0, fmt.Errorf("config key '%s.%s' not found", plugin, key)
 }
@@ -62,20 +96,22 @@ func SetIntConfig(plugin, key string, num int) {
 	Db.PutInt(plugin, key, num)
 }
 
-// LoadConfig loads the configuration file and inits the DB. This does not respect locks on config, do not run this
-// while any goroutines are running. Ultimately this will check the DB before loading from the config file.
-// TODO set default config path
+// LoadConfig loads the configuration file and inits the DB. Run this once on startup, use ReloadConfig to pick up
+// changes after. Ultimately this will check the DB before loading from the config file.
 // TODO add an option to check DB before config file
 func LoadConfig() {
-	var err error
-	config, err = toml.LoadFile("onebot.toml")
+	tree, err := toml.LoadFile(ConfigFile)
 
 	if err != nil {
 		Error.Panicln("Error loading config", err.Error())
 	}
-	DefaultPrefix = config.Get("general.default_prefix").(string)
+	configLock.Lock()
+	config = tree
 	DefaultNickname = config.Get("general.default_nickname").(string)
 	DefaultAvatar = config.Get("general.default_avatar").(string)
+	configLock.Unlock()
+	configureLoggers()
+	applyConfig()
 
 	PluginDir = config.Get("general.plugin_path").(string)
 	pluginList := config.Get("general.plugins").([]interface{})
@@ -97,4 +133,158 @@ func LoadConfig() {
 	} else {
 		Error.Panicf("database.engine = '%s', only 'leveldb' implemented.\n", DbEngine)
 	}
+
+	loadPermissions(config)
+	loadRPCPluginConfig()
+	Scheduler.start()
+	startMetrics()
+}
+
+// applyConfig applies the settings under [general] which can change on reload.
+func applyConfig() {
+	configLock.Lock()
+	defer configLock.Unlock()
+	DefaultPrefix, _ = config.Get("general.default_prefix").(string)
+	MentionPrefix = true
+	if mentionPrefix, ok := config.Get("general.mention_prefix").(bool); ok {
+		MentionPrefix = mentionPrefix
+	}
+	CommandTimeout = 0
+	if commandTimeout, ok := config.Get("general.command_timeout").(string); ok && commandTimeout != "" {
+		var err error
+		if CommandTimeout, err = time.ParseDuration(commandTimeout); err != nil {
+			Error.Printf("Invalid general.command_timeout '%s': %s\n", commandTimeout, err)
+		}
+	}
+}
+
+// ReloadConfig reads the config file again, applying the changes which don't need a restart (prefix, command timeout,
+// permissions, logging), then calls the handlers subscribed to each section which changed (see OnConfigChange). The
+// sections which changed are returned, along with the problems found validating them against their schemas (see
+// RegisterConfig), which are applied regardless. If the file can't be read, the config in use is left alone.
+func ReloadConfig() (changed []string, invalid []*ConfigError, err error) {
+	tree, err := toml.LoadFile(ConfigFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	configLock.Lock()
+	old := config
+	config = tree
+	configLock.Unlock()
+
+	applyConfig()
+	configureLoggers()
+	reloadPermissions(old, tree)
+
+	changed = changedSections(old, tree)
+	var restart []string
+	for _, key := range restartKeys {
+		if !reflect.DeepEqual(configValue(old, key), configValue(tree, key)) {
+			restart = append(restart, key)
+		}
+	}
+	if len(restart) > 0 {
+		Info.Printf("Changes to %s take effect after a restart.\n", strings.Join(restart, ", "))
+	}
+	Info.Printf("Reloaded config, sections changed: %v\n", changed)
+	for _, section := range changed {
+		if schema := GetConfigSchema(section); schema != nil {
+			if err := schema.Validate(); err != nil {
+				Error.Println(err)
+				invalid = append(invalid, err.(*ConfigError))
+			}
+		}
+		ConfigSubscriptions.notify(section)
+	}
+	return changed, invalid, nil
+}
+
+// configValue returns the value at key in tree, with tables converted to maps so they can be compared.
+func configValue(tree *toml.Tree, key string) interface{} {
+	value := tree.Get(key)
+	if t, ok := value.(*toml.Tree); ok {
+		return t.ToMap()
+	}
+	return value
+}
+
+// changedSections returns the top level sections (Ex: "money") which differ between old and new, sorted.
+func changedSections(old, new *toml.Tree) []string {
+	oldMap, newMap := old.ToMap(), new.ToMap()
+	var changed []string
+	for section, value := range newMap {
+		if !reflect.DeepEqual(oldMap[section], value) {
+			changed = append(changed, section)
+		}
+	}
+	for section := range oldMap {
+		if _, ok := newMap[section]; !ok {
+			changed = append(changed, section)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// ConfigHandler is called with the section of the config file which changed, once the config is reloaded. Values
+// should be read again with the Get*Config functions.
+type ConfigHandler func(section string)
+
+type configSubscription struct {
+	owner   string
+	section string
+	handler ConfigHandler
+}
+
+// configSubscriptionList is a concurrent-safe list of handlers waiting on config changes.
+type configSubscriptionList struct {
+	subscriptions []*configSubscription
+	lock          *sync.RWMutex
+}
+
+// ConfigSubscriptions contains the handlers waiting on config changes, see OnConfigChange.
+var ConfigSubscriptions = &configSubscriptionList{lock: new(sync.RWMutex)}
+
+// OnConfigChange calls handler whenever section (Ex: "money") of the config file changes on reload. owner is the name
+// of the plugin or protocol subscribing, its handlers are removed when it's unloaded.
+func OnConfigChange(owner, section string, handler ConfigHandler) {
+	ConfigSubscriptions.lock.Lock()
+	ConfigSubscriptions.subscriptions = append(ConfigSubscriptions.subscriptions, &configSubscription{owner: owner, section: section, handler: handler})
+	ConfigSubscriptions.lock.Unlock()
+}
+
+// DeleteOwner removes every handler subscribed by owner.
+func (csl *configSubscriptionList) DeleteOwner(owner string) {
+	csl.lock.Lock()
+	subscriptions := make([]*configSubscription, 0, len(csl.subscriptions))
+	for _, sub := range csl.subscriptions {
+		if sub.owner != owner {
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+	csl.subscriptions = subscriptions
+	csl.lock.Unlock()
+}
+
+// notify calls every handler subscribed to section, recovering from any panic so the others still run.
+func (csl *configSubscriptionList) notify(section string) {
+	csl.lock.RLock()
+	var subscriptions []*configSubscription
+	for _, sub := range csl.subscriptions {
+		if sub.section == section {
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+	csl.lock.RUnlock()
+	for _, sub := range subscriptions {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					PanicsRecovered.Inc("config")
+					Error.Printf("Config handler of '%s' panicked: %s\n", sub.owner, string(debug.Stack()))
+				}
+			}()
+			sub.handler(section)
+		}()
+	}
 }
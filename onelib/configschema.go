@@ -0,0 +1,446 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+// ConfigType is the type of a value in the config file, see ConfigKey.
+type ConfigType int
+
+const (
+	// ConfigString is text (Ex: prompt = "Hello").
+	ConfigString ConfigType = iota
+	// ConfigBool is true or false.
+	ConfigBool
+	// ConfigInt is a whole number.
+	ConfigInt
+	// ConfigFloat is a number, which may have a fraction.
+	ConfigFloat
+	// ConfigDuration is a duration as text (Ex: cute_time = "150m"), see time.ParseDuration.
+	ConfigDuration
+	// ConfigList is a list of text (Ex: ["a", "b"]). Text separated by commas is accepted too.
+	ConfigList
+	// ConfigTable is a nested table (Ex: [qa.channels]). A JSON object as text is accepted too.
+	ConfigTable
+	// ConfigTables is an array of tables (Ex: [[bnetdbridge.dest]]). A JSON array of objects as text is accepted too.
+	ConfigTables
+)
+
+// String returns the name of the type, as it's shown in errors.
+func (ct ConfigType) String() string {
+	switch ct {
+	case ConfigString:
+		return "string"
+	case ConfigBool:
+		return "bool"
+	case ConfigInt:
+		return "int"
+	case ConfigFloat:
+		return "float"
+	case ConfigDuration:
+		return "duration"
+	case ConfigList:
+		return "list"
+	case ConfigTable:
+		return "table"
+	case ConfigTables:
+		return "array of tables"
+	}
+	return fmt.Sprintf("type(%d)", int(ct))
+}
+
+// ConfigKey describes a key in a section of the config file.
+type ConfigKey struct {
+	Name        string      // The key (Ex: "cute_time")
+	Type        ConfigType  // The type of value accepted
+	Default     interface{} // Used if the key isn't set, as the Go type returned by its getter (Ex: time.Duration)
+	Required    bool        // If true, the key must be set (ignored if there's a Default)
+	Secret      bool        // If true, the value is never shown (Ex: passwords, API keys)
+	Description string      // What the key is for, shown by the "config" command
+}
+
+// ConfigSchema describes the section of the config file used by a plugin or protocol, see RegisterConfig.
+type ConfigSchema struct {
+	Section string // The name of the section, usually the plugin or protocol's name (Ex: "money")
+	Keys    []*ConfigKey
+}
+
+// key returns the key called name, or nil.
+func (cs *ConfigSchema) key(name string) *ConfigKey {
+	if cs == nil {
+		return nil
+	}
+	for _, key := range cs.Keys {
+		if key.Name == name {
+			return key
+		}
+	}
+	return nil
+}
+
+// Validate checks every value set in the section has the right type, and that required keys are set. Every problem
+// found is returned in one ConfigError.
+func (cs *ConfigSchema) Validate() error {
+	section := Config(cs.Section)
+	var problems []string
+	for _, key := range cs.Keys {
+		raw, ok := section.raw(key.Name)
+		if !ok {
+			if key.Required && key.Default == nil {
+				problems = append(problems, fmt.Sprintf("'%s' is required", key.Name))
+			}
+			continue
+		}
+		if _, err := convertConfig(key.Type, raw); err != nil {
+			if key.Secret {
+				problems = append(problems, fmt.Sprintf("'%s' %s", key.Name, err))
+			} else {
+				problems = append(problems, fmt.Sprintf("'%s' %s, got %#v", key.Name, err, raw))
+			}
+		} else if key.Required && key.Default == nil && raw == "" {
+			problems = append(problems, fmt.Sprintf("'%s' can't be blank", key.Name))
+		}
+	}
+	for _, name := range section.Keys() {
+		if cs.key(name) == nil {
+			Error.Printf("Unknown config key '%s.%s', check for typos.\n", cs.Section, name)
+		}
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Section: cs.Section, Problems: problems}
+	}
+	return nil
+}
+
+// ConfigError is returned when a section of the config file doesn't match its schema.
+type ConfigError struct {
+	Section  string
+	Problems []string
+}
+
+func (ce *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config in [%s]: %s", ce.Section, strings.Join(ce.Problems, "; "))
+}
+
+// configSchemas contains every registered schema, keyed by section.
+var configSchemas = struct {
+	schemas map[string]*ConfigSchema
+	lock    *sync.RWMutex
+}{schemas: make(map[string]*ConfigSchema), lock: new(sync.RWMutex)}
+
+// RegisterConfig registers the schema of a section of the config file, then validates the section. Plugins and
+// protocols should call this first thing in Load, and panic with the error instead of carrying on, LoadPlugin and
+// LoadProtocol return it. The section is validated again whenever the config is reloaded.
+func RegisterConfig(schema *ConfigSchema) error {
+	configSchemas.lock.Lock()
+	configSchemas.schemas[schema.Section] = schema
+	configSchemas.lock.Unlock()
+	return schema.Validate()
+}
+
+// GetConfigSchema returns the schema registered for section, or nil.
+func GetConfigSchema(section string) *ConfigSchema {
+	configSchemas.lock.RLock()
+	defer configSchemas.lock.RUnlock()
+	return configSchemas.schemas[section]
+}
+
+// ConfigSection reads typed values from a section of the config. Values set in the DB take priority over the config
+// file (see SetTextConfig), followed by the default in the section's schema. Getters never panic, a value of the
+// wrong type is logged and the default is used instead.
+type ConfigSection struct {
+	name   string        // The path of the section (Ex: "money", "qa.channels")
+	tree   *toml.Tree    // The values of a nested table, nil if they're read from the config file and DB
+	schema *ConfigSchema // nil if the section has no schema
+}
+
+// Config returns the section of the config called section (Ex: "money").
+func Config(section string) *ConfigSection {
+	return &ConfigSection{name: section, schema: GetConfigSchema(section)}
+}
+
+// raw returns the value set for key, before it's converted.
+func (cs *ConfigSection) raw(key string) (interface{}, bool) {
+	if cs.tree != nil {
+		value := cs.tree.Get(key)
+		return value, value != nil
+	}
+	if Db != nil {
+		if txt, _ := Db.GetString(cs.name, key); txt != "" {
+			return txt, true
+		}
+	}
+	value := configGet(cs.name + "." + key)
+	return value, value != nil
+}
+
+// get returns the value of key converted to typ, falling back on its default, then the zero value of typ.
+func (cs *ConfigSection) get(key string, typ ConfigType) interface{} {
+	if raw, ok := cs.raw(key); ok {
+		value, err := convertConfig(typ, raw)
+		if err == nil {
+			return value
+		}
+		Error.Printf("Config key '%s.%s' %s, using the default.\n", cs.name, key, err)
+	}
+	if k := cs.schema.key(key); k != nil && k.Default != nil {
+		if value, err := convertConfig(typ, k.Default); err == nil {
+			return value
+		}
+	}
+	value, _ := convertConfig(typ, nil)
+	return value
+}
+
+// Has returns true if key is set.
+func (cs *ConfigSection) Has(key string) bool {
+	_, ok := cs.raw(key)
+	return ok
+}
+
+// Keys returns the keys set in the section, sorted. Keys only set in the DB aren't included.
+func (cs *ConfigSection) Keys() []string {
+	tree := cs.tree
+	if tree == nil {
+		tree, _ = configGet(cs.name).(*toml.Tree)
+	}
+	if tree == nil {
+		return nil
+	}
+	keys := tree.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+// String returns the value of key as text.
+func (cs *ConfigSection) String(key string) string {
+	return cs.get(key, ConfigString).(string)
+}
+
+// Bool returns the value of key as a bool.
+func (cs *ConfigSection) Bool(key string) bool {
+	return cs.get(key, ConfigBool).(bool)
+}
+
+// Int returns the value of key as an int.
+func (cs *ConfigSection) Int(key string) int {
+	return cs.get(key, ConfigInt).(int)
+}
+
+// Float returns the value of key as a float64.
+func (cs *ConfigSection) Float(key string) float64 {
+	return cs.get(key, ConfigFloat).(float64)
+}
+
+// Duration returns the value of key as a duration.
+func (cs *ConfigSection) Duration(key string) time.Duration {
+	return cs.get(key, ConfigDuration).(time.Duration)
+}
+
+// List returns the value of key as a list of text.
+func (cs *ConfigSection) List(key string) []string {
+	return cs.get(key, ConfigList).([]string)
+}
+
+// Table returns the nested table at key, which is empty if it isn't set.
+func (cs *ConfigSection) Table(key string) *ConfigSection {
+	return &ConfigSection{name: cs.name + "." + key, tree: cs.get(key, ConfigTable).(*toml.Tree)}
+}
+
+// Tables returns the array of tables at key.
+func (cs *ConfigSection) Tables(key string) []*ConfigSection {
+	trees := cs.get(key, ConfigTables).([]*toml.Tree)
+	sections := make([]*ConfigSection, len(trees))
+	for i, tree := range trees {
+		sections[i] = &ConfigSection{name: fmt.Sprintf("%s.%s[%d]", cs.name, key, i), tree: tree}
+	}
+	return sections
+}
+
+// convertConfig converts value, as read from the config file, the DB, or a default, to the Go type used for typ. If
+// value is nil, the zero value is returned.
+func convertConfig(typ ConfigType, value interface{}) (interface{}, error) {
+	wrongType := fmt.Errorf("should be a %s", typ)
+	if typ == ConfigDuration {
+		wrongType = fmt.Errorf(`should be a duration (ex: "5m")`)
+	}
+	switch typ {
+	case ConfigString:
+		switch v := value.(type) {
+		case nil:
+			return "", nil
+		case string:
+			return v, nil
+		case int64, float64, bool:
+			return fmt.Sprint(v), nil
+		}
+	case ConfigBool:
+		switch v := value.(type) {
+		case nil:
+			return false, nil
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+	case ConfigInt:
+		switch v := value.(type) {
+		case nil:
+			return 0, nil
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case string:
+			if i, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				return i, nil
+			}
+		}
+	case ConfigFloat:
+		switch v := value.(type) {
+		case nil:
+			return 0.0, nil
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f, nil
+			}
+		}
+	case ConfigDuration:
+		switch v := value.(type) {
+		case nil:
+			return time.Duration(0), nil
+		case time.Duration:
+			return v, nil
+		case string:
+			if d, err := time.ParseDuration(strings.TrimSpace(v)); err == nil {
+				return d, nil
+			}
+		}
+	case ConfigList:
+		switch v := value.(type) {
+		case nil:
+			return []string{}, nil
+		case []string:
+			return v, nil
+		case []interface{}:
+			list := make([]string, 0, len(v))
+			for _, item := range v {
+				switch item.(type) {
+				case string, int64, float64, bool:
+					list = append(list, fmt.Sprint(item))
+				default:
+					return nil, wrongType
+				}
+			}
+			return list, nil
+		case string:
+			list := []string{}
+			if strings.HasPrefix(strings.TrimSpace(v), "[") {
+				if err := json.Unmarshal([]byte(v), &list); err != nil {
+					return nil, wrongType
+				}
+				return list, nil
+			}
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			return list, nil
+		}
+	case ConfigTable:
+		switch v := value.(type) {
+		case nil:
+			return toml.TreeFromMap(map[string]interface{}{})
+		case *toml.Tree:
+			return v, nil
+		case map[string]interface{}:
+			return toml.TreeFromMap(v)
+		case string:
+			m := make(map[string]interface{})
+			if err := json.Unmarshal([]byte(v), &m); err != nil {
+				return nil, wrongType
+			}
+			return toml.TreeFromMap(m)
+		}
+	case ConfigTables:
+		switch v := value.(type) {
+		case nil:
+			return []*toml.Tree{}, nil
+		case []*toml.Tree:
+			return v, nil
+		case string:
+			var maps []map[string]interface{}
+			if err := json.Unmarshal([]byte(v), &maps); err != nil {
+				return nil, wrongType
+			}
+			trees := make([]*toml.Tree, len(maps))
+			for i, m := range maps {
+				tree, err := toml.TreeFromMap(m)
+				if err != nil {
+					return nil, wrongType
+				}
+				trees[i] = tree
+			}
+			return trees, nil
+		}
+	}
+	return nil, wrongType
+}
+
+// describeConfigValue returns value, as returned by a getter, as it's shown by the "config" command.
+func describeConfigValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	case *toml.Tree:
+		keys := v.Keys()
+		sort.Strings(keys)
+		return "{" + strings.Join(keys, ", ") + "}"
+	case []*toml.Tree:
+		return fmt.Sprintf("%d tables", len(v))
+	}
+	return fmt.Sprint(value)
+}
+
+// DescribeConfig returns a line for each key in the schema of section, with its type, value, and description. Secret
+// values are hidden.
+func DescribeConfig(section string) (string, error) {
+	schema := GetConfigSchema(section)
+	if schema == nil {
+		return "", fmt.Errorf("no config schema registered for '%s'", section)
+	}
+	cfg := Config(section)
+	lines := make([]string, len(schema.Keys))
+	for i, key := range schema.Keys {
+		value := describeConfigValue(cfg.get(key.Name, key.Type))
+		if key.Secret {
+			value = "(secret, not set)"
+			if raw, ok := cfg.raw(key.Name); ok && raw != "" {
+				value = "(secret, set)"
+			}
+		}
+		lines[i] = fmt.Sprintf("%s (%s) = %s: %s", key.Name, key.Type, value, key.Description)
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+// comparableConfig returns value with tables converted to maps, so they can be compared.
+func comparableConfig(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *toml.Tree:
+		return v.ToMap()
+	case []*toml.Tree:
+		maps := make([]map[string]interface{}, len(v))
+		for i, tree := range v {
+			maps[i] = tree.ToMap()
+		}
+		return maps
+	}
+	return value
+}
+
+func TestConvertConfig(t *testing.T) {
+	tree, err := toml.Load(`[table]
+name = "general"
+[[tables]]
+host = "a"
+[[tables]]
+host = "b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		typ     ConfigType
+		value   interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{"string", ConfigString, "hi", "hi", ""},
+		{"string from int", ConfigString, int64(5), "5", ""},
+		{"string unset", ConfigString, nil, "", ""},
+		{"string from list", ConfigString, []interface{}{"a"}, nil, "should be a string"},
+		{"bool", ConfigBool, true, true, ""},
+		{"bool from text", ConfigBool, "false", false, ""},
+		{"bool from bad text", ConfigBool, "maybe", nil, "should be a bool"},
+		{"int from TOML", ConfigInt, int64(42), 42, ""},
+		{"int from text", ConfigInt, " 42 ", 42, ""},
+		{"int from float", ConfigInt, 4.2, nil, "should be a int"},
+		{"float from int", ConfigFloat, int64(2), 2.0, ""},
+		{"float from text", ConfigFloat, "2.5", 2.5, ""},
+		{"duration", ConfigDuration, "1h30m", 90 * time.Minute, ""},
+		{"duration default", ConfigDuration, time.Minute, time.Minute, ""},
+		{"duration without unit", ConfigDuration, "90", nil, `should be a duration (ex: "5m")`},
+		{"duration from int", ConfigDuration, int64(90), nil, `should be a duration (ex: "5m")`},
+		{"list from TOML", ConfigList, []interface{}{"a", int64(1), true}, []string{"a", "1", "true"}, ""},
+		{"list of tables", ConfigList, []interface{}{tree}, nil, "should be a list"},
+		{"list from JSON", ConfigList, `["a", "b c"]`, []string{"a", "b c"}, ""},
+		{"list from bad JSON", ConfigList, `["a"`, nil, "should be a list"},
+		{"list from commas", ConfigList, "a, b,,c ", []string{"a", "b", "c"}, ""},
+		{"list unset", ConfigList, nil, []string{}, ""},
+		{"table from TOML", ConfigTable, tree.Get("table"), map[string]interface{}{"name": "general"}, ""},
+		{"table from JSON", ConfigTable, `{"name": "general", "on": true}`,
+			map[string]interface{}{"name": "general", "on": true}, ""},
+		{"table from bad JSON", ConfigTable, `["name"]`, nil, "should be a table"},
+		{"table unset", ConfigTable, nil, map[string]interface{}{}, ""},
+		{"table from text", ConfigTable, "general", nil, "should be a table"},
+		{"tables from TOML", ConfigTables, tree.Get("tables"),
+			[]map[string]interface{}{{"host": "a"}, {"host": "b"}}, ""},
+		{"tables from JSON", ConfigTables, `[{"host": "a"}, {"host": "b"}]`,
+			[]map[string]interface{}{{"host": "a"}, {"host": "b"}}, ""},
+		{"tables from a table", ConfigTables, tree.Get("table"), nil, "should be a array of tables"},
+		{"tables unset", ConfigTables, nil, []map[string]interface{}{}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := convertConfig(test.typ, test.value)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("convertConfig() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("convertConfig() error = %v", err)
+			}
+			if got := comparableConfig(got); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("convertConfig() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestConfigSchemaValidate(t *testing.T) {
+	schema := &ConfigSchema{Section: "test", Keys: []*ConfigKey{
+		{Name: "token", Type: ConfigString, Required: true, Secret: true},
+		{Name: "prefix", Type: ConfigString, Required: true, Default: "!"},
+		{Name: "cooldown", Type: ConfigDuration},
+		{Name: "channels", Type: ConfigTable},
+		{Name: "dest", Type: ConfigTables},
+	}}
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"valid", `[test]
+token = "secret"
+cooldown = "5m"
+[test.channels]
+general = "on"
+[[test.dest]]
+host = "a"`, ""},
+		{"JSON table and tables", `[test]
+token = "secret"
+channels = '{"general": "on"}'
+dest = '[{"host": "a"}]'`, ""},
+		{"missing required", `[test]
+cooldown = "5m"`, "invalid config in [test]: 'token' is required"},
+		{"missing section", ``, "invalid config in [test]: 'token' is required"},
+		{"blank required", `[test]
+token = ""`, "invalid config in [test]: 'token' can't be blank"},
+		{"wrong type", `[test]
+token = "secret"
+cooldown = 5`, `invalid config in [test]: 'cooldown' should be a duration (ex: "5m"), got 5`},
+		{"wrong type secret", `[test]
+token = ["secret"]`, "invalid config in [test]: 'token' should be a string"},
+		{"every problem", `[test]
+cooldown = "soon"
+channels = "general"`, `invalid config in [test]: 'token' is required; 'cooldown' should be a duration (ex: "5m"), ` +
+			`got "soon"; 'channels' should be a table, got "general"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, test.config)
+			err := schema.Validate()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("Validate() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigSection(t *testing.T) {
+	openTestDb(t)
+	setTestConfig(t, `[test]
+prefix = "?"
+cooldown = "bad"
+[[test.dest]]
+host = "a"
+port = 6112`)
+	configSchemas.lock.Lock()
+	configSchemas.schemas["test"] = &ConfigSchema{Section: "test", Keys: []*ConfigKey{
+		{Name: "cooldown", Type: ConfigDuration, Default: time.Minute},
+		{Name: "rooms", Type: ConfigList, Default: []string{"general"}},
+	}}
+	configSchemas.lock.Unlock()
+	t.Cleanup(func() {
+		configSchemas.lock.Lock()
+		delete(configSchemas.schemas, "test")
+		configSchemas.lock.Unlock()
+	})
+	SetTextConfig("test", "enabled", "true")
+
+	cfg := Config("test")
+	if prefix := cfg.String("prefix"); prefix != "?" {
+		t.Errorf("String(\"prefix\") = %q, want \"?\"", prefix)
+	}
+	if cooldown := cfg.Duration("cooldown"); cooldown != time.Minute {
+		t.Errorf("Duration(\"cooldown\") = %s, want the default, 1m0s", cooldown)
+	}
+	if rooms := cfg.List("rooms"); !reflect.DeepEqual(rooms, []string{"general"}) {
+		t.Errorf("List(\"rooms\") = %v, want the default", rooms)
+	}
+	if !cfg.Bool("enabled") {
+		t.Error("Bool(\"enabled\") = false, want the value set in the DB")
+	}
+	dest := cfg.Tables("dest")
+	if len(dest) != 1 || dest[0].String("host") != "a" || dest[0].Int("port") != 6112 {
+		t.Errorf("Tables(\"dest\") = %v, want one table with host a and port 6112", dest)
+	}
+	if missing := cfg.Table("missing"); len(missing.Keys()) != 0 {
+		t.Errorf("Table(\"missing\") has keys %v, want none", missing.Keys())
+	}
+}
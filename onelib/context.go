@@ -0,0 +1,108 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CommandTimeout is the longest a command may run for before its context is cancelled, unless the command sets its own
+// Timeout. If 0, commands have no deadline.
+var CommandTimeout time.Duration
+
+var (
+	rootCtx, cancelRoot = context.WithCancel(context.Background())
+	pluginContexts      = newContextMap()
+	protocolContexts    = newContextMap()
+)
+
+// contextMap is a concurrent-safe map of contexts, each cancelled when deleted.
+type contextMap struct {
+	contexts map[string]context.Context
+	cancels  map[string]context.CancelFunc
+	lock     *sync.Mutex
+}
+
+func newContextMap() *contextMap {
+	return &contextMap{contexts: make(map[string]context.Context), cancels: make(map[string]context.CancelFunc), lock: new(sync.Mutex)}
+}
+
+// Get returns the context for name, creating it if it doesn't exist.
+func (cm *contextMap) Get(name string) context.Context {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	ctx := cm.contexts[name]
+	if ctx == nil {
+		ctx, cm.cancels[name] = context.WithCancel(rootCtx)
+		cm.contexts[name] = ctx
+	}
+	return ctx
+}
+
+// Delete cancels the context for name, the next call to Get creates a new one.
+func (cm *contextMap) Delete(name string) {
+	cm.lock.Lock()
+	if cancel := cm.cancels[name]; cancel != nil {
+		cancel()
+	}
+	delete(cm.contexts, name)
+	delete(cm.cancels, name)
+	cm.lock.Unlock()
+}
+
+// DeleteAll cancels every context in the map.
+func (cm *contextMap) DeleteAll() {
+	cm.lock.Lock()
+	for name, cancel := range cm.cancels {
+		cancel()
+		delete(cm.contexts, name)
+		delete(cm.cancels, name)
+	}
+	cm.lock.Unlock()
+}
+
+// PluginContext returns a context which is cancelled when the plugin is unloaded, or OneBot shuts down.
+func PluginContext(name string) context.Context {
+	return pluginContexts.Get(name)
+}
+
+// ProtocolContext returns a context which is cancelled when the protocol is unloaded, or OneBot shuts down.
+func ProtocolContext(name string) context.Context {
+	return protocolContexts.Get(name)
+}
+
+// Shutdown cancels every context handed out by OneBot, stopping any commands still running.
+func Shutdown() {
+	cancelRoot()
+}
+
+// commandContext returns the context a command call runs under. It's cancelled when the plugin providing the command
+// or the protocol it was called from is unloaded, or when the command's deadline passes (see CommandTimeout).
+func commandContext(spec *CommandSpec, sender Sender) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(PluginContext(spec.Plugin))
+	protoCtx := ProtocolContext(sender.Protocol())
+	go func() {
+		select {
+		case <-protoCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	timeout := spec.Timeout
+	if timeout == 0 {
+		configLock.RLock()
+		timeout = CommandTimeout
+		configLock.RUnlock()
+	}
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		return ctx, func() {
+			cancelTimeout()
+			cancel()
+		}
+	}
+	return ctx, cancel
+}
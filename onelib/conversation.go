@@ -0,0 +1,214 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoResponse is returned by Await (and the helpers built on it) when nothing matched before the timeout.
+var ErrNoResponse = errors.New("no response in time")
+
+// Waiter describes the message a conversation is waiting on, see Await. Empty fields match anything.
+type Waiter struct {
+	Protocol  string                                // The protocol the message must come from
+	Location  UUID                                  // The location the message must be sent in
+	Sender    UUID                                  // Who must send the message
+	Reactions bool                                  // If true, reactions being added also match (see Message.Reaction())
+	Match     func(msg Message, sender Sender) bool // Optional, only messages it returns true for match
+}
+
+// matches returns true if msg from sender is what the waiter is waiting on.
+func (w *Waiter) matches(msg Message, sender Sender) bool {
+	if emoji := msg.Reaction(); emoji != nil && (!w.Reactions || !emoji.Added) {
+		return false
+	}
+	if w.Protocol != "" && w.Protocol != sender.Protocol() {
+		return false
+	}
+	if w.Location != "" && (sender.Location() == nil || w.Location != sender.Location().UUID()) {
+		return false
+	}
+	if w.Sender != "" && w.Sender != sender.UUID() {
+		return false
+	}
+	return w.Match == nil || w.Match(msg, sender)
+}
+
+// tryMatch returns true if msg from sender is what the waiter is waiting on. If Match panics, msg doesn't match.
+func (w *Waiter) tryMatch(msg Message, sender Sender) (matched bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			matched = false
+			PanicsRecovered.Inc("conversation")
+			Error.Println("Conversation Match panicked:", string(debug.Stack()))
+		}
+	}()
+	return w.matches(msg, sender)
+}
+
+// Response is a message (or reaction) received by a conversation.
+type Response struct {
+	Message Message
+	Sender  Sender
+}
+
+// waiting is a Waiter registered in Conversations.
+type waiting struct {
+	waiter   *Waiter
+	response chan *Response
+}
+
+// conversationList contains every conversation waiting on a message, safe for concurrent use.
+type conversationList struct {
+	waiting []*waiting
+	lock    *sync.Mutex
+}
+
+// Conversations contains every conversation waiting on a message, see Await.
+var Conversations = &conversationList{lock: new(sync.Mutex)}
+
+// put starts waiting on what w describes.
+func (cl *conversationList) put(w *Waiter) *waiting {
+	wait := &waiting{waiter: w, response: make(chan *Response, 1)}
+	cl.lock.Lock()
+	cl.waiting = append(cl.waiting, wait)
+	cl.lock.Unlock()
+	return wait
+}
+
+// remove stops waiting, returns false if the conversation already got its response.
+func (cl *conversationList) remove(wait *waiting) bool {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+	for i, w := range cl.waiting {
+		if w == wait {
+			cl.waiting = append(cl.waiting[:i], cl.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// intercept hands msg to the first conversation waiting on it, returns true if one took it. Waiters are matched
+// without the lock held, so Match may use Conversations itself.
+func (cl *conversationList) intercept(msg Message, sender Sender) bool {
+	if sender.Self() {
+		return false
+	}
+	cl.lock.Lock()
+	waiting := append([]*waiting(nil), cl.waiting...)
+	cl.lock.Unlock()
+	for _, w := range waiting {
+		// remove fails if the conversation gave up, or took another message, since waiting was copied
+		if w.waiter.tryMatch(msg, sender) && cl.remove(w) {
+			w.response <- &Response{Message: msg, Sender: sender}
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns how many conversations are waiting on a message.
+func (cl *conversationList) Len() int {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+	return len(cl.waiting)
+}
+
+// Await blocks until a message matching w is received, then returns it. The message is intercepted, it's never seen
+// by commands or monitors. If timeout isn't 0 and nothing matches in time, ErrNoResponse is returned, if ctx is
+// cancelled first, its error is returned.
+func Await(ctx context.Context, w *Waiter, timeout time.Duration) (*Response, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	wait := Conversations.put(w)
+	select {
+	case resp := <-wait.response:
+		return resp, nil
+	case <-ctx.Done():
+		if !Conversations.remove(wait) {
+			// Matched while we were giving up
+			return <-wait.response, nil
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrNoResponse
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// AwaitReply blocks until sender's next message in the same location, and returns it (see Await).
+func AwaitReply(ctx context.Context, sender Sender, timeout time.Duration) (Message, error) {
+	w := &Waiter{Protocol: sender.Protocol(), Sender: sender.UUID()}
+	if location := sender.Location(); location != nil {
+		w.Location = location.UUID()
+	}
+	resp, err := Await(ctx, w, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Message, nil
+}
+
+// Prompt sends formatted text to sender's location, then returns their next message there (see AwaitReply).
+func Prompt(ctx context.Context, sender Sender, text, formattedText string, timeout time.Duration) (Message, error) {
+	if _, err := sendPrompt(sender, text, formattedText); err != nil {
+		return nil, err
+	}
+	return AwaitReply(ctx, sender, timeout)
+}
+
+var (
+	confirmYes = map[string]bool{"y": true, "yes": true, "yeah": true, "yep": true, "confirm": true, "👍": true, "✅": true}
+	confirmNo  = map[string]bool{"n": true, "no": true, "nope": true, "cancel": true, "👎": true, "❌": true}
+)
+
+// Confirm sends formatted text to sender's location, then waits on them to answer yes or no, either by saying it, or
+// reacting to the question with 👍 or 👎. Anything else sender says is left alone. If they don't answer in time,
+// ErrNoResponse is returned.
+func Confirm(ctx context.Context, sender Sender, text, formattedText string, timeout time.Duration) (bool, error) {
+	sent, err := sendPrompt(sender, text, formattedText)
+	if err != nil {
+		return false, err
+	}
+	w := &Waiter{Protocol: sender.Protocol(), Sender: sender.UUID(), Reactions: sent != nil && sent.UUID != ""}
+	if location := sender.Location(); location != nil {
+		w.Location = location.UUID()
+	}
+	w.Match = func(msg Message, _ Sender) bool {
+		if emoji := msg.Reaction(); emoji != nil {
+			return msg.UUID() == sent.UUID && (confirmYes[emoji.Name] || confirmNo[emoji.Name])
+		}
+		answer := strings.ToLower(strings.TrimSpace(msg.Text()))
+		return confirmYes[answer] || confirmNo[answer]
+	}
+	resp, err := Await(ctx, w, timeout)
+	if err != nil {
+		return false, err
+	}
+	if emoji := resp.Message.Reaction(); emoji != nil {
+		return confirmYes[emoji.Name], nil
+	}
+	return confirmYes[strings.ToLower(strings.TrimSpace(resp.Message.Text()))], nil
+}
+
+// sendPrompt sends formatted text to sender's location.
+func sendPrompt(sender Sender, text, formattedText string) (*SentMessage, error) {
+	location := sender.Location()
+	if location == nil {
+		return nil, errors.New("sender has no location")
+	}
+	if formattedText == "" {
+		return location.SendText(text)
+	}
+	return location.SendFormattedText(text, formattedText)
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForConversations waits until n conversations are waiting on a message.
+func waitForConversations(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for Conversations.Len() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d conversations waiting, want %d", Conversations.Len(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// awaitResult is what Await returned.
+type awaitResult struct {
+	resp *Response
+	err  error
+}
+
+// startAwait calls Await in a goroutine, returning a channel its result is sent to once it returns.
+func startAwait(ctx context.Context, w *Waiter, timeout time.Duration) chan awaitResult {
+	result := make(chan awaitResult, 1)
+	go func() {
+		resp, err := Await(ctx, w, timeout)
+		result <- awaitResult{resp, err}
+	}()
+	return result
+}
+
+func TestAwait(t *testing.T) {
+	room := &testLocation{uuid: "room"}
+	alice := &testSender{uuid: "alice", protocol: "discord", location: room}
+	bob := &testSender{uuid: "bob", protocol: "discord", location: room}
+	aliceElsewhere := &testSender{uuid: "alice", protocol: "discord", location: &testLocation{uuid: "other"}}
+	aliceMatrix := &testSender{uuid: "alice", protocol: "matrix", location: room}
+	hello := &testMessage{text: "hello"}
+	added := &testMessage{reaction: &Emoji{ID: "1", Name: "👍", Added: true}}
+	removed := &testMessage{reaction: &Emoji{ID: "1", Name: "👍"}}
+
+	tests := []struct {
+		name   string
+		waiter *Waiter
+		msg    Message
+		sender Sender
+		want   bool
+	}{
+		{"anything", &Waiter{}, hello, bob, true},
+		{"sender", &Waiter{Sender: "alice"}, hello, alice, true},
+		{"wrong sender", &Waiter{Sender: "alice"}, hello, bob, false},
+		{"wrong protocol", &Waiter{Protocol: "discord"}, hello, aliceMatrix, false},
+		{"location", &Waiter{Location: "room"}, hello, alice, true},
+		{"wrong location", &Waiter{Location: "room"}, hello, aliceElsewhere, false},
+		{"reaction not wanted", &Waiter{}, added, alice, false},
+		{"reaction", &Waiter{Reactions: true}, added, alice, true},
+		{"reaction removed", &Waiter{Reactions: true}, removed, alice, false},
+		{"match", &Waiter{Match: func(msg Message, _ Sender) bool { return msg.Text() == "hello" }}, hello, alice, true},
+		{"no match", &Waiter{Match: func(msg Message, _ Sender) bool { return msg.Text() == "bye" }}, hello, alice, false},
+		{"match panics", &Waiter{Match: func(Message, Sender) bool { panic("oops") }}, hello, alice, false},
+		{"match uses conversations", &Waiter{Match: func(Message, Sender) bool { return Conversations.Len() == 1 }},
+			hello, alice, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			result := startAwait(ctx, test.waiter, 0)
+			waitForConversations(t, 1)
+			if intercepted := Conversations.intercept(test.msg, test.sender); intercepted != test.want {
+				t.Errorf("intercept() = %t, want %t", intercepted, test.want)
+			}
+			if !test.want {
+				cancel()
+			}
+			r := <-result
+			switch {
+			case test.want && (r.err != nil || r.resp.Message != test.msg || r.resp.Sender != test.sender):
+				t.Errorf("Await() = %v, %v, want the message", r.resp, r.err)
+			case !test.want && !errors.Is(r.err, context.Canceled):
+				t.Errorf("Await() error = %v, want %v", r.err, context.Canceled)
+			}
+			waitForConversations(t, 0)
+		})
+	}
+}
+
+func TestAwaitFirstWaiter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first := startAwait(ctx, &Waiter{}, 0)
+	waitForConversations(t, 1)
+	second := startAwait(ctx, &Waiter{}, 0)
+	waitForConversations(t, 2)
+	alice := &testSender{uuid: "alice", protocol: "discord"}
+	one, two := &testMessage{text: "one"}, &testMessage{text: "two"}
+	Conversations.intercept(one, alice)
+	Conversations.intercept(two, alice)
+	if r := <-first; r.err != nil || r.resp.Message != one {
+		t.Errorf("first Await() = %v, %v, want the first message", r.resp, r.err)
+	}
+	if r := <-second; r.err != nil || r.resp.Message != two {
+		t.Errorf("second Await() = %v, %v, want the second message", r.resp, r.err)
+	}
+}
+
+func TestAwaitTimeout(t *testing.T) {
+	start := time.Now()
+	if _, err := Await(context.Background(), &Waiter{Sender: "nobody"}, 10*time.Millisecond); err != ErrNoResponse {
+		t.Errorf("Await() error = %v, want ErrNoResponse", err)
+	}
+	if took := time.Since(start); took < 10*time.Millisecond {
+		t.Errorf("Await() returned after %s, before the timeout", took)
+	}
+	waitForConversations(t, 0)
+}
+
+// TestAwaitGivingUp checks a message matched while Await gives up is either returned by Await, or left for commands
+// and monitors, never lost.
+func TestAwaitGivingUp(t *testing.T) {
+	alice := &testSender{uuid: "alice", protocol: "discord"}
+	msg := &testMessage{text: "hello"}
+	for i := 0; i < 200; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		result := startAwait(ctx, &Waiter{Match: func(Message, Sender) bool {
+			cancel()
+			return true
+		}}, 0)
+		waitForConversations(t, 1)
+		intercepted := Conversations.intercept(msg, alice)
+		r := <-result
+		if intercepted && (r.err != nil || r.resp.Message != msg) {
+			t.Fatalf("message intercepted, but Await() = %v, %v", r.resp, r.err)
+		}
+		if !intercepted && !errors.Is(r.err, context.Canceled) {
+			t.Fatalf("message not intercepted, but Await() = %v, %v", r.resp, r.err)
+		}
+		waitForConversations(t, 0)
+	}
+}
+
+func TestAwaitReply(t *testing.T) {
+	room := &testLocation{uuid: "room"}
+	alice := &testSender{uuid: "alice", protocol: "discord", location: room}
+	bob := &testSender{uuid: "bob", protocol: "discord", location: room}
+	aliceElsewhere := &testSender{uuid: "alice", protocol: "discord", location: &testLocation{uuid: "other"}}
+	result := make(chan Message, 1)
+	go func() {
+		msg, err := AwaitReply(context.Background(), alice, time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		result <- msg
+	}()
+	waitForConversations(t, 1)
+	if Conversations.intercept(&testMessage{text: "from bob"}, bob) {
+		t.Error("intercepted another sender's message")
+	}
+	if Conversations.intercept(&testMessage{text: "elsewhere"}, aliceElsewhere) {
+		t.Error("intercepted a message in another location")
+	}
+	reply := &testMessage{text: "reply"}
+	if !Conversations.intercept(reply, alice) {
+		t.Error("didn't intercept the reply")
+	}
+	if msg := <-result; msg != reply {
+		t.Errorf("AwaitReply() = %v, want the reply", msg)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	room := &testLocation{uuid: "room", sent: make(chan string, 1)}
+	alice := &testSender{uuid: "alice", protocol: "discord", location: room}
+	result := make(chan Message, 1)
+	go func() {
+		msg, err := Prompt(context.Background(), alice, "Name?", "", time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		result <- msg
+	}()
+	if text := <-room.sent; text != "Name?" {
+		t.Errorf("prompt sent %q, want \"Name?\"", text)
+	}
+	waitForConversations(t, 1)
+	reply := &testMessage{text: "Alice"}
+	Conversations.intercept(reply, alice)
+	if msg := <-result; msg != reply {
+		t.Errorf("Prompt() = %v, want the reply", msg)
+	}
+
+	if _, err := Prompt(context.Background(), &testSender{uuid: "alice", protocol: "discord"}, "Name?", "",
+		time.Second); err == nil {
+		t.Error("Prompt() without a location didn't fail")
+	}
+	if _, err := Prompt(context.Background(), alice, "Name?", "", 10*time.Millisecond); err != ErrNoResponse {
+		t.Errorf("Prompt() error = %v, want ErrNoResponse", err)
+	}
+	<-room.sent
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		name  string
+		msgs  []*testMessage // Sent in order, only the last should be intercepted
+		want  bool
+		ended bool // If false, nothing was intercepted and Confirm times out
+	}{
+		{"yes", []*testMessage{{text: " Yes "}}, true, true},
+		{"no", []*testMessage{{text: "nope"}}, false, true},
+		{"other messages ignored", []*testMessage{{text: "hmm"}, {text: "y"}}, true, true},
+		{"thumbs up", []*testMessage{{uuid: "sent", reaction: &Emoji{ID: "1", Name: "👍", Added: true}}}, true, true},
+		{"thumbs down", []*testMessage{{uuid: "sent", reaction: &Emoji{ID: "2", Name: "👎", Added: true}}}, false, true},
+		{"reaction on another message", []*testMessage{{uuid: "other", reaction: &Emoji{ID: "1", Name: "👍", Added: true}}},
+			false, false},
+		{"reaction removed", []*testMessage{{uuid: "sent", reaction: &Emoji{ID: "1", Name: "👍"}}}, false, false},
+		{"other reaction", []*testMessage{{uuid: "sent", reaction: &Emoji{ID: "3", Name: "🎉", Added: true}}}, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			room := &testLocation{uuid: "room", sent: make(chan string, 1)}
+			alice := &testSender{uuid: "alice", protocol: "discord", location: room}
+			type confirmResult struct {
+				yes bool
+				err error
+			}
+			timeout := time.Second
+			if !test.ended {
+				timeout = 50 * time.Millisecond
+			}
+			result := make(chan confirmResult, 1)
+			go func() {
+				yes, err := Confirm(context.Background(), alice, "Sure?", "", timeout)
+				result <- confirmResult{yes, err}
+			}()
+			<-room.sent
+			waitForConversations(t, 1)
+			for i, msg := range test.msgs {
+				want := test.ended && i == len(test.msgs)-1
+				if intercepted := Conversations.intercept(msg, alice); intercepted != want {
+					t.Errorf("intercept(%v) = %t, want %t", msg, intercepted, want)
+				}
+			}
+			r := <-result
+			switch {
+			case test.ended && (r.err != nil || r.yes != test.want):
+				t.Errorf("Confirm() = %t, %v, want %t", r.yes, r.err, test.want)
+			case !test.ended && r.err != ErrNoResponse:
+				t.Errorf("Confirm() = %t, %v, want ErrNoResponse", r.yes, r.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// rateLimitTable is the DB table holding the state of rate limits, so they survive restarts.
+	rateLimitTable = "onelib_ratelimits"
+)
+
+// RateLimitScope is who shares a rate limit.
+type RateLimitScope int
+
+const (
+	// ScopeUser gives every user their own limit, accounts aliased to the same user (see Alias) share one.
+	ScopeUser RateLimitScope = iota
+	// ScopeLocation gives every location its own limit, shared by everyone in it.
+	ScopeLocation
+	// ScopeGlobal is a single limit shared by everyone, everywhere.
+	ScopeGlobal
+)
+
+// RateLimit limits how often a command can be called, as a token bucket: Burst calls can be made at once, with a
+// call regained every Per. With a Burst of 1 (or 0), it's a cooldown of Per between calls.
+type RateLimit struct {
+	Scope RateLimitScope // Who shares the limit
+	Burst int            // The number of calls which can be made at once
+	Per   time.Duration  // The time it takes to regain one call
+}
+
+// bucket is the state of a rate limit, as stored in the DB.
+type bucket struct {
+	Tokens float64
+	Last   time.Time
+}
+
+var rateLimitLock = new(sync.Mutex)
+
+// key returns the DB key for the limit on command, as it applies to sender.
+func (rl *RateLimit) key(command string, sender Sender) string {
+	switch rl.Scope {
+	case ScopeUser:
+		// Keyed by the UUID alone, as aliases may point to an account on another protocol
+		uuid := sender.UUID()
+		if alias, err := Alias.Get(uuid); err == nil && alias != "" {
+			uuid = alias
+		}
+		return fmt.Sprintf("%s/user/%s", command, uuid)
+	case ScopeLocation:
+		var location UUID
+		if loc := sender.Location(); loc != nil {
+			location = loc.UUID()
+		}
+		return fmt.Sprintf("%s/location/%s/%s", command, sender.Protocol(), location)
+	}
+	return fmt.Sprintf("%s/global", command)
+}
+
+// burst returns the number of calls which can be made at once.
+func (rl *RateLimit) burst() float64 {
+	if rl.Burst < 1 {
+		return 1
+	}
+	return float64(rl.Burst)
+}
+
+// TakeRateLimits uses a call from every limit in limits on command, returning 0 if the call is allowed. If any limit
+// has no calls left, none are used, and the time until the call is allowed is returned.
+func TakeRateLimits(command string, sender Sender, limits []*RateLimit) (wait time.Duration) {
+	if len(limits) == 0 {
+		return 0
+	}
+	now := time.Now()
+	keys := make([]string, len(limits))
+	buckets := make([]*bucket, len(limits))
+
+	rateLimitLock.Lock()
+	defer rateLimitLock.Unlock()
+	for i, rl := range limits {
+		keys[i] = rl.key(command, sender)
+		b := new(bucket)
+		if err := Db.GetObj(rateLimitTable, keys[i], b); err != nil {
+			b = &bucket{Tokens: rl.burst(), Last: now}
+		}
+		if rl.Per > 0 {
+			b.Tokens += float64(now.Sub(b.Last)) / float64(rl.Per)
+		} else {
+			b.Tokens = rl.burst()
+		}
+		if b.Tokens > rl.burst() {
+			b.Tokens = rl.burst()
+		}
+		b.Last = now
+		if b.Tokens < 1 {
+			if w := time.Duration((1 - b.Tokens) * float64(rl.Per)); w > wait {
+				wait = w
+			}
+		}
+		buckets[i] = b
+	}
+	if wait > 0 {
+		return wait
+	}
+	for i, b := range buckets {
+		b.Tokens--
+		if err := Db.PutObj(rateLimitTable, keys[i], b); err != nil {
+			Error.Printf("Failed to save rate limit '%s': %s\n", keys[i], err)
+		}
+	}
+	return 0
+}
+
+// FormatDuration returns d in words, with the two largest units (Ex: "2 hours and 5 minutes").
+func FormatDuration(d time.Duration) string {
+	if d < time.Second {
+		d = time.Second
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{{"day", 24 * time.Hour}, {"hour", time.Hour}, {"minute", time.Minute}, {"second", time.Second}}
+	var parts []string
+	for _, unit := range units {
+		if n := int(d / unit.size); n > 0 {
+			d -= time.Duration(n) * unit.size
+			if n == 1 {
+				parts = append(parts, fmt.Sprintf("1 %s", unit.name))
+			} else {
+				parts = append(parts, fmt.Sprintf("%d %ss", n, unit.name))
+			}
+		} else if len(parts) > 0 {
+			break
+		}
+		if len(parts) == 2 {
+			break
+		}
+	}
+	return strings.Join(parts, " and ")
+}
+
+// FormatWait returns a reply telling a user to wait d before trying again, as text and formatted text.
+func FormatWait(d time.Duration) (text, formattedText string) {
+	wait := FormatDuration(d)
+	return fmt.Sprintf("Slow down! Try again in %s.", wait), fmt.Sprintf("Slow down! Try again in <strong>%s</strong>.", wait)
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"testing"
+	"time"
+)
+
+// testLocation is a Location which drops everything sent to it, or sends the text to sent if it isn't nil.
+type testLocation struct {
+	uuid UUID
+	sent chan string
+}
+
+func (tl *testLocation) DisplayName() string                    { return string(tl.uuid) }
+func (tl *testLocation) Nickname() string                       { return "OneBot" }
+func (tl *testLocation) Topic() string                          { return "" }
+func (tl *testLocation) UUID() UUID                             { return tl.uuid }
+func (tl *testLocation) Protocol() string                       { return "test" }
+func (tl *testLocation) Send(msg Message) (*SentMessage, error) { return tl.SendText(msg.Text()) }
+func (tl *testLocation) SendText(text string) (*SentMessage, error) {
+	return tl.SendFormattedText(text, "")
+}
+func (tl *testLocation) SendFormattedText(text, _ string) (*SentMessage, error) {
+	if tl.sent != nil {
+		tl.sent <- text
+	}
+	return NewSentMessage("sent", tl.uuid, "test"), nil
+}
+
+// testSender is a Sender in a testLocation, or in no location if location is nil.
+type testSender struct {
+	uuid     UUID
+	protocol string
+	location *testLocation
+}
+
+func (ts *testSender) DisplayName() string { return string(ts.uuid) }
+func (ts *testSender) Username() string    { return "" }
+func (ts *testSender) UUID() UUID          { return ts.uuid }
+func (ts *testSender) Protocol() string    { return ts.protocol }
+func (ts *testSender) Self() bool          { return false }
+func (ts *testSender) Location() Location {
+	if ts.location == nil {
+		return nil
+	}
+	return ts.location
+}
+func (ts *testSender) Send(msg Message) (*SentMessage, error) { return ts.SendText(msg.Text()) }
+func (ts *testSender) SendText(text string) (*SentMessage, error) {
+	return ts.SendFormattedText(text, "")
+}
+func (ts *testSender) SendFormattedText(_, _ string) (*SentMessage, error) {
+	return NewSentMessage("sent", ts.uuid, ts.protocol), nil
+}
+
+// openTestDb sets Db to a new LevelDB database, closed once the test ends.
+func openTestDb(t *testing.T) {
+	db := openLevelDB(t.TempDir())
+	Db = db
+	t.Cleanup(func() {
+		db.Close()
+		Db = nil
+	})
+}
+
+func TestTakeRateLimits(t *testing.T) {
+	openTestDb(t)
+	room, otherRoom := &testLocation{uuid: "room"}, &testLocation{uuid: "other"}
+	alice := &testSender{uuid: "alice", protocol: "discord", location: room}
+	aliceMatrix := &testSender{uuid: "@alice:example.org", protocol: "matrix", location: otherRoom}
+	bob := &testSender{uuid: "bob", protocol: "discord", location: room}
+	carol := &testSender{uuid: "carol", protocol: "discord", location: otherRoom}
+	if err := Alias.Set(aliceMatrix.uuid, alice.uuid); err != nil {
+		t.Fatal(err)
+	}
+
+	cooldown := []*RateLimit{{Scope: ScopeUser, Per: time.Hour}}
+	burst := []*RateLimit{{Scope: ScopeUser, Burst: 3, Per: time.Hour}}
+	perLocation := []*RateLimit{{Scope: ScopeLocation, Burst: 2, Per: time.Hour}}
+	global := []*RateLimit{{Scope: ScopeGlobal, Per: time.Hour}}
+	both := []*RateLimit{{Scope: ScopeUser, Burst: 2, Per: time.Hour}, {Scope: ScopeGlobal, Burst: 3, Per: time.Hour}}
+	noPer := []*RateLimit{{Scope: ScopeUser, Per: 0}}
+
+	tests := []struct {
+		name    string
+		command string
+		sender  *testSender
+		limits  []*RateLimit
+		allowed bool
+	}{
+		{"no limits", "free", alice, nil, true},
+		{"no limits again", "free", alice, nil, true},
+		{"cooldown first call", "cute", alice, cooldown, true},
+		{"cooldown second call", "cute", alice, cooldown, false},
+		{"cooldown shared with alias", "cute", aliceMatrix, cooldown, false},
+		{"cooldown is per user", "cute", bob, cooldown, true},
+		{"cooldown is per command", "meme", alice, cooldown, true},
+		{"burst 1", "burst", bob, burst, true},
+		{"burst 2", "burst", bob, burst, true},
+		{"burst 3", "burst", bob, burst, true},
+		{"burst exhausted", "burst", bob, burst, false},
+		{"location 1", "loc", alice, perLocation, true},
+		{"location 2", "loc", bob, perLocation, true},
+		{"location exhausted", "loc", alice, perLocation, false},
+		{"location is per location", "loc", carol, perLocation, true},
+		{"global first call", "global", alice, global, true},
+		{"global shared by everyone", "global", carol, global, false},
+		{"both 1", "both", alice, both, true},
+		{"both 2", "both", alice, both, true},
+		{"both user exhausted", "both", alice, both, false},
+		{"both other user", "both", bob, both, true},
+		{"both global exhausted", "both", carol, both, false},
+		{"no per first call", "noper", alice, noPer, true},
+		{"no per second call", "noper", alice, noPer, true},
+	}
+	for _, test := range tests {
+		wait := TakeRateLimits(test.command, test.sender, test.limits)
+		if allowed := wait == 0; allowed != test.allowed {
+			t.Errorf("%s: TakeRateLimits() = %s, want allowed = %t", test.name, wait, test.allowed)
+		}
+		if wait > time.Hour {
+			t.Errorf("%s: TakeRateLimits() = %s, want at most an hour", test.name, wait)
+		}
+	}
+
+	// A refused call doesn't use calls from the other limits, so carol's own limit is still full.
+	if wait := TakeRateLimits("both", carol, both[:1]); wait != 0 {
+		t.Errorf("refused call used a call from another limit, wait = %s", wait)
+	}
+
+	// Calls are regained over time.
+	key := cooldown[0].key("cute", alice)
+	if err := Db.PutObj(rateLimitTable, key, &bucket{Tokens: 0, Last: time.Now().Add(-30 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if wait := TakeRateLimits("cute", alice, cooldown); wait < 29*time.Minute || wait > 30*time.Minute {
+		t.Errorf("half regained cooldown wait = %s, want about 30m", wait)
+	}
+	if err := Db.PutObj(rateLimitTable, key, &bucket{Tokens: 0, Last: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if wait := TakeRateLimits("cute", alice, cooldown); wait != 0 {
+		t.Errorf("regained cooldown wait = %s, want 0", wait)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "1 second"},
+		{time.Second, "1 second"},
+		{90 * time.Second, "1 minute and 30 seconds"},
+		{2*time.Hour + 5*time.Minute + 3*time.Second, "2 hours and 5 minutes"},
+		{2*time.Hour + 3*time.Second, "2 hours"},
+		{49 * time.Hour, "2 days and 1 hour"},
+	}
+	for _, test := range tests {
+		if got := FormatDuration(test.d); got != test.want {
+			t.Errorf("FormatDuration(%s) = %q, want %q", test.d, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression, see ParseCron.
+type Cron struct {
+	minute, hour, dom, month, dow uint64 // bit n is set if the value n matches
+	domStar, dowStar              bool   // true if the field was "*", see Next
+}
+
+// cronField describes one of the five fields of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names for values starting at min (ex: "jan"), if any
+}
+
+var cronFields = []*cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// ParseCron parses a standard five field cron expression: minute, hour, day of month, month, and day of week (Ex:
+// "0 9 * * mon" is every Monday at 9:00). Fields may be "*", a value, a range ("1-5"), a list ("1,15"), or have a step
+// ("*/15", "0-30/10"). Months and days of the week may be given by name ("jan", "mon"), Sunday is 0 or 7.
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression must have %d fields, got %d", len(cronFields), len(fields))
+	}
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		var err error
+		if bits[i], err = cronFields[i].parse(strings.ToLower(field)); err != nil {
+			return nil, err
+		}
+	}
+	// Sunday can be either 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &Cron{minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domStar: fields[2] == "*", dowStar: fields[4] == "*"}, nil
+}
+
+// parse returns the values matched by a single field.
+func (cf *cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i != -1 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %s field '%s'", cf.name, field)
+			}
+			part = part[:i]
+		}
+		start, end := cf.min, cf.max
+		if part != "*" {
+			i := strings.IndexByte(part, '-')
+			var err error
+			if i == -1 {
+				if start, err = cf.value(part); err != nil {
+					return 0, err
+				}
+				if step == 1 {
+					end = start
+				}
+			} else {
+				if start, err = cf.value(part[:i]); err != nil {
+					return 0, err
+				}
+				if end, err = cf.value(part[i+1:]); err != nil {
+					return 0, err
+				}
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("invalid range in %s field '%s'", cf.name, field)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single value of the field, by number or name.
+func (cf *cronField) value(s string) (int, error) {
+	for i, name := range cf.names {
+		if s == name {
+			return cf.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < cf.min || v > cf.max {
+		return 0, fmt.Errorf("invalid %s '%s', must be between %d and %d", cf.name, s, cf.min, cf.max)
+	}
+	return v, nil
+}
+
+// matchesDay returns true if t's day matches. Like standard cron, if both the day of month and day of week are
+// restricted, a day matching either is enough.
+func (c *Cron) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t matching the expression, in t's location. It returns the zero time if nothing
+// matches within five years (ex: "0 0 30 2 *").
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"* * * * *", ""},
+		{"*/15 9-17 1,15 jan-jun mon-fri", ""},
+		{"0 0 * * 7", ""},
+		{"5/20 * * * *", ""},
+		{"* * * *", "cron expression must have 5 fields, got 4"},
+		{"* * * * * *", "cron expression must have 5 fields, got 6"},
+		{"60 * * * *", "invalid minute '60', must be between 0 and 59"},
+		{"* 24 * * *", "invalid hour '24', must be between 0 and 23"},
+		{"* * 0 * *", "invalid day of month '0', must be between 1 and 31"},
+		{"* * * foo *", "invalid month 'foo', must be between 1 and 12"},
+		{"* * * * 8", "invalid day of week '8', must be between 0 and 7"},
+		{"*/0 * * * *", "invalid step in minute field '*/0'"},
+		{"*/x * * * *", "invalid step in minute field '*/x'"},
+		{"30-10 * * * *", "invalid range in minute field '30-10'"},
+	}
+	for _, test := range tests {
+		_, err := ParseCron(test.expr)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("ParseCron(%q) error = %v", test.expr, err)
+		} else if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+			t.Errorf("ParseCron(%q) error = %v, want %q", test.expr, err, test.wantErr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Monday, 2024-01-15 10:30:45
+	from := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2024, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", from, time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", from, time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * mon", from, time.Date(2024, 1, 22, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * sun", from, time.Date(2024, 1, 21, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", from, time.Date(2024, 1, 21, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", from, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", from, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)},
+		// Both days restricted, either matches: the 20th, or the next Wednesday (the 17th)
+		{"0 0 20 * wed", from, time.Date(2024, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 16 * sat", from, time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * mon-fri", time.Date(2024, 1, 19, 13, 0, 0, 0, time.UTC), time.Date(2024, 1, 22, 12, 0, 0, 0, time.UTC)},
+		{"59 23 31 12 *", from, time.Date(2024, 12, 31, 23, 59, 0, 0, time.UTC)},
+		{"0 0 30 2 *", from, time.Time{}},
+	}
+	for _, test := range tests {
+		cron, err := ParseCron(test.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) error = %v", test.expr, err)
+		}
+		if got := cron.Next(test.from); !got.Equal(test.want) {
+			t.Errorf("ParseCron(%q).Next(%s) = %s, want %s", test.expr, test.from, got, test.want)
+		}
+	}
+}
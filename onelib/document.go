@@ -0,0 +1,494 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// NodeType is the kind of formatting a Node applies to its contents.
+type NodeType int
+
+const (
+	// NodeText is plain text, in Text.
+	NodeText NodeType = iota
+	// NodeGroup is its children with no formatting.
+	NodeGroup
+	// NodeBold is its children in bold.
+	NodeBold
+	// NodeItalic is its children in italics.
+	NodeItalic
+	// NodeCode is inline code, in Text.
+	NodeCode
+	// NodeCodeBlock is a block of code, in Text.
+	NodeCodeBlock
+	// NodeLink is its children linking to URL, or URL itself if it has no children.
+	NodeLink
+	// NodeList is a bulleted list, each child is an item.
+	NodeList
+	// NodeOrderedList is a numbered list, each child is an item.
+	NodeOrderedList
+	// NodeTable is a table of Rows, the first row is the header.
+	NodeTable
+	// NodeSpoiler is its children hidden until revealed.
+	NodeSpoiler
+	// NodeMention is a mention of Mention, rendered by the protocol (see Mentioner).
+	NodeMention
+	// NodeLineBreak starts a new line.
+	NodeLineBreak
+	// NodeColor is its children in Color (Ex: "#C9B037"), only where colors are supported.
+	NodeColor
+)
+
+// Node is a piece of a Document. Nodes are built with the functions named after what they do (Ex: Bold).
+type Node struct {
+	Type     NodeType
+	Text     string    // The text of NodeText, NodeCode, and NodeCodeBlock
+	URL      string    // The URL of NodeLink
+	Color    string    // The color of NodeColor
+	Mention  *Mention  // Who or what NodeMention mentions
+	Rows     [][]*Node // The cells of NodeTable by row, the first row is the header
+	Children []*Node   // The contents of the node
+}
+
+// Text returns a node of plain text.
+func Text(text string) *Node {
+	return &Node{Type: NodeText, Text: text}
+}
+
+// Textf returns a node of plain text, formatted like fmt.Sprintf.
+func Textf(format string, a ...interface{}) *Node {
+	return Text(fmt.Sprintf(format, a...))
+}
+
+// Group returns children with no formatting, useful for a list item or table cell made of several nodes.
+func Group(children ...*Node) *Node {
+	return &Node{Type: NodeGroup, Children: children}
+}
+
+// Bold returns children in bold.
+func Bold(children ...*Node) *Node {
+	return &Node{Type: NodeBold, Children: children}
+}
+
+// Italic returns children in italics.
+func Italic(children ...*Node) *Node {
+	return &Node{Type: NodeItalic, Children: children}
+}
+
+// Code returns text as inline code.
+func Code(text string) *Node {
+	return &Node{Type: NodeCode, Text: text}
+}
+
+// CodeBlock returns text as a block of code.
+func CodeBlock(text string) *Node {
+	return &Node{Type: NodeCodeBlock, Text: text}
+}
+
+// Link returns children linking to url. If there are no children, url is displayed.
+func Link(url string, children ...*Node) *Node {
+	return &Node{Type: NodeLink, URL: url, Children: children}
+}
+
+// List returns a bulleted list of items.
+func List(items ...*Node) *Node {
+	return &Node{Type: NodeList, Children: items}
+}
+
+// OrderedList returns a numbered list of items.
+func OrderedList(items ...*Node) *Node {
+	return &Node{Type: NodeOrderedList, Children: items}
+}
+
+// Table returns a table with a header row, and rows of cells.
+func Table(header []*Node, rows ...[]*Node) *Node {
+	return &Node{Type: NodeTable, Rows: append([][]*Node{header}, rows...)}
+}
+
+// Spoiler returns children hidden until revealed.
+func Spoiler(children ...*Node) *Node {
+	return &Node{Type: NodeSpoiler, Children: children}
+}
+
+// MentionOf returns a mention of who or what was mentioned, rendered by the protocol (see Mentioner).
+func MentionOf(mention *Mention) *Node {
+	return &Node{Type: NodeMention, Mention: mention}
+}
+
+// LineBreak returns a node starting a new line.
+func LineBreak() *Node {
+	return &Node{Type: NodeLineBreak}
+}
+
+// Color returns children in color (Ex: "#C9B037"), only where colors are supported.
+func Color(color string, children ...*Node) *Node {
+	return &Node{Type: NodeColor, Color: color, Children: children}
+}
+
+// Document is rich text built from Nodes once, and rendered by each protocol in the best format it supports. See
+// SendDocument.
+type Document struct {
+	Nodes []*Node
+}
+
+// NewDocument returns a document made of nodes.
+func NewDocument(nodes ...*Node) *Document {
+	return &Document{Nodes: nodes}
+}
+
+// Append adds nodes to the end of the document, returning the document.
+func (doc *Document) Append(nodes ...*Node) *Document {
+	doc.Nodes = append(doc.Nodes, nodes...)
+	return doc
+}
+
+// Span is a range of a document rendered as plain text which links somewhere, or mentions someone. See
+// Document.Spans.
+type Span struct {
+	Start, End int      // The byte offsets of the span in the text
+	URL        string   // The URL linked to, if a link
+	Mention    *Mention // Who or what was mentioned, if a mention
+}
+
+// PlainText returns the document as plain text. Mentions are rendered for location, which can be nil.
+func (doc *Document) PlainText(location Location) string {
+	r := &renderer{format: formatPlain, location: location}
+	r.render(doc.Nodes)
+	return r.text()
+}
+
+// Spans returns the document as plain text (without the URLs of masked links), along with where links and mentions
+// are in it, for protocols which format text by range (Ex: Bluesky's facets). Mentions are rendered for location,
+// which can be nil.
+func (doc *Document) Spans(location Location) (string, []*Span) {
+	r := &renderer{format: formatSpans, location: location}
+	r.render(doc.Nodes)
+	return r.text(), r.spans
+}
+
+// Markdown returns the document as markdown, as Discord renders it. Mentions are rendered for location, which can be
+// nil.
+func (doc *Document) Markdown(location Location) string {
+	r := &renderer{format: formatMarkdown, location: location}
+	r.render(doc.Nodes)
+	return r.text()
+}
+
+// HTML returns the document as HTML, as Matrix renders it. Mentions are rendered for location, which can be nil.
+func (doc *Document) HTML(location Location) string {
+	r := &renderer{format: formatHTML, location: location}
+	r.render(doc.Nodes)
+	return r.text()
+}
+
+// IRC returns the document as text with mIRC formatting codes. Mentions are rendered for location, which can be nil.
+func (doc *Document) IRC(location Location) string {
+	r := &renderer{format: formatIRC, location: location}
+	r.render(doc.Nodes)
+	return r.text()
+}
+
+// DocumentSender can optionally be implemented by a Location which renders documents itself.
+type DocumentSender interface {
+	SendDocument(doc *Document) (*SentMessage, error) // Sends the document, rendered in the best format the protocol supports
+}
+
+// SendDocument sends doc to location, rendered by the protocol if it supports documents (see DocumentSender).
+// Otherwise it's sent as plain text and HTML (see Location.SendFormattedText).
+func SendDocument(location Location, doc *Document) (*SentMessage, error) {
+	if ds, ok := location.(DocumentSender); ok {
+		return ds.SendDocument(doc)
+	}
+	return location.SendFormattedText(doc.PlainText(location), doc.HTML(location))
+}
+
+// docFormat is a format a Document can be rendered in.
+type docFormat int
+
+const (
+	formatPlain docFormat = iota
+	formatSpans           // Plain text, without the URLs of masked links as they're in the spans
+	formatMarkdown
+	formatHTML
+	formatIRC
+)
+
+// mIRC formatting codes.
+const (
+	ircBold      = "\x02"
+	ircItalic    = "\x1D"
+	ircMonospace = "\x11"
+	ircColor     = "\x03"
+)
+
+// markdownSpecial matches characters with meaning in Discord's markdown.
+var markdownSpecial = regexp.MustCompile("[\\\\*_~`|>]")
+
+// markdownURL matches URLs, which are left unescaped so they still link.
+var markdownURL = regexp.MustCompile(`https?://\S+`)
+
+// EscapeMarkdown escapes text so it's displayed as is by Discord. URLs are left as they are, so they still link.
+func EscapeMarkdown(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range markdownURL.FindAllStringIndex(text, -1) {
+		b.WriteString(markdownSpecial.ReplaceAllString(text[last:loc[0]], "\\$0"))
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(markdownSpecial.ReplaceAllString(text[last:], "\\$0"))
+	return b.String()
+}
+
+// renderer renders nodes in a format.
+type renderer struct {
+	strings.Builder
+	format   docFormat
+	location Location
+	spans    []*Span
+}
+
+// text returns what's been rendered, without the line break following a trailing block.
+func (r *renderer) text() string {
+	return strings.TrimSuffix(r.String(), "\n")
+}
+
+func (r *renderer) render(nodes []*Node) {
+	for _, node := range nodes {
+		r.renderNode(node)
+	}
+}
+
+// wrap renders children between open and close.
+func (r *renderer) wrap(open string, children []*Node, close string) {
+	r.WriteString(open)
+	r.render(children)
+	r.WriteString(close)
+}
+
+// startBlock starts a new line if the text so far doesn't end with one, for nodes displayed as blocks.
+func (r *renderer) startBlock() {
+	if s := r.String(); r.format != formatHTML && s != "" && !strings.HasSuffix(s, "\n") {
+		r.WriteString("\n")
+	}
+}
+
+func (r *renderer) renderNode(node *Node) {
+	switch node.Type {
+	case NodeText:
+		switch r.format {
+		case formatMarkdown:
+			r.WriteString(EscapeMarkdown(node.Text))
+		case formatHTML:
+			r.WriteString(strings.ReplaceAll(html.EscapeString(node.Text), "\n", "<br />\n"))
+		default:
+			r.WriteString(node.Text)
+		}
+	case NodeGroup:
+		r.render(node.Children)
+	case NodeBold:
+		switch r.format {
+		case formatMarkdown:
+			r.wrap("**", node.Children, "**")
+		case formatHTML:
+			r.wrap("<strong>", node.Children, "</strong>")
+		case formatIRC:
+			r.wrap(ircBold, node.Children, ircBold)
+		default:
+			r.render(node.Children)
+		}
+	case NodeItalic:
+		switch r.format {
+		case formatMarkdown:
+			r.wrap("*", node.Children, "*")
+		case formatHTML:
+			r.wrap("<em>", node.Children, "</em>")
+		case formatIRC:
+			r.wrap(ircItalic, node.Children, ircItalic)
+		default:
+			r.render(node.Children)
+		}
+	case NodeCode:
+		switch r.format {
+		case formatMarkdown:
+			fence := "`"
+			if strings.Contains(node.Text, "`") {
+				fence = "``"
+			}
+			r.WriteString(fence + node.Text + fence)
+		case formatHTML:
+			r.WriteString("<code>" + html.EscapeString(node.Text) + "</code>")
+		case formatIRC:
+			r.WriteString(ircMonospace + node.Text + ircMonospace)
+		default:
+			r.WriteString(node.Text)
+		}
+	case NodeCodeBlock:
+		r.startBlock()
+		switch r.format {
+		case formatMarkdown:
+			r.WriteString("```\n" + strings.TrimSuffix(node.Text, "\n") + "\n```\n")
+		case formatHTML:
+			r.WriteString("<pre><code>" + html.EscapeString(node.Text) + "</code></pre>")
+		default:
+			r.WriteString(strings.TrimSuffix(node.Text, "\n") + "\n")
+		}
+	case NodeLink:
+		r.renderLink(node)
+	case NodeList, NodeOrderedList:
+		r.renderList(node)
+	case NodeTable:
+		r.renderTable(node)
+	case NodeSpoiler:
+		switch r.format {
+		case formatMarkdown:
+			r.wrap("||", node.Children, "||")
+		case formatHTML:
+			r.wrap("<span data-mx-spoiler>", node.Children, "</span>")
+		case formatIRC:
+			r.wrap(ircColor+"01,01", node.Children, ircColor) // black on black
+		default:
+			r.render(node.Children)
+		}
+	case NodeMention:
+		if node.Mention == nil {
+			return
+		}
+		text, formattedText := MentionText(r.location, node.Mention)
+		if r.format == formatHTML {
+			r.WriteString(formattedText)
+			return
+		}
+		start := r.Len()
+		r.WriteString(text)
+		r.spans = append(r.spans, &Span{Start: start, End: r.Len(), Mention: node.Mention})
+	case NodeLineBreak:
+		if r.format == formatHTML {
+			r.WriteString("<br />\n")
+		} else {
+			r.WriteString("\n")
+		}
+	case NodeColor:
+		if r.format == formatHTML {
+			r.wrap(`<font color="`+html.EscapeString(node.Color)+`">`, node.Children, "</font>")
+		} else {
+			r.render(node.Children)
+		}
+	}
+}
+
+func (r *renderer) renderLink(node *Node) {
+	label := &renderer{format: formatPlain}
+	label.render(node.Children)
+	masked := label.Len() > 0 && label.String() != node.URL
+	switch {
+	case r.format == formatHTML:
+		r.WriteString(`<a href="` + html.EscapeString(node.URL) + `">`)
+		if masked {
+			r.render(node.Children)
+		} else {
+			r.WriteString(html.EscapeString(node.URL))
+		}
+		r.WriteString("</a>")
+	case r.format == formatMarkdown && masked:
+		r.wrap("[", node.Children, "]("+node.URL+")")
+	case masked:
+		start := r.Len()
+		r.render(node.Children)
+		r.spans = append(r.spans, &Span{Start: start, End: r.Len(), URL: node.URL})
+		if r.format != formatSpans {
+			r.WriteString(" (" + node.URL + ")")
+		}
+	default:
+		start := r.Len()
+		r.WriteString(node.URL)
+		r.spans = append(r.spans, &Span{Start: start, End: r.Len(), URL: node.URL})
+	}
+}
+
+func (r *renderer) renderList(node *Node) {
+	if r.format == formatHTML {
+		tag := "ul"
+		if node.Type == NodeOrderedList {
+			tag = "ol"
+		}
+		r.WriteString("<" + tag + ">")
+		for _, item := range node.Children {
+			r.wrap("<li>", []*Node{item}, "</li>")
+		}
+		r.WriteString("</" + tag + ">")
+		return
+	}
+	r.startBlock()
+	for i, item := range node.Children {
+		if node.Type == NodeOrderedList {
+			r.WriteString(strconv.Itoa(i+1) + ". ")
+		} else {
+			r.WriteString("- ")
+		}
+		r.renderNode(item)
+		r.WriteString("\n")
+	}
+}
+
+func (r *renderer) renderTable(node *Node) {
+	if len(node.Rows) == 0 {
+		return
+	}
+	if r.format == formatHTML {
+		r.WriteString("<table>")
+		for i, row := range node.Rows {
+			cell := "td"
+			if i == 0 {
+				cell = "th"
+			}
+			r.WriteString("<tr>")
+			for _, c := range row {
+				r.wrap("<"+cell+">", []*Node{c}, "</"+cell+">")
+			}
+			r.WriteString("</tr>")
+		}
+		r.WriteString("</table>")
+		return
+	}
+
+	// Everything else gets columns of plain text lined up with spaces
+	cells := make([][]string, len(node.Rows))
+	var widths []int
+	for i, row := range node.Rows {
+		cells[i] = make([]string, len(row))
+		for j, c := range row {
+			cr := &renderer{format: formatPlain, location: r.location}
+			cr.renderNode(c)
+			cells[i][j] = strings.ReplaceAll(cr.String(), "\n", " ")
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := utf8.RuneCountInString(cells[i][j]); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+	var table strings.Builder
+	for _, row := range cells {
+		for j, c := range row {
+			table.WriteString(c)
+			if j < len(row)-1 {
+				table.WriteString(strings.Repeat(" ", widths[j]-utf8.RuneCountInString(c)+2))
+			}
+		}
+		table.WriteString("\n")
+	}
+	r.startBlock()
+	if r.format == formatMarkdown {
+		r.WriteString("```\n" + table.String() + "```\n")
+	} else {
+		r.WriteString(table.String())
+	}
+}
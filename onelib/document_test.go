@@ -0,0 +1,83 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDocumentRender(t *testing.T) {
+	tests := []struct {
+		name                       string
+		doc                        *Document
+		plain, markdown, html, irc string
+	}{
+		{"empty", NewDocument(), "", "", "", ""},
+		{"escaping", NewDocument(Text("a*b_c <d> & `e`")),
+			"a*b_c <d> & `e`", "a\\*b\\_c <d\\> & \\`e\\`", "a*b_c &lt;d&gt; &amp; `e`", "a*b_c <d> & `e`"},
+		{"urls aren't escaped", NewDocument(Text("see https://x.org/a_b*c now_")),
+			"see https://x.org/a_b*c now_", "see https://x.org/a_b*c now\\_", "see https://x.org/a_b*c now_",
+			"see https://x.org/a_b*c now_"},
+		{"line breaks", NewDocument(Text("a\nb"), LineBreak(), Text("c")),
+			"a\nb\nc", "a\nb\nc", "a<br />\nb<br />\nc", "a\nb\nc"},
+		{"bold and italic", NewDocument(Bold(Text("hi")), Text(" "), Italic(Text("there"))),
+			"hi there", "**hi** *there*", "<strong>hi</strong> <em>there</em>", "\x02hi\x02 \x1dthere\x1d"},
+		{"code", NewDocument(Code("x`y"), Text(" "), Code("<z>")),
+			"x`y <z>", "``x`y`` `<z>`", "<code>x`y</code> <code>&lt;z&gt;</code>", "\x11x`y\x11 \x11<z>\x11"},
+		{"code block", NewDocument(Text("before"), CodeBlock("a < b\n"), Text("after")),
+			"before\na < b\nafter", "before\n```\na < b\n```\nafter", "before<pre><code>a &lt; b\n</code></pre>after",
+			"before\na < b\nafter"},
+		{"links", NewDocument(Link("https://x.org", Text("site")), Text(" "), Link("https://y.org")),
+			"site (https://x.org) https://y.org", "[site](https://x.org) https://y.org",
+			`<a href="https://x.org">site</a> <a href="https://y.org">https://y.org</a>`,
+			"site (https://x.org) https://y.org"},
+		{"lists", NewDocument(Text("items:"), List(Text("one"), Bold(Text("two"))), OrderedList(Text("a"), Text("b"))),
+			"items:\n- one\n- two\n1. a\n2. b", "items:\n- one\n- **two**\n1. a\n2. b",
+			"items:<ul><li>one</li><li><strong>two</strong></li></ul><ol><li>a</li><li>b</li></ol>",
+			"items:\n- one\n- \x02two\x02\n1. a\n2. b"},
+		{"table", NewDocument(Table([]*Node{Text("name"), Text("n")}, []*Node{Text("ab"), Text("1")},
+			[]*Node{Text("c"), Bold(Text("22"))})),
+			"name  n\nab    1\nc     22", "```\nname  n\nab    1\nc     22\n```",
+			"<table><tr><th>name</th><th>n</th></tr><tr><td>ab</td><td>1</td></tr><tr><td>c</td><td><strong>22</strong></td></tr></table>",
+			"name  n\nab    1\nc     22"},
+		{"spoiler and color", NewDocument(Spoiler(Text("s")), LineBreak(), Color("#fff", Text("c"))),
+			"s\nc", "||s||\nc", "<span data-mx-spoiler>s</span><br />\n<font color=\"#fff\">c</font>", "\x0301,01s\x03\nc"},
+		{"mention", NewDocument(Text("hi "), MentionOf(&Mention{Type: MentionUser, UUID: "1", DisplayName: "Al"}), Text("!")),
+			"hi @Al!", "hi @Al!", "hi @Al!", "hi @Al!"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.doc.PlainText(nil); got != test.plain {
+				t.Errorf("PlainText() = %q, want %q", got, test.plain)
+			}
+			if got := test.doc.Markdown(nil); got != test.markdown {
+				t.Errorf("Markdown() = %q, want %q", got, test.markdown)
+			}
+			if got := test.doc.HTML(nil); got != test.html {
+				t.Errorf("HTML() = %q, want %q", got, test.html)
+			}
+			if got := test.doc.IRC(nil); got != test.irc {
+				t.Errorf("IRC() = %q, want %q", got, test.irc)
+			}
+		})
+	}
+}
+
+func TestDocumentSpans(t *testing.T) {
+	mention := &Mention{Type: MentionUser, UUID: "1", DisplayName: "Al"}
+	doc := NewDocument(Text("hi "), MentionOf(mention), Text(", see "), Link("https://x.org", Text("site")), Text(" or "),
+		Link("https://y.org"))
+	text, spans := doc.Spans(nil)
+	if want := "hi @Al, see site or https://y.org"; text != want {
+		t.Errorf("Spans() text = %q, want %q", text, want)
+	}
+	want := []*Span{
+		{Start: 3, End: 6, Mention: mention},
+		{Start: 12, End: 16, URL: "https://x.org"},
+		{Start: 20, End: 33, URL: "https://y.org"},
+	}
+	if !reflect.DeepEqual(spans, want) {
+		t.Errorf("Spans() spans = %+v, want %+v", spans, want)
+	}
+}
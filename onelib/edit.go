@@ -0,0 +1,135 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import "fmt"
+
+// Editor can optionally be implemented by a Location where the bot can edit messages it sent.
+type Editor interface {
+	Edit(messageID UUID, text, formattedText string) error // Replaces the text of the message
+}
+
+// Deleter can optionally be implemented by a Location where the bot can delete messages it sent.
+type Deleter interface {
+	Delete(messageID UUID) error // Deletes the message
+}
+
+// ProtocolEditor can optionally be implemented by a Protocol which can edit messages the bot sent, by location.
+type ProtocolEditor interface {
+	Edit(location, messageID UUID, text, formattedText string) error // Replaces the text of the message in location
+}
+
+// ProtocolDeleter can optionally be implemented by a Protocol which can delete messages the bot sent, by location.
+type ProtocolDeleter interface {
+	Delete(location, messageID UUID) error // Deletes the message in location
+}
+
+// Capability is an optional feature a location may support, see Supports.
+type Capability int
+
+const (
+	// CapReply is replying to messages, see Replier.
+	CapReply Capability = iota
+	// CapReact is reacting to messages, see Reactor.
+	CapReact
+	// CapAttachments is sending files, see AttachmentSender.
+	CapAttachments
+	// CapMentions is rendering mentions natively, see Mentioner.
+	CapMentions
+	// CapEdit is editing messages the bot sent, see Editor.
+	CapEdit
+	// CapDelete is deleting messages the bot sent, see Deleter.
+	CapDelete
+)
+
+// Supports returns true if location supports capability. Without it, helpers like Edit return ErrNotSupported, or fall
+// back to something simpler (Ex: Reply sends the text normally).
+func Supports(location Location, capability Capability) bool {
+	var ok bool
+	switch capability {
+	case CapReply:
+		_, ok = location.(Replier)
+	case CapReact:
+		_, ok = location.(Reactor)
+	case CapAttachments:
+		_, ok = location.(AttachmentSender)
+	case CapMentions:
+		_, ok = location.(Mentioner)
+	case CapEdit:
+		_, ok = location.(Editor)
+	case CapDelete:
+		_, ok = location.(Deleter)
+	}
+	return ok
+}
+
+// Edit replaces the text of the message with messageID in location, if the location supports editing (see Editor).
+// Otherwise ErrNotSupported is returned.
+func Edit(location Location, messageID UUID, text, formattedText string) error {
+	if editor, ok := location.(Editor); ok {
+		return editor.Edit(messageID, text, formattedText)
+	}
+	return ErrNotSupported
+}
+
+// Delete deletes the message with messageID in location, if the location supports deleting (see Deleter). Otherwise
+// ErrNotSupported is returned.
+func Delete(location Location, messageID UUID) error {
+	if deleter, ok := location.(Deleter); ok {
+		return deleter.Delete(messageID)
+	}
+	return ErrNotSupported
+}
+
+// Update edits the message sent to location to have the new text, if the location supports editing and sent has a
+// UUID. Otherwise the text is sent as a new message. The handle to the message with the new text is returned, useful
+// for progress updates (Ex: "Downloading... 50%").
+func Update(location Location, sent *SentMessage, text, formattedText string) (*SentMessage, error) {
+	if sent != nil && sent.UUID != "" && len(sent.Parts) == 0 {
+		if err := Edit(location, sent.UUID, text, formattedText); err == nil {
+			return sent, nil
+		} else if err != ErrNotSupported {
+			Debug.Printf("Couldn't edit message '%s', sending a new one: %s\n", sent.UUID, err)
+		}
+	}
+	if formattedText == "" {
+		return location.SendText(text)
+	}
+	return location.SendFormattedText(text, formattedText)
+}
+
+// EditSent replaces the text of a message the bot sent, if its protocol supports editing (see ProtocolEditor).
+// Otherwise ErrNotSupported is returned.
+func EditSent(sent *SentMessage, text, formattedText string) error {
+	proto := Protocols.Get(sent.Protocol)
+	if proto == nil {
+		return fmt.Errorf("protocol '%s' not loaded", sent.Protocol)
+	}
+	if editor, ok := proto.(ProtocolEditor); ok {
+		return editor.Edit(sent.Location, sent.UUID, text, formattedText)
+	}
+	return ErrNotSupported
+}
+
+// DeleteSent deletes a message the bot sent, every part of it if the protocol split it up, if its protocol supports
+// deleting (see ProtocolDeleter). Otherwise ErrNotSupported is returned.
+func DeleteSent(sent *SentMessage) error {
+	proto := Protocols.Get(sent.Protocol)
+	if proto == nil {
+		return fmt.Errorf("protocol '%s' not loaded", sent.Protocol)
+	}
+	deleter, ok := proto.(ProtocolDeleter)
+	if !ok {
+		return ErrNotSupported
+	}
+	parts := sent.Parts
+	if len(parts) == 0 {
+		parts = []UUID{sent.UUID}
+	}
+	for _, part := range parts {
+		if err := deleter.Delete(sent.Location, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
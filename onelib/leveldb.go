@@ -31,14 +31,14 @@ func (db *levelDB) Get(table, key string) (map[string]interface{}, error) {
 // Retrieve a string stored with PutString.
 func (db *levelDB) GetString(table, key string) (string, error) {
 	data, err := db.dB.Get([]byte(fmt.Sprintf("%s.%s", table, key)), nil)
-	return string(data), err
+	return string(data), db.count("get", err)
 }
 
 // Retrieve an integer stored with PutInt.
 func (db *levelDB) GetInt(table, key string) (int, error) {
 	data, err := db.dB.Get([]byte(fmt.Sprintf("%s.%s", table, key)), nil)
 	if err != nil {
-		return 0, err
+		return 0, db.count("get", err)
 	}
 	var i int
 	i, err = strconv.Atoi(string(data))
@@ -49,10 +49,10 @@ func (db *levelDB) GetInt(table, key string) (int, error) {
 func (db *levelDB) GetObj(table, key string, obj interface{}) error {
 	data, err := db.dB.Get([]byte(fmt.Sprintf("%s.%s", table, key)), nil)
 	if err != nil {
-		return err
+		return db.count("get", err)
 	}
 	err = bson.Unmarshal(data, obj)
-	return err
+	return db.count("decode", err)
 }
 
 // Searches for key in field, containing key (IE: field:'username', key:'admin'), using an index if exists. Can be very
@@ -71,26 +71,26 @@ func (db *levelDB) Put(table string, data map[string]interface{}) ([]byte, error
 
 // Inserts text at location "key" for retrieval via GetString
 func (db *levelDB) PutString(table, key, text string) error {
-	return db.dB.Put([]byte(fmt.Sprintf("%s.%s", table, key)), []byte(text), nil)
+	return db.count("put", db.dB.Put([]byte(fmt.Sprintf("%s.%s", table, key)), []byte(text), nil))
 }
 
 // Inserts an integer at location "key" for retrieval via GetInt
 func (db *levelDB) PutInt(table, key string, i int) error {
-	return db.dB.Put([]byte(fmt.Sprintf("%s.%s", table, key)), []byte(strconv.Itoa(i)), nil)
+	return db.count("put", db.dB.Put([]byte(fmt.Sprintf("%s.%s", table, key)), []byte(strconv.Itoa(i)), nil))
 }
 
 // Inserts an object at location "key" for retrieval via GetObj
 func (db *levelDB) PutObj(table, key string, obj interface{}) error {
 	data, err := bson.Marshal(obj)
 	if err != nil {
-		return err
+		return db.count("encode", err)
 	}
-	return db.dB.Put([]byte(fmt.Sprintf("%s.%s", table, key)), data, nil)
+	return db.count("put", db.dB.Put([]byte(fmt.Sprintf("%s.%s", table, key)), data, nil))
 }
 
 // Removes an object at location "key"
 func (db *levelDB) Remove(table, key string) error {
-	return db.dB.Delete([]byte(fmt.Sprintf("%s.%s", table, key)), nil)
+	return db.count("remove", db.dB.Delete([]byte(fmt.Sprintf("%s.%s", table, key)), nil))
 }
 
 // SetIndex sets an index on field. Building an index can take a long time. On LevelDB Index *must* be unique, or will
@@ -99,6 +99,14 @@ func (db *levelDB) SetIndex(table, field string) error {
 	return errors.New("SetIndex not implemented on LevelDB.")
 }
 
+// count counts err in DbErrors under op, unless it's nil or a key which wasn't found, then returns it.
+func (db *levelDB) count(op string, err error) error {
+	if err != nil && err != leveldb.ErrNotFound {
+		DbErrors.Inc(op)
+	}
+	return err
+}
+
 // Terminate a database session (only run if nothing is using the database).
 func (db *levelDB) Close() error {
 	return db.dB.Close()
@@ -3,44 +3,464 @@
 package onelib
 
 import (
+	"encoding/json"
+	"fmt"
+	"github.com/pelletier/go-toml"
 	"io"
-	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Level is how important a log line is, lines below the level set for their logger are dropped (see SetLogLevel).
+type Level int
+
 const (
-	// DEBUG is a relic constant, it will be removed in favour of something else in the future.
-	DEBUG = 1
+	// LevelDebug is for miscellaneous things, mostly for debugging code.
+	LevelDebug Level = iota
+	// LevelInfo is for information about what OneBot is doing.
+	LevelInfo
+	// LevelError is for errors.
+	LevelError
 )
 
-type logger struct {
-	*log.Logger
+// String returns the name of the level, as it's set in the config.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel returns the level named s ("debug", "info", or "error").
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level '%s', expected debug, info, or error", s)
 }
 
 var (
 	// Error is used for logging errors. It outputs to stderr and file.
-	Error *logger
+	Error = newLogger(LevelError, "", "")
 	// Info is used for logging information. It outputs to stdout and file.
-	Info *logger
-	// Debug is used for logging miscellaneous things, mostly for debugging code. It outputs to stdout.
-	Debug *logger
+	Info = newLogger(LevelInfo, "", "")
+	// Debug is used for logging miscellaneous things, mostly for debugging code. It outputs to stdout and file.
+	Debug = newLogger(LevelDebug, "", "")
 )
 
-// InitLoggers is supposed to only be called once, it initializes the loggers, opening any related logfiles.
+// Log is a set of loggers whose lines are tagged with the name of the plugin or protocol using them, and follow the
+// level set for it (see SetLogLevel). Plugins and protocols should log with one instead of Error, Info, and Debug.
+type Log struct {
+	Error *Logger
+	Info  *Logger
+	Debug *Logger
+}
+
+// NewLog returns loggers for the plugin called name, whose lines are tagged plugin=name.
+func NewLog(name string) *Log {
+	return newLog("plugin", name)
+}
+
+// NewProtocolLog returns loggers for the protocol called name, whose lines are tagged protocol=name.
+func NewProtocolLog(name string) *Log {
+	return newLog("protocol", name)
+}
+
+func newLog(key, name string) *Log {
+	return &Log{Error: newLogger(LevelError, key, name), Info: newLogger(LevelInfo, key, name),
+		Debug: newLogger(LevelDebug, key, name)}
+}
+
+// Logger writes lines at one level, tagged with fields, see With.
+type Logger struct {
+	level  Level
+	name   string   // The plugin or protocol logging, empty for OneBot itself
+	fields []string // Extra fields as key, value pairs
+}
+
+// newLogger returns a logger for the plugin or protocol called name, tagging its lines key=name. name is empty for
+// OneBot itself.
+func newLogger(level Level, key, name string) *Logger {
+	l := &Logger{level: level, name: name}
+	if name != "" {
+		l.fields = []string{key, name}
+	}
+	return l
+}
+
+// With returns a copy of the logger, whose lines are tagged with key=value as well (Ex: With("location", uuid)).
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make([]string, len(l.fields), len(l.fields)+2)
+	copy(fields, l.fields)
+	return &Logger{level: l.level, name: l.name, fields: append(fields, key, fmt.Sprint(value))}
+}
+
+// Enabled returns true if lines written by the logger are kept, see SetLogLevel.
+func (l *Logger) Enabled() bool {
+	return l.level >= LogLevel(l.name)
+}
+
+// Print logs its arguments, formatted like fmt.Sprint.
+func (l *Logger) Print(v ...interface{}) {
+	l.output(fmt.Sprint(v...))
+}
+
+// Printf logs its arguments, formatted like fmt.Sprintf.
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.output(fmt.Sprintf(format, v...))
+}
+
+// Println logs its arguments, formatted like fmt.Sprintln.
+func (l *Logger) Println(v ...interface{}) {
+	l.output(fmt.Sprintln(v...))
+}
+
+// Panicf logs its arguments like Printf, then panics.
+func (l *Logger) Panicf(format string, v ...interface{}) {
+	s := fmt.Sprintf(format, v...)
+	l.write(s, true)
+	panic(s)
+}
+
+// Panicln logs its arguments like Println, then panics.
+func (l *Logger) Panicln(v ...interface{}) {
+	s := fmt.Sprintln(v...)
+	l.write(s, true)
+	panic(s)
+}
+
+// output writes msg if the logger is enabled.
+func (l *Logger) output(msg string) {
+	if l.Enabled() {
+		l.write(msg, false)
+	}
+}
+
+// write formats msg as a line and writes it to the console and log file. force writes it even if the logger is
+// disabled.
+func (l *Logger) write(msg string, force bool) {
+	msg = strings.TrimSuffix(msg, "\n")
+	now := time.Now()
+	caller := ""
+	if l.level == LevelError {
+		// write <- output <- Print* <- caller, or write <- Panic* <- caller
+		depth := 3
+		if force {
+			depth = 2
+		}
+		if _, file, line, ok := runtime.Caller(depth); ok {
+			caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+		}
+	}
+
+	logOutput.lock.Lock()
+	defer logOutput.lock.Unlock()
+	var line string
+	if logOutput.json {
+		entry := make(map[string]string, 4+len(l.fields)/2)
+		for i := 0; i+1 < len(l.fields); i += 2 {
+			entry[l.fields[i]] = l.fields[i+1]
+		}
+		entry["time"] = now.Format(time.RFC3339)
+		entry["level"] = l.level.String()
+		entry["msg"] = msg
+		if caller != "" {
+			entry["caller"] = caller
+		}
+		data, _ := json.Marshal(entry)
+		line = string(data) + "\n"
+	} else {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%-8s%s ", "["+l.level.String()+"]", now.Format("2006/01/02 15:04:05"))
+		if caller != "" {
+			b.WriteString(caller + ": ")
+		}
+		b.WriteString(msg)
+		for i := 0; i+1 < len(l.fields); i += 2 {
+			fmt.Fprintf(&b, " %s=%s", l.fields[i], quoteField(l.fields[i+1]))
+		}
+		line = b.String() + "\n"
+	}
+	if l.level == LevelError {
+		io.WriteString(os.Stderr, line)
+	} else {
+		io.WriteString(os.Stdout, line)
+	}
+	if logOutput.file != nil {
+		logOutput.file.Write([]byte(line))
+	}
+}
+
+// quoteField quotes a field's value for text logs, if it has spaces or quotes in it.
+func quoteField(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		return fmt.Sprintf("%q", value)
+	}
+	return value
+}
+
+// logOutput is where log lines go, besides the console.
+var logOutput = struct {
+	file *rotatingFile
+	json bool
+	lock *sync.Mutex
+}{lock: new(sync.Mutex)}
+
+// logLevels contains the level set for each plugin or protocol, the key "" is the default level.
+var logLevels = struct {
+	levels     map[string]Level
+	fromConfig map[string]bool // The levels last set by the config, reset on reload if they're removed from it
+	lock       *sync.RWMutex
+}{levels: map[string]Level{"": LevelDebug}, fromConfig: make(map[string]bool), lock: new(sync.RWMutex)}
+
+// LogLevel returns the lowest level logged for the plugin or protocol called name, or the default level if name is
+// empty or has no level of its own.
+func LogLevel(name string) Level {
+	logLevels.lock.RLock()
+	defer logLevels.lock.RUnlock()
+	if level, ok := logLevels.levels[name]; ok {
+		return level
+	}
+	return logLevels.levels[""]
+}
+
+// SetLogLevel sets the lowest level logged for the plugin or protocol called name, or the default level if name is
+// empty. Takes effect immediately.
+func SetLogLevel(name string, level Level) {
+	logLevels.lock.Lock()
+	logLevels.levels[name] = level
+	logLevels.lock.Unlock()
+}
+
+// ResetLogLevel makes the plugin or protocol called name use the default level again.
+func ResetLogLevel(name string) {
+	if name == "" {
+		return
+	}
+	logLevels.lock.Lock()
+	delete(logLevels.levels, name)
+	logLevels.lock.Unlock()
+}
+
+// LogLevels returns a copy of the levels set, the key "" is the default level.
+func LogLevels() map[string]Level {
+	logLevels.lock.RLock()
+	defer logLevels.lock.RUnlock()
+	levels := make(map[string]Level, len(logLevels.levels))
+	for name, level := range logLevels.levels {
+		levels[name] = level
+	}
+	return levels
+}
+
+// InitLoggers is supposed to only be called once, it opens logfile for the loggers to write to, until the config is
+// loaded (see configureLoggers).
 func InitLoggers(logfile string) {
-	var (
-		file *os.File
-		err  error
-	)
+	file, err := openRotatingFile(logfile, 0, 0, 0)
+	if err != nil {
+		Error.Panicln("Failed to open log file:", err)
+	}
+	logOutput.lock.Lock()
+	logOutput.file = file
+	logOutput.lock.Unlock()
+}
+
+// configureLoggers applies the [log] section of the config, reopening the log file if its settings changed. Levels
+// which were set by the config before, but have since been removed from it, go back to their defaults.
+func configureLoggers() {
+	fromConfig := make(map[string]bool)
+	if level, ok := configGet("log.level").(string); ok && level != "" {
+		if l, err := ParseLevel(level); err != nil {
+			Error.Printf("Invalid log.level: %s\n", err)
+		} else {
+			SetLogLevel("", l)
+			fromConfig[""] = true
+		}
+	}
+	if levels, ok := configGet("log.levels").(*toml.Tree); ok {
+		for name, level := range levels.ToMap() {
+			s, _ := level.(string)
+			if l, err := ParseLevel(s); err != nil {
+				Error.Printf("Invalid log.levels.%s: %s\n", name, err)
+			} else {
+				SetLogLevel(name, l)
+				fromConfig[name] = true
+			}
+		}
+	}
+	logLevels.lock.Lock()
+	for name := range logLevels.fromConfig {
+		if fromConfig[name] {
+			continue
+		}
+		if name == "" {
+			logLevels.levels[""] = LevelDebug
+		} else {
+			delete(logLevels.levels, name)
+		}
+	}
+	logLevels.fromConfig = fromConfig
+	logLevels.lock.Unlock()
+	format, _ := configGet("log.format").(string)
+	if format != "" && format != "text" && format != "json" {
+		Error.Printf("Invalid log.format '%s', expected text or json.\n", format)
+	}
+
+	path, _ := configGet("log.file").(string)
+	maxSize, _ := configGet("log.max_size").(int64)
+	maxBackups, _ := configGet("log.max_backups").(int64)
+	var rotateEvery time.Duration
+	if every, ok := configGet("log.rotate_every").(string); ok && every != "" {
+		var err error
+		if rotateEvery, err = time.ParseDuration(every); err != nil {
+			Error.Printf("Invalid log.rotate_every '%s': %s\n", every, err)
+		}
+	}
+
+	logOutput.lock.Lock()
+	defer logOutput.lock.Unlock()
+	logOutput.json = format == "json"
+	if path == "" && logOutput.file != nil {
+		path = logOutput.file.path
+	}
+	if path == "" {
+		return
+	}
+	if current := logOutput.file; current != nil && current.path == path && current.maxSize == maxSize*1024*1024 &&
+		current.every == rotateEvery && current.maxBackups == int(maxBackups) {
+		return
+	}
+	file, err := openRotatingFile(path, maxSize*1024*1024, rotateEvery, int(maxBackups))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open log file '%s': %s\n", path, err)
+		return
+	}
+	if logOutput.file != nil {
+		logOutput.file.Close()
+	}
+	logOutput.file = file
+}
+
+// rotatingFile is a log file which is moved aside (Ex: "onebot.log.2022-01-02T15-04-05.000") once it grows too large,
+// or a new period starts. Safe for concurrent use.
+type rotatingFile struct {
+	path       string
+	maxSize    int64         // Rotate once the file is this many bytes, never if 0
+	every      time.Duration // Rotate when a new period of this length starts, never if 0
+	maxBackups int           // Rotated files to keep, all if 0
+	file       *os.File
+	size       int64
+	period     time.Time // The start of the period the file was last written in
+	lock       *sync.Mutex
+}
 
-	file, err = os.OpenFile(logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+func openRotatingFile(path string, maxSize int64, every time.Duration, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, every: every, maxBackups: maxBackups, lock: new(sync.Mutex)}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open opens the file for appending, picking up its size and when it was last written to.
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
-		log.Fatalln("Failed to open log file:", err)
+		return err
 	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file = file
+	rf.size = info.Size()
+	rf.period = rf.periodOf(info.ModTime())
+	if info.Size() == 0 {
+		rf.period = rf.periodOf(time.Now())
+	}
+	return nil
+}
+
+// periodOf returns the start of the period t is in.
+func (rf *rotatingFile) periodOf(t time.Time) time.Time {
+	if rf.every <= 0 {
+		return time.Time{}
+	}
+	return t.Truncate(rf.every)
+}
+
+// Write writes p to the file, rotating it first if needed.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+	period := rf.periodOf(time.Now())
+	if rf.size > 0 && ((rf.maxSize > 0 && rf.size+int64(len(p)) > rf.maxSize) || period.After(rf.period)) {
+		if err := rf.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate log file '%s': %s\n", rf.path, err)
+		}
+	}
+	rf.period = period
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate moves the file aside, opens a new one, and removes the oldest rotated files past maxBackups.
+func (rf *rotatingFile) rotate() error {
+	rf.file.Close()
+	rf.file = nil
+	backup := rf.path + "." + time.Now().Format("2006-01-02T15-04-05.000")
+	if err := os.Rename(rf.path, backup); err != nil {
+		if openErr := rf.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	if rf.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups) // Oldest first, the suffix is a timestamp
+	for len(backups) > rf.maxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
 
-	Error = &logger{log.New(io.MultiWriter(file, os.Stderr), "[error] ", log.Ldate|log.Ltime|log.Lshortfile)}
-	Info = &logger{log.New(io.MultiWriter(file, os.Stdout), "[info]  ", log.Ldate|log.Ltime)}
-	if DEBUG > 0 {
-		Debug = &logger{log.New(os.Stdout, "[debug] ", log.Ltime)}
+// Close closes the file, later writes fail.
+func (rf *rotatingFile) Close() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	if rf.file == nil {
+		return nil
 	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
 }
@@ -0,0 +1,124 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+)
+
+// setTestConfig sets the config to the TOML in data, restoring the config in use once the test ends.
+func setTestConfig(t *testing.T, data string) {
+	tree, err := toml.Load(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLock.Lock()
+	old := config
+	config = tree
+	configLock.Unlock()
+	t.Cleanup(func() {
+		configLock.Lock()
+		config = old
+		configLock.Unlock()
+	})
+}
+
+func TestConfigureLoggers(t *testing.T) {
+	logOutput.lock.Lock()
+	oldFile := logOutput.file
+	logOutput.lock.Unlock()
+	t.Cleanup(func() {
+		logOutput.lock.Lock()
+		if logOutput.file != nil && logOutput.file != oldFile {
+			logOutput.file.Close()
+		}
+		logOutput.file, logOutput.json = oldFile, false
+		logOutput.lock.Unlock()
+		logLevels.lock.Lock()
+		logLevels.levels, logLevels.fromConfig = map[string]Level{"": LevelDebug}, make(map[string]bool)
+		logLevels.lock.Unlock()
+	})
+	logFile := filepath.Join(t.TempDir(), "onebot.log")
+	otherFile := filepath.Join(t.TempDir(), "other.log")
+
+	tests := []struct {
+		name       string
+		config     string
+		set        map[string]Level // Set with SetLogLevel before the config is applied
+		wantLevels map[string]Level
+		reopened   bool
+	}{
+		{"levels set", `[log]
+level = "info"
+file = "` + logFile + `"
+[log.levels]
+discord = "error"
+qa = "debug"`, nil, map[string]Level{"": LevelInfo, "discord": LevelError, "qa": LevelDebug}, true},
+		{"unchanged file kept open", `[log]
+level = "info"
+file = "` + logFile + `"
+[log.levels]
+discord = "error"
+qa = "debug"`, nil, map[string]Level{"": LevelInfo, "discord": LevelError, "qa": LevelDebug}, false},
+		{"removed level reset", `[log]
+level = "info"
+file = "` + logFile + `"
+[log.levels]
+discord = "error"`, nil, map[string]Level{"": LevelInfo, "discord": LevelError}, false},
+		{"level set by command kept", `[log]
+level = "info"
+file = "` + logFile + `"`, map[string]Level{"matrix": LevelError}, map[string]Level{"": LevelInfo, "matrix": LevelError}, false},
+		{"default level reset", `[log]
+file = "` + logFile + `"`, nil, map[string]Level{"": LevelDebug, "matrix": LevelError}, false},
+		{"rotation changed", `[log]
+file = "` + logFile + `"
+max_size = 1`, nil, map[string]Level{"": LevelDebug, "matrix": LevelError}, true},
+		{"file changed", `[log]
+file = "` + otherFile + `"
+max_size = 1`, nil, map[string]Level{"": LevelDebug, "matrix": LevelError}, true},
+	}
+	for _, test := range tests {
+		for name, level := range test.set {
+			SetLogLevel(name, level)
+		}
+		setTestConfig(t, test.config)
+		logOutput.lock.Lock()
+		before := logOutput.file
+		logOutput.lock.Unlock()
+		configureLoggers()
+		if levels := LogLevels(); !reflect.DeepEqual(levels, test.wantLevels) {
+			t.Errorf("%s: LogLevels() = %v, want %v", test.name, levels, test.wantLevels)
+		}
+		logOutput.lock.Lock()
+		after := logOutput.file
+		logOutput.lock.Unlock()
+		if reopened := after != before; reopened != test.reopened {
+			t.Errorf("%s: log file reopened = %t, want %t", test.name, reopened, test.reopened)
+		}
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	tests := []struct {
+		log  *Log
+		want []string
+	}{
+		{NewLog("qa"), []string{"plugin", "qa"}},
+		{NewProtocolLog("discord"), []string{"protocol", "discord"}},
+	}
+	for _, test := range tests {
+		for _, l := range []*Logger{test.log.Error, test.log.Info, test.log.Debug} {
+			if !reflect.DeepEqual(l.fields, test.want) {
+				t.Errorf("fields = %v, want %v", l.fields, test.want)
+			}
+		}
+	}
+	if fields := NewProtocolLog("discord").Info.With("location", "room").fields; !reflect.DeepEqual(fields,
+		[]string{"protocol", "discord", "location", "room"}) {
+		t.Errorf("With() fields = %v", fields)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+// MentionType is the kind of thing a Mention refers to.
+type MentionType int
+
+const (
+	// MentionUser is a mention of a user (Ex: "<@123>" on Discord).
+	MentionUser MentionType = iota
+	// MentionRole is a mention of a role (Ex: "<@&123>" on Discord).
+	MentionRole
+	// MentionLocation is a mention of a location (Ex: "<#123>" on Discord).
+	MentionLocation
+)
+
+// Mention is a reference to a user, role, or location in a message.
+type Mention struct {
+	Type        MentionType // What was mentioned
+	UUID        UUID        // The UUID of who or what was mentioned
+	DisplayName string      // The name the mention is displayed as, if known
+}
+
+// MentionMessage can optionally be implemented by a Message which can tell who or what it mentions.
+type MentionMessage interface {
+	Mentions() []*Mention // The users, roles, and locations mentioned in the message, in the order they appear if known
+}
+
+// Mentioner can optionally be implemented by a Location which can render mentions the way its protocol does natively.
+type Mentioner interface {
+	Mention(mention *Mention) (text, formattedText string) // Returns the text and formatted text mentioning who or what was mentioned
+}
+
+// Mentions returns who or what msg mentions, if the protocol supports it (see MentionMessage).
+func Mentions(msg Message) []*Mention {
+	if mm, ok := UnwrapMessage(msg).(MentionMessage); ok {
+		return mm.Mentions()
+	}
+	return nil
+}
+
+// MentionText returns the text and formatted text mentioning who or what was mentioned, as rendered in location (see
+// Mentioner). If the protocol can't render mentions, "@" followed by the mention's display name (or UUID) is returned.
+func MentionText(location Location, mention *Mention) (text, formattedText string) {
+	if mentioner, ok := location.(Mentioner); ok {
+		return mentioner.Mention(mention)
+	}
+	name := mention.DisplayName
+	if name == "" {
+		name = string(mention.UUID)
+	}
+	return "@" + name, "@" + name
+}
+
+// MentionSender returns the text and formatted text mentioning sender in their location (see MentionText).
+func MentionSender(sender Sender) (text, formattedText string) {
+	return MentionText(sender.Location(), &Mention{Type: MentionUser, UUID: sender.UUID(), DisplayName: sender.DisplayName()})
+}
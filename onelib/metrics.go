@@ -0,0 +1,375 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram buckets used if none are given, in seconds, suited to timing commands and sends.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics contains every registered metric, which is served in the Prometheus text format on metrics.listen.
+var Metrics = &MetricRegistry{metrics: make(map[string]metric), lock: new(sync.RWMutex)}
+
+var (
+	// MessagesReceived counts messages received, by protocol.
+	MessagesReceived = Metrics.NewCounter("onebot_messages_received_total", "Messages received.", "protocol")
+	// MessagesSent counts messages sent through an Outbox, by protocol.
+	MessagesSent = Metrics.NewCounter("onebot_messages_sent_total", "Messages sent.", "protocol")
+	// SendFailures counts messages which failed to send after every retry, by protocol.
+	SendFailures = Metrics.NewCounter("onebot_send_failures_total", "Messages which failed to send.", "protocol")
+	// CommandCalls counts command calls which passed every middleware, by plugin and command.
+	CommandCalls = Metrics.NewCounter("onebot_command_calls_total", "Commands called.", "plugin", "command")
+	// CommandDuration times command calls, by plugin and command.
+	CommandDuration = Metrics.NewHistogram("onebot_command_duration_seconds", "How long commands ran for.", nil, "plugin", "command")
+	// PanicsRecovered counts panics recovered, by what panicked ("command", "middleware", "monitor", "conversation",
+	// "job", or "config").
+	PanicsRecovered = Metrics.NewCounter("onebot_panics_recovered_total", "Panics recovered.", "source")
+	// DbErrors counts database errors, not including keys which weren't found, by operation.
+	DbErrors = Metrics.NewCounter("onebot_db_errors_total", "Database errors.", "op")
+)
+
+func init() {
+	Metrics.NewGaugeFunc("onebot_goroutines", "Goroutines running.", func() float64 { return float64(runtime.NumGoroutine()) })
+	Metrics.NewGaugeFunc("onebot_conversations_waiting", "Conversations waiting on a message.", func() float64 { return float64(Conversations.Len()) })
+}
+
+// metric is a counter, gauge, or histogram in a MetricRegistry.
+type metric interface {
+	write(w io.Writer)
+}
+
+// MetricRegistry is a concurrent-safe set of metrics, keyed by name.
+type MetricRegistry struct {
+	metrics map[string]metric
+	lock    *sync.RWMutex
+}
+
+// register adds m under name, unless there's already a metric with that name, which is returned instead. This lets
+// plugins register their metrics again when they're reloaded.
+func (mr *MetricRegistry) register(name string, m metric) metric {
+	mr.lock.Lock()
+	defer mr.lock.Unlock()
+	if existing := mr.metrics[name]; existing != nil {
+		return existing
+	}
+	mr.metrics[name] = m
+	return m
+}
+
+// NewCounter registers a counter, a value which only goes up (Ex: messages received). labels are the names of the
+// labels values are split by (Ex: "protocol"). If name is already registered as a counter, it's returned instead.
+func (mr *MetricRegistry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: newFamily(name, help, "counter", labels)}
+	counter, ok := mr.register(name, c).(*Counter)
+	if !ok {
+		Error.Printf("Metric '%s' is already registered as another type.\n", name)
+		return c
+	}
+	return counter
+}
+
+// NewGauge registers a gauge, a value which can go up and down (Ex: rooms joined). labels are the names of the labels
+// values are split by. If name is already registered as a gauge, it's returned instead.
+func (mr *MetricRegistry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{family: newFamily(name, help, "gauge", labels)}
+	gauge, ok := mr.register(name, g).(*Gauge)
+	if !ok {
+		Error.Printf("Metric '%s' is already registered as another type.\n", name)
+		return g
+	}
+	return gauge
+}
+
+// NewGaugeFunc registers a gauge without labels, whose value is read from fn every time the metrics are served.
+func (mr *MetricRegistry) NewGaugeFunc(name, help string, fn func() float64) {
+	mr.register(name, &gaugeFunc{name: name, help: help, fn: fn})
+}
+
+// NewHistogram registers a histogram, which counts observed values into buckets (Ex: how long commands take). buckets
+// are the upper bounds of each bucket in ascending order, DefaultBuckets is used if nil. labels are the names of the
+// labels values are split by. If name is already registered as a histogram, it's returned instead.
+func (mr *MetricRegistry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{family: newFamily(name, help, "histogram", labels), buckets: buckets}
+	histogram, ok := mr.register(name, h).(*Histogram)
+	if !ok {
+		Error.Printf("Metric '%s' is already registered as another type.\n", name)
+		return h
+	}
+	return histogram
+}
+
+// Write writes every metric in the Prometheus text format, sorted by name.
+func (mr *MetricRegistry) Write(w io.Writer) {
+	mr.lock.RLock()
+	names := make([]string, 0, len(mr.metrics))
+	for name := range mr.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		metrics[i] = mr.metrics[name]
+	}
+	mr.lock.RUnlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// series is the value of a metric for one set of label values.
+type series struct {
+	labels  string   // The label values, formatted (Ex: `protocol="discord"`)
+	value   float64  // The value of a counter or gauge, or the sum of a histogram
+	count   uint64   // The number of values observed by a histogram
+	buckets []uint64 // The number of values observed by a histogram in each bucket
+}
+
+// family contains the values of a metric, by label values.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	series map[string]*series
+	lock   *sync.Mutex
+}
+
+func newFamily(name, help, kind string, labels []string) family {
+	return family{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series), lock: new(sync.Mutex)}
+}
+
+// get returns the series for labelValues, creating it if needed. The lock must be held. nil is returned if the wrong
+// number of label values are given.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		Error.Printf("Metric '%s' takes %d labels, got %d.\n", f.name, len(f.labels), len(labelValues))
+		return nil
+	}
+	key := strings.Join(labelValues, "\xff")
+	s := f.series[key]
+	if s == nil {
+		pairs := make([]string, len(f.labels))
+		for i, label := range f.labels {
+			pairs[i] = fmt.Sprintf("%s=\"%s\"", label, escapeLabel(labelValues[i]))
+		}
+		s = &series{labels: strings.Join(pairs, ",")}
+		f.series[key] = s
+	}
+	return s
+}
+
+// add adds n to the series for labelValues.
+func (f *family) add(n float64, labelValues []string) {
+	f.lock.Lock()
+	if s := f.get(labelValues); s != nil {
+		s.value += n
+	}
+	f.lock.Unlock()
+}
+
+// sorted returns copies of every series, sorted by label values.
+func (f *family) sorted() []series {
+	f.lock.Lock()
+	all := make([]series, 0, len(f.series))
+	for _, s := range f.series {
+		c := *s
+		c.buckets = append([]uint64(nil), s.buckets...)
+		all = append(all, c)
+	}
+	f.lock.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].labels < all[j].labels })
+	return all
+}
+
+// writeHeader writes the HELP and TYPE lines of the metric.
+func (f *family) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+}
+
+// write writes the metric, if it's a counter or gauge.
+func (f *family) write(w io.Writer) {
+	f.writeHeader(w)
+	for _, s := range f.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, braces(s.labels), formatFloat(s.value))
+	}
+}
+
+// Counter is a metric which only goes up, see MetricRegistry.NewCounter.
+type Counter struct {
+	family
+}
+
+// Inc adds 1 to the counter for labelValues, given in the order the labels were registered.
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// Add adds n to the counter for labelValues. n must not be negative.
+func (c *Counter) Add(n float64, labelValues ...string) {
+	if n < 0 {
+		Error.Printf("Counter '%s' can't go down.\n", c.name)
+		return
+	}
+	c.add(n, labelValues)
+}
+
+// Gauge is a metric which can go up and down, see MetricRegistry.NewGauge.
+type Gauge struct {
+	family
+}
+
+// Set sets the gauge for labelValues to n.
+func (g *Gauge) Set(n float64, labelValues ...string) {
+	g.lock.Lock()
+	if s := g.get(labelValues); s != nil {
+		s.value = n
+	}
+	g.lock.Unlock()
+}
+
+// Inc adds 1 to the gauge for labelValues.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.add(1, labelValues)
+}
+
+// Dec subtracts 1 from the gauge for labelValues.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.add(-1, labelValues)
+}
+
+// Add adds n to the gauge for labelValues, n can be negative.
+func (g *Gauge) Add(n float64, labelValues ...string) {
+	g.add(n, labelValues)
+}
+
+// gaugeFunc is a gauge read from a function, see MetricRegistry.NewGaugeFunc.
+type gaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (gf *gaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", gf.name, escapeHelp(gf.help), gf.name, gf.name, formatFloat(gf.fn()))
+}
+
+// Histogram is a metric counting observed values into buckets, see MetricRegistry.NewHistogram.
+type Histogram struct {
+	family
+	buckets []float64
+}
+
+// Observe counts v into the histogram for labelValues.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s := h.get(labelValues)
+	if s == nil {
+		return
+	}
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.buckets))
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.value += v
+	s.count++
+}
+
+// ObserveDuration counts d into the histogram for labelValues, in seconds.
+func (h *Histogram) ObserveDuration(d time.Duration, labelValues ...string) {
+	h.Observe(d.Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		sep := ""
+		if s.labels != "" {
+			sep = ","
+		}
+		for i, upper := range h.buckets {
+			var n uint64
+			if s.buckets != nil {
+				n = s.buckets[i]
+			}
+			fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", h.name, s.labels, sep, formatFloat(upper), n)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", h.name, s.labels, sep, s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, braces(s.labels), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, braces(s.labels), s.count)
+	}
+}
+
+// braces returns labels wrapped in braces, or nothing if there are no labels.
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+// formatFloat formats f the way Prometheus expects.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+// serveMetrics serves every metric in the Prometheus text format.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	Metrics.Write(w)
+}
+
+// startMetrics starts serving metrics on /metrics at the address in metrics.listen, if it's set.
+func startMetrics() {
+	listen, _ := configGet("metrics.listen").(string)
+	if listen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", serveMetrics)
+	go func() {
+		Info.Printf("Serving metrics on http://%s/metrics\n", listen)
+		if err := http.ListenAndServe(listen, mux); err != nil {
+			Error.Printf("Metrics listener on '%s' stopped: %s\n", listen, err)
+		}
+	}()
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestRegistry() *MetricRegistry {
+	return &MetricRegistry{metrics: make(map[string]metric), lock: new(sync.RWMutex)}
+}
+
+func TestMetricsWrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(mr *MetricRegistry)
+		want  string
+	}{
+		{"empty", func(mr *MetricRegistry) {}, ""},
+		{"counter without labels", func(mr *MetricRegistry) {
+			c := mr.NewCounter("calls_total", "Calls.")
+			c.Inc()
+			c.Add(2.5)
+			c.Add(-1) // Refused, counters can't go down
+		}, "# HELP calls_total Calls.\n# TYPE calls_total counter\ncalls_total 3.5\n"},
+		{"counter with labels", func(mr *MetricRegistry) {
+			c := mr.NewCounter("sent_total", "Sent.", "protocol")
+			c.Inc("matrix")
+			c.Inc("discord")
+			c.Inc("discord")
+			c.Inc("discord", "extra") // Refused, wrong number of labels
+		}, "# HELP sent_total Sent.\n# TYPE sent_total counter\n" +
+			"sent_total{protocol=\"discord\"} 2\nsent_total{protocol=\"matrix\"} 1\n"},
+		{"counter registered twice", func(mr *MetricRegistry) {
+			mr.NewCounter("calls_total", "Calls.").Inc()
+			mr.NewCounter("calls_total", "Calls.").Inc()
+		}, "# HELP calls_total Calls.\n# TYPE calls_total counter\ncalls_total 2\n"},
+		{"gauge", func(mr *MetricRegistry) {
+			g := mr.NewGauge("rooms", "Rooms joined.", "protocol", "account")
+			g.Set(5, "irc", "bot")
+			g.Inc("irc", "bot")
+			g.Dec("matrix", "bot")
+			g.Add(-0.5, "matrix", "bot")
+		}, "# HELP rooms Rooms joined.\n# TYPE rooms gauge\n" +
+			"rooms{protocol=\"irc\",account=\"bot\"} 6\nrooms{protocol=\"matrix\",account=\"bot\"} -1.5\n"},
+		{"gauge func", func(mr *MetricRegistry) {
+			mr.NewGaugeFunc("answer", "The answer.", func() float64 { return 42 })
+		}, "# HELP answer The answer.\n# TYPE answer gauge\nanswer 42\n"},
+		{"histogram without labels", func(mr *MetricRegistry) {
+			h := mr.NewHistogram("took_seconds", "Time taken.", []float64{0.1, 1})
+			h.Observe(0.05)
+			h.Observe(0.5)
+			h.Observe(3)
+		}, "# HELP took_seconds Time taken.\n# TYPE took_seconds histogram\n" +
+			"took_seconds_bucket{le=\"0.1\"} 1\ntook_seconds_bucket{le=\"1\"} 2\ntook_seconds_bucket{le=\"+Inf\"} 3\n" +
+			"took_seconds_sum 3.55\ntook_seconds_count 3\n"},
+		{"histogram with labels", func(mr *MetricRegistry) {
+			h := mr.NewHistogram("took_seconds", "Time taken.", []float64{1}, "command")
+			h.Observe(1, "roll")
+		}, "# HELP took_seconds Time taken.\n# TYPE took_seconds histogram\n" +
+			"took_seconds_bucket{command=\"roll\",le=\"1\"} 1\ntook_seconds_bucket{command=\"roll\",le=\"+Inf\"} 1\n" +
+			"took_seconds_sum{command=\"roll\"} 1\ntook_seconds_count{command=\"roll\"} 1\n"},
+		{"sorted by name", func(mr *MetricRegistry) {
+			mr.NewGaugeFunc("b", "B.", func() float64 { return 2 })
+			mr.NewGaugeFunc("a", "A.", func() float64 { return 1 })
+		}, "# HELP a A.\n# TYPE a gauge\na 1\n# HELP b B.\n# TYPE b gauge\nb 2\n"},
+		{"escaping", func(mr *MetricRegistry) {
+			mr.NewCounter("escaped_total", "Back\\slash\nnew \"line\".", "value").Inc("a\"b\\c\nd")
+		}, "# HELP escaped_total Back\\\\slash\\nnew \"line\".\n# TYPE escaped_total counter\n" +
+			"escaped_total{value=\"a\\\"b\\\\c\\nd\"} 1\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mr := newTestRegistry()
+			test.setup(mr)
+			var b strings.Builder
+			mr.Write(&b)
+			if got := b.String(); got != test.want {
+				t.Errorf("Write() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMetricsWrongType(t *testing.T) {
+	mr := newTestRegistry()
+	mr.NewCounter("calls_total", "Calls.").Inc()
+	mr.NewGauge("calls_total", "Calls.").Set(10) // Not registered, the counter is kept
+	var b strings.Builder
+	mr.Write(&b)
+	if want := "# HELP calls_total Calls.\n# TYPE calls_total counter\ncalls_total 1\n"; b.String() != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		f    float64
+		want string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{-2.5, "-2.5"},
+		{0.005, "0.005"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+	for _, test := range tests {
+		if got := formatFloat(test.f); got != test.want {
+			t.Errorf("formatFloat(%v) = %q, want %q", test.f, got, test.want)
+		}
+	}
+}
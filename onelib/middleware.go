@@ -0,0 +1,237 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PriorityPermission is the priority of the built-in middleware checking permissions.
+	PriorityPermission = 100
+	// PriorityArgs is the priority of the built-in middleware parsing args.
+	PriorityArgs = 200
+	// PriorityRateLimit is the priority of the built-in middleware enforcing rate limits.
+	PriorityRateLimit = 300
+)
+
+// Middlewares is a slice of loaded Middlewares, sorted by priority.
+var Middlewares = NewMiddlewareSlice()
+
+// Invocation is a single call of a command, as it's passed through the middlewares.
+type Invocation struct {
+	Spec    *CommandSpec    // The command being called
+	Trigger string          // The name or alias used to call the command (ex: "r")
+	Prefix  string          // The prefix used to call the command (ex: ",")
+	Message Message         // The message without the prefix and trigger. Middlewares may replace it.
+	Sender  Sender          // Who called the command
+	Start   time.Time       // When the command was called
+	Elapsed time.Duration   // How long the command ran for, set before After is called
+	Panic   interface{}     // The value recovered if the command panicked, set before After is called
+	Context context.Context // The context the command is called with, cancelled after After is called
+}
+
+// Middleware wraps every command call. Before is called in order of Priority (lowest first) before the command is
+// called, and After in reverse order once it returns.
+type Middleware struct {
+	Name     string                 // Name of the middleware, should be unique (ex: "ignorelist")
+	Priority int                    // The order to run in, lowest first. See PriorityPermission for built-in values.
+	Before   func(*Invocation) bool // Called before the command, return false to stop the call (optional)
+	After    func(*Invocation)      // Called after the command, if every Before allowed the call (optional)
+	Plugin   string                 // The name of the plugin providing the middleware, set by OneBot on load
+}
+
+// MiddlewarePlugin can optionally be implemented by a Plugin to wrap every command call. The middlewares are removed
+// when the plugin is unloaded.
+type MiddlewarePlugin interface {
+	Middlewares() []*Middleware
+}
+
+// MiddlewareSlice is a concurrent-safe slice of middlewares, sorted by priority.
+type MiddlewareSlice struct {
+	middlewares []*Middleware
+	lock        *sync.RWMutex
+}
+
+// NewMiddlewareSlice returns a new concurrent-safe MiddlewareSlice.
+func NewMiddlewareSlice() *MiddlewareSlice {
+	return &MiddlewareSlice{middlewares: make([]*Middleware, 0), lock: new(sync.RWMutex)}
+}
+
+// Get copy of middleware slice for reading.
+func (ms *MiddlewareSlice) Get() []*Middleware {
+	ms.lock.RLock()
+	slice := ms.middlewares
+	ms.lock.RUnlock()
+	return slice
+}
+
+// Put a middleware into the MiddlewareSlice, keeping it sorted by priority.
+func (ms *MiddlewareSlice) Put(mw *Middleware) {
+	ms.lock.Lock()
+	middlewares := make([]*Middleware, len(ms.middlewares), len(ms.middlewares)+1)
+	copy(middlewares, ms.middlewares)
+	middlewares = append(middlewares, mw)
+	sort.SliceStable(middlewares, func(i, j int) bool {
+		return middlewares[i].Priority < middlewares[j].Priority
+	})
+	ms.middlewares = middlewares
+	ms.lock.Unlock()
+}
+
+// DeletePlugin removes every middleware provided by plugin.
+func (ms *MiddlewareSlice) DeletePlugin(plugin string) {
+	ms.lock.Lock()
+	middlewares := make([]*Middleware, 0, len(ms.middlewares))
+	for _, mw := range ms.middlewares {
+		if mw.Plugin != plugin {
+			middlewares = append(middlewares, mw)
+		}
+	}
+	ms.middlewares = middlewares
+	ms.lock.Unlock()
+}
+
+// invoke passes inv through the middlewares, calling the command in a new goroutine if every middleware allows it.
+func invoke(inv *Invocation) {
+	mws := Middlewares.Get()
+	for _, mw := range mws {
+		if mw.Before != nil && !callBefore(mw, inv) {
+			Debug.Printf("Middleware '%s' stopped call of '%s' by %s (%s).\n", mw.Name, inv.Trigger, inv.Sender.UUID(), inv.Sender.Protocol())
+			return
+		}
+	}
+	ctx, cancel := commandContext(inv.Spec, inv.Sender)
+	inv.Context = ctx
+	go func() {
+		defer cancel()
+		defer func() {
+			if r := recover(); r != nil {
+				inv.Panic = r
+				PanicsRecovered.Inc("command")
+				Error.Println("panic:", string(debug.Stack()))
+			}
+			inv.Elapsed = time.Since(inv.Start)
+			CommandCalls.Inc(inv.Spec.Plugin, inv.Spec.Name)
+			CommandDuration.ObserveDuration(inv.Elapsed, inv.Spec.Plugin, inv.Spec.Name)
+			for i := len(mws) - 1; i >= 0; i-- {
+				if mws[i].After != nil {
+					callAfter(mws[i], inv)
+				}
+			}
+		}()
+		inv.Spec.call(ctx, inv.Message, inv.Sender)
+	}()
+}
+
+// callBefore calls the Before hook of mw, returning its result. If it panics, the call is refused.
+func callBefore(mw *Middleware, inv *Invocation) (allow bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			allow = false
+			PanicsRecovered.Inc("middleware")
+			Error.Printf("Middleware '%s' panicked: %s\n", mw.Name, string(debug.Stack()))
+		}
+	}()
+	return mw.Before(inv)
+}
+
+// callAfter calls the After hook of mw, recovering from any panic so the other hooks still run.
+func callAfter(mw *Middleware, inv *Invocation) {
+	defer func() {
+		if r := recover(); r != nil {
+			PanicsRecovered.Inc("middleware")
+			Error.Printf("Middleware '%s' panicked: %s\n", mw.Name, string(debug.Stack()))
+		}
+	}()
+	mw.After(inv)
+}
+
+// loadBuiltinMiddlewares puts the middlewares built into OneBot into the middleware slice.
+func loadBuiltinMiddlewares() {
+	Middlewares.Put(&Middleware{Name: "permission", Priority: PriorityPermission, Before: checkPermission, Plugin: BuiltinPlugin})
+	Middlewares.Put(&Middleware{Name: "args", Priority: PriorityArgs, Before: parseArgs, Plugin: BuiltinPlugin})
+	Middlewares.Put(&Middleware{Name: "ratelimit", Priority: PriorityRateLimit, Before: checkRateLimits, Plugin: BuiltinPlugin})
+}
+
+// checkPermission refuses the call if the sender isn't allowed to make it.
+func checkPermission(inv *Invocation) bool {
+	if !HasPermission(inv.Sender, inv.Spec.Permission) {
+		notifySender(inv.Sender, "You don't have permission to use that command.", "")
+		return false
+	}
+	return true
+}
+
+// notifySender sends formatted text to the location sender called a command from, or to the sender directly if they
+// have no location. If formattedText is empty, text is sent unformatted. Middlewares run on the protocol's receive
+// loop, and sends may wait on the protocol's outbox (see Outbox), so the text is sent in a new goroutine.
+func notifySender(sender Sender, text, formattedText string) {
+	go sendNotice(sender, text, formattedText)
+}
+
+// sendNotice sends formatted text as described by notifySender, logging any error.
+func sendNotice(sender Sender, text, formattedText string) {
+	defer func() {
+		if r := recover(); r != nil {
+			PanicsRecovered.Inc("middleware")
+			Error.Println("panic:", string(debug.Stack()))
+		}
+	}()
+	var err error
+	if loc := sender.Location(); loc != nil {
+		if formattedText == "" {
+			_, err = loc.SendText(text)
+		} else {
+			_, err = loc.SendFormattedText(text, formattedText)
+		}
+	} else if formattedText == "" {
+		_, err = sender.SendText(text)
+	} else {
+		_, err = sender.SendFormattedText(text, formattedText)
+	}
+	if err != nil {
+		Debug.Printf("Couldn't notify %s (%s): %s\n", sender.UUID(), sender.Protocol(), err)
+	}
+}
+
+// capitalize returns s with its first letter in upper case.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// parseArgs parses the args declared by the command, replying with its usage if they're invalid.
+func parseArgs(inv *Invocation) bool {
+	if len(inv.Spec.Args) == 0 {
+		return true
+	}
+	args, err := ParseArgs(inv.Spec.Args, inv.Message.Text(), Mentions(inv.Message))
+	if err != nil {
+		usage := strings.TrimSpace(SenderPrefix(inv.Sender) + inv.Trigger + " " + inv.Spec.UsageText())
+		notifySender(inv.Sender, fmt.Sprintf("%s. Usage: `%s`", capitalize(err.Error()), usage),
+			fmt.Sprintf("%s. Usage: <code>%s</code>", html.EscapeString(capitalize(err.Error())), html.EscapeString(usage)))
+		return false
+	}
+	inv.Message = &argsMessage{Message: inv.Message, args: args}
+	return true
+}
+
+// checkRateLimits refuses the call if any of the command's rate limits has no calls left.
+func checkRateLimits(inv *Invocation) bool {
+	if wait := TakeRateLimits(inv.Spec.Name, inv.Sender, inv.Spec.RateLimits); wait > 0 {
+		text, formattedText := FormatWait(wait)
+		notifySender(inv.Sender, text, formattedText)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvokeRecoversBefore(t *testing.T) {
+	defer Middlewares.DeletePlugin("test")
+	allow := true
+	Middlewares.Put(&Middleware{Name: "panics", Plugin: "test", Before: func(inv *Invocation) bool {
+		if !allow {
+			panic("refused")
+		}
+		return true
+	}})
+	called := make(chan bool, 1)
+	spec := &CommandSpec{Name: "test", Plugin: "test", Command: func(msg Message, sender Sender) { called <- true }}
+	sender := &testSender{uuid: "alice", protocol: "test"}
+
+	invoke(&Invocation{Spec: spec, Trigger: "test", Message: &testMessage{}, Sender: sender, Start: time.Now()})
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("command wasn't called")
+	}
+
+	allow = false
+	invoke(&Invocation{Spec: spec, Trigger: "test", Message: &testMessage{}, Sender: sender, Start: time.Now()})
+	select {
+	case <-called:
+		t.Fatal("command was called after its middleware panicked")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
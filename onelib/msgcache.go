@@ -0,0 +1,76 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"sync"
+)
+
+// CachedMessage is a message stored in a MessageCache, along with who sent it.
+type CachedMessage struct {
+	Message Message
+	Sender  Sender
+}
+
+// MessageCache is a concurrent-safe store of the most recent messages seen by a protocol, so edits and deletes can
+// carry the message as it was before. Once full, the oldest message is forgotten for every new one.
+type MessageCache struct {
+	messages map[UUID]*CachedMessage
+	slots    map[UUID]int // index in order of each cached UUID
+	order    []UUID       // ring of UUIDs in the order they were stored, empty where a message was deleted
+	next     int          // index in order to store the next UUID at
+	lock     *sync.RWMutex
+}
+
+// NewMessageCache returns a new MessageCache holding up to size messages.
+func NewMessageCache(size int) *MessageCache {
+	if size < 1 {
+		size = 1
+	}
+	return &MessageCache{
+		messages: make(map[UUID]*CachedMessage, size),
+		slots:    make(map[UUID]int, size),
+		order:    make([]UUID, size),
+		lock:     new(sync.RWMutex),
+	}
+}
+
+// Get returns the message stored under uuid, or nil if it isn't cached.
+func (mc *MessageCache) Get(uuid UUID) *CachedMessage {
+	mc.lock.RLock()
+	cm := mc.messages[uuid]
+	mc.lock.RUnlock()
+	return cm
+}
+
+// Put stores msg sent by sender under uuid, replacing any message already stored under it.
+func (mc *MessageCache) Put(uuid UUID, msg Message, sender Sender) {
+	if uuid == "" {
+		return
+	}
+	mc.lock.Lock()
+	if _, ok := mc.messages[uuid]; !ok {
+		if oldest := mc.order[mc.next]; oldest != "" {
+			delete(mc.messages, oldest)
+			delete(mc.slots, oldest)
+		}
+		mc.order[mc.next] = uuid
+		mc.slots[uuid] = mc.next
+		mc.next = (mc.next + 1) % len(mc.order)
+	}
+	mc.messages[uuid] = &CachedMessage{Message: msg, Sender: sender}
+	mc.lock.Unlock()
+}
+
+// Delete removes the message stored under uuid, returning it (or nil if it wasn't cached).
+func (mc *MessageCache) Delete(uuid UUID) *CachedMessage {
+	mc.lock.Lock()
+	cm := mc.messages[uuid]
+	if slot, ok := mc.slots[uuid]; ok {
+		mc.order[slot] = ""
+		delete(mc.slots, uuid)
+	}
+	delete(mc.messages, uuid)
+	mc.lock.Unlock()
+	return cm
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMessageCache(t *testing.T) {
+	// Each step is "+uuid" to Put, or "-uuid" to Delete.
+	tests := []struct {
+		name  string
+		size  int
+		steps []string
+		want  []UUID // the UUIDs cached afterwards
+	}{
+		{"put", 3, []string{"+a", "+b"}, []UUID{"a", "b"}},
+		{"wrap", 3, []string{"+a", "+b", "+c", "+d"}, []UUID{"b", "c", "d"}},
+		{"put again", 3, []string{"+a", "+b", "+a", "+c"}, []UUID{"a", "b", "c"}},
+		{"delete", 3, []string{"+a", "+b", "-a"}, []UUID{"b"}},
+		{"delete missing", 3, []string{"+a", "-z"}, []UUID{"a"}},
+		{"put after delete", 2, []string{"+a", "-a", "+a", "+b"}, []UUID{"a", "b"}},
+		{"wrap over deleted", 2, []string{"+a", "-a", "+a", "+b", "+c"}, []UUID{"b", "c"}},
+		{"wrap keeps re-put", 3, []string{"+a", "+b", "-a", "+c", "+a", "+d"}, []UUID{"a", "c", "d"}},
+		{"size 1", 1, []string{"+a", "+b"}, []UUID{"b"}},
+		{"size 0", 0, []string{"+a"}, []UUID{"a"}},
+		{"empty uuid", 2, []string{"+", "+a"}, []UUID{"a"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mc := NewMessageCache(test.size)
+			for _, step := range test.steps {
+				uuid := UUID(step[1:])
+				if step[0] == '+' {
+					mc.Put(uuid, &testMessage{text: step}, nil)
+				} else {
+					mc.Delete(uuid)
+				}
+			}
+			got := make([]UUID, 0, len(mc.messages))
+			for uuid := range mc.messages {
+				if mc.Get(uuid) == nil {
+					t.Errorf("Get(%q) = nil for a cached message", uuid)
+				}
+				got = append(got, uuid)
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("cached %v, want %v", got, test.want)
+			}
+			if len(mc.slots) != len(mc.messages) {
+				t.Errorf("%d slots for %d messages", len(mc.slots), len(mc.messages))
+			}
+		})
+	}
+}
@@ -3,21 +3,35 @@
 package onelib
 
 import (
+	"errors"
 	"fmt"
 	"plugin"
 	"runtime/debug"
 	"strings"
+	"time"
 )
 
 // TODO Plugin / protocol list should save when manually changed
 
-// LoadPlugin loads a plugin by filename (minus extension)
+// ErrNotSupported is returned when the protocol doesn't support what was asked of it (ex: reacting to a message).
+var ErrNotSupported = errors.New("not supported by the protocol")
+
+// LoadPlugin loads a plugin by filename (minus extension), using the plugin compiled into the binary if it was
+// registered with RegisterPlugin, otherwise opening it from the plugin directory.
 func LoadPlugin(name string) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
+			if cerr, ok := r.(*ConfigError); ok {
+				err = cerr
+				return
+			}
 			err = fmt.Errorf("panic: %s", string(debug.Stack()))
 		}
 	}()
+	if load := staticPlugin(name); load != nil {
+		registerPlugin(name, load())
+		return nil
+	}
 	rawPlug, err := plugin.Open(fmt.Sprintf("%s/%s.so", PluginDir, name))
 	if err != nil {
 		return err
@@ -26,23 +40,71 @@ func LoadPlugin(name string) (err error) {
 	if err != nil {
 		return err
 	}
-	plug := loadF.(func() Plugin)()
+	registerPlugin(name, loadF.(func() Plugin)())
+	return nil
+}
+
+// registerPlugin puts an already loaded plugin into the plugin map, along with its commands, monitor, and middlewares.
+func registerPlugin(name string, plug Plugin) {
 	Plugins.Put(name, plug)
 
 	commands, mon := plug.Implements()
-	for trigger, command := range commands {
-		Commands.Put(trigger, command)
-	}
+	registerCommands(name, plug, commands)
 	// TODO unload
 	if mon != nil {
 		Monitors.Put(mon)
 	}
+	if mPlug, ok := plug.(MiddlewarePlugin); ok {
+		for _, mw := range mPlug.Middlewares() {
+			mw.Plugin = name
+			Middlewares.Put(mw)
+		}
+	}
 
 	Info.Printf("Loaded '%s' version %s.\n", plug.LongName(), plug.Version())
+}
+
+// registerCommands puts the commands of a plugin into the command map, described by its specs if it has any.
+func registerCommands(name string, plug Plugin, commands map[string]Command) {
+	described := make(map[string]bool, len(commands))
+	if sPlug, ok := plug.(SpecPlugin); ok {
+		for _, spec := range sPlug.CommandSpecs() {
+			if spec.Command == nil && spec.ContextCommand == nil {
+				spec.Command = commands[spec.Name]
+			}
+			if spec.Command == nil && spec.ContextCommand == nil {
+				Error.Printf("Plugin '%s' describes command '%s', but doesn't implement it.\n", name, spec.Name)
+				continue
+			}
+			spec.Plugin = name
+			Commands.PutSpec(spec)
+			described[spec.Name] = true
+			for _, alias := range spec.Aliases {
+				described[alias] = true
+			}
+		}
+	}
+	for trigger, command := range commands {
+		if !described[trigger] {
+			Commands.PutSpec(&CommandSpec{Name: trigger, Plugin: name, Command: command})
+		}
+	}
+}
+
+// RefreshCommands describes the commands of a loaded plugin again, picking up changes to their specs (Ex: rate limits
+// read from the config file, after it's reloaded).
+func RefreshCommands(name string) error {
+	plug := Plugins.Get(name)
+	if plug == nil {
+		return fmt.Errorf("Plugin '%s' not loaded.", name)
+	}
+	commands, _ := plug.Implements()
+	Commands.DeletePlugin(name)
+	registerCommands(name, plug, commands)
 	return nil
 }
 
-// LoadPlugins loads all plugins in the plugin directory
+// LoadPlugins loads all plugins in the plugin directory, followed by the RPC plugins (see LoadRPCPlugins).
 func LoadPlugins() {
 	for _, pluginName := range PluginLoadList {
 		err := LoadPlugin(pluginName)
@@ -50,6 +112,7 @@ func LoadPlugins() {
 			Error.Printf("Failed to load plugin '%s': %v\n", pluginName, err)
 		}
 	}
+	LoadRPCPlugins()
 }
 
 // UnloadPlugin removes a plugin from the active plugins map, returning an error if not loaded, calling the related
@@ -60,35 +123,54 @@ func UnloadPlugin(name string) error {
 		return fmt.Errorf("Plugin '%s' not loaded.", name)
 	}
 	Plugins.Delete(name)
-	commands, monitor := plug.Implements()
+	_, monitor := plug.Implements()
 	Monitors.Delete(monitor)
-	Commands.DeleteSet(commands)
+	Commands.DeletePlugin(name)
+	Middlewares.DeletePlugin(name)
+	Scheduler.DeleteOwner(name)
+	ConfigSubscriptions.DeleteOwner(name)
+	pluginContexts.Delete(name)
 	return nil
 }
 
-// UnloadPlugins unloads every plugin, calling their unload routines.
+// UnloadPlugins unloads every plugin, calling their unload routines. Built-in commands and middlewares remain loaded.
 func UnloadPlugins() {
 	Monitors.DeleteAll()
-	Commands.DeleteAll()
+	for _, pluginName := range Plugins.List() {
+		Commands.DeletePlugin(pluginName)
+		Middlewares.DeletePlugin(pluginName)
+		Scheduler.DeleteOwner(pluginName)
+		ConfigSubscriptions.DeleteOwner(pluginName)
+		pluginContexts.Delete(pluginName)
+	}
 	Plugins.DeleteAll()
 }
 
-// LoadProtocol loads a protocol by filename (minus extension)
+// LoadProtocol loads a protocol by filename (minus extension), using the protocol compiled into the binary if it was
+// registered with RegisterProtocol, otherwise opening it from the protocol directory.
 func LoadProtocol(name string) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
+			if cerr, ok := r.(*ConfigError); ok {
+				err = cerr
+				return
+			}
 			err = fmt.Errorf("panic: %s", string(debug.Stack()))
 		}
 	}()
-	rawProto, err := plugin.Open(fmt.Sprintf("%s/%s.so", ProtocolDir, name))
-	if err != nil {
-		return err
-	}
-	loadF, err := rawProto.Lookup("Load")
-	if err != nil {
-		return err
+	load := staticProtocol(name)
+	if load == nil {
+		rawProto, err := plugin.Open(fmt.Sprintf("%s/%s.so", ProtocolDir, name))
+		if err != nil {
+			return err
+		}
+		loadF, err := rawProto.Lookup("Load")
+		if err != nil {
+			return err
+		}
+		load = loadF.(func() Protocol)
 	}
-	proto := loadF.(func() Protocol)()
+	proto := load()
 	Protocols.Put(name, proto)
 	Info.Printf("Loaded '%s' version %s.\n", proto.LongName(), proto.Version())
 	return nil
@@ -106,7 +188,11 @@ func LoadProtocols() {
 
 // UnloadProtocols unloads every protocol, calling their unload routines.
 func UnloadProtocols() {
+	for _, protocolName := range Protocols.List() {
+		Scheduler.DeleteOwner(protocolName)
+	}
 	Protocols.DeleteAll()
+	protocolContexts.DeleteAll()
 }
 
 // getcommand returns the command using the line of text containing the command and the expected prefix (doesn't verify
@@ -120,22 +206,36 @@ func getcommand(prefix, line string) string {
 	return text[:i]
 }
 
-// ProcessMessage processes command and monitor triggers, spawning a new goroutine for every trigger.
-func ProcessMessage(prefix []string, msg Message, sender Sender) {
+// ProcessMessage processes command and monitor triggers, spawning a new goroutine for every trigger. Commands are
+// triggered by the prefix for the sender's location (see GetPrefix), or by any of mentions if MentionPrefix is true.
+// mentions are the ways of mentioning the bot on the protocol, including any trailing whitespace (Ex: "@OneBot ").
+// Messages a conversation is waiting on (see Await) are handed to it instead.
+func ProcessMessage(mentions []string, msg Message, sender Sender) {
+	MessagesReceived.Inc(sender.Protocol())
+	if Conversations.intercept(msg, sender) {
+		return
+	}
 	text := msg.Text()
-	for _, p := range prefix {
-		if len(text) > len(p) && string(text[:len(p)]) == p {
+	prefixes := []string{SenderPrefix(sender)}
+	configLock.RLock()
+	mentionPrefix := MentionPrefix
+	configLock.RUnlock()
+	if mentionPrefix {
+		prefixes = append(prefixes, mentions...)
+	}
+	for _, p := range prefixes {
+		if p != "" && len(text) > len(p) && string(text[:len(p)]) == p {
 			commandName := getcommand(p, text)
-			if command := Commands.Get(commandName); command != nil {
-				// Call command as goroutine, passing a copy of the message without the command call
-				go func() {
-					defer func() {
-						if r := recover(); r != nil {
-							Error.Println("panic:", string(debug.Stack()))
-						}
-					}()
-					command(msg.StripPrefix(p+commandName), sender)
-				}()
+			if spec := Commands.GetSpec(commandName); spec != nil {
+				// Pass a copy of the message without the command call
+				invoke(&Invocation{
+					Spec:    spec,
+					Trigger: commandName,
+					Prefix:  p,
+					Message: msg.StripPrefix(p + commandName),
+					Sender:  sender,
+					Start:   time.Now(),
+				})
 
 				return // TODO once command outputs are bridged, this line needs to be removed so the bridge can still bridge the call itself
 			}
@@ -144,32 +244,34 @@ func ProcessMessage(prefix []string, msg Message, sender Sender) {
 
 	mons := Monitors.Get()
 	for _, mon := range mons {
+		mon := mon
 		if mon.OnMessage != nil {
-			go func(mon *Monitor) {
-				defer func() {
-					if r := recover(); r != nil {
-						Error.Println("panic:", string(debug.Stack()))
-					}
-				}()
-				mon.OnMessage(sender, msg)
-			}(mon)
+			go runMonitor(func() { mon.OnMessage(sender, msg) })
 		}
 		if len(text) > 0 && mon.OnMessageWithText != nil {
-			go func(mon *Monitor) {
-				defer func() {
-					if r := recover(); r != nil {
-						Error.Println("panic:", string(debug.Stack()))
-					}
-				}()
-				mon.OnMessageWithText(sender, msg)
-			}(mon)
+			go runMonitor(func() { mon.OnMessageWithText(sender, msg) })
 		}
 	}
 
 }
 
-// ProcessUpdate processes monitor trigger "mon.OnMessageUpdate"
+// runMonitor calls a monitor trigger, recovering from any panic. It's meant to be run in its own goroutine, so slow
+// monitors don't hold up the protocol.
+func runMonitor(trigger func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			PanicsRecovered.Inc("monitor")
+			Error.Println("panic:", string(debug.Stack()))
+		}
+	}()
+	trigger()
+}
+
+// ProcessUpdate processes monitor trigger "mon.OnMessageUpdate", unless a conversation is waiting on it (see Await)
 func ProcessUpdate(msg Message, sender Sender) {
+	if Conversations.intercept(msg, sender) {
+		return
+	}
 	mons := Monitors.Get()
 	for _, mon := range mons {
 		if mon.OnMessageUpdate != nil {
@@ -177,3 +279,83 @@ func ProcessUpdate(msg Message, sender Sender) {
 		}
 	}
 }
+
+// ProcessEdit processes monitor trigger "mon.OnMessageEdit"
+func ProcessEdit(edit *MessageEdit, sender Sender) {
+	mons := Monitors.Get()
+	for _, mon := range mons {
+		mon := mon
+		if mon.OnMessageEdit != nil {
+			go runMonitor(func() { mon.OnMessageEdit(sender, edit) })
+		}
+	}
+}
+
+// ProcessDelete processes monitor trigger "mon.OnMessageDelete"
+func ProcessDelete(del *MessageDelete, location Location) {
+	mons := Monitors.Get()
+	for _, mon := range mons {
+		mon := mon
+		if mon.OnMessageDelete != nil {
+			go runMonitor(func() { mon.OnMessageDelete(location, del) })
+		}
+	}
+}
+
+// ProcessPresence processes monitor trigger "mon.OnPresenceUpdate"
+func ProcessPresence(update *PresenceUpdate, sender Sender) {
+	mons := Monitors.Get()
+	for _, mon := range mons {
+		mon := mon
+		if mon.OnPresenceUpdate != nil {
+			go runMonitor(func() { mon.OnPresenceUpdate(sender, update) })
+		}
+	}
+}
+
+// ProcessLocationUpdate processes monitor trigger "mon.OnLocationUpdate"
+func ProcessLocationUpdate(update *LocationUpdate, location Location) {
+	mons := Monitors.Get()
+	for _, mon := range mons {
+		mon := mon
+		if mon.OnLocationUpdate != nil {
+			go runMonitor(func() { mon.OnLocationUpdate(location, update) })
+		}
+	}
+}
+
+// Reply sends formatted text to location in reply to msg, if the location supports replies (see Replier). Otherwise
+// the text is sent to the location normally.
+func Reply(location Location, msg Message, text, formattedText string) (*SentMessage, error) {
+	if replier, ok := location.(Replier); ok && msg != nil && msg.UUID() != "" {
+		return replier.Reply(msg, text, formattedText)
+	}
+	return location.SendFormattedText(text, formattedText)
+}
+
+// ReplyTo returns the UUID of the message msg replies to, and the UUID of the thread it's in, if the protocol exposes
+// them (see ThreadMessage).
+func ReplyTo(msg Message) (replyTo, thread UUID) {
+	if tm, ok := UnwrapMessage(msg).(ThreadMessage); ok {
+		return tm.ReplyTo(), tm.Thread()
+	}
+	return "", ""
+}
+
+// React adds emoji as a reaction to the message with messageID in location, if the location supports reactions (see
+// Reactor). Otherwise ErrNotSupported is returned.
+func React(location Location, messageID UUID, emoji string) error {
+	if reactor, ok := location.(Reactor); ok {
+		return reactor.React(messageID, emoji)
+	}
+	return ErrNotSupported
+}
+
+// Unreact removes the bot's emoji reaction from the message with messageID in location, if the location supports
+// reactions (see Reactor). Otherwise ErrNotSupported is returned.
+func Unreact(location Location, messageID UUID, emoji string) error {
+	if reactor, ok := location.(Reactor); ok {
+		return reactor.Unreact(messageID, emoji)
+	}
+	return ErrNotSupported
+}
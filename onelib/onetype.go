@@ -5,8 +5,11 @@ package onelib
 // TODO How hard would it be for a plugin with this spec to tag a user on both Matrix and Discord?
 
 import (
+	"context"
 	"os"
+	"sort"
 	"sync"
+	"time"
 )
 
 // UUID represents a unique identifier, usually for a Location (room) or a Sender (user).
@@ -58,6 +61,7 @@ func init() {
 	Commands = NewCommandMap()
 	Monitors = NewMonitorSlice()
 	Quit = make(chan os.Signal)
+	loadBuiltins()
 }
 
 // ProtocolMap is a concurrent-safe map of protocols.
@@ -174,42 +178,93 @@ func (pm *PluginMap) List() []string {
 	return list
 }
 
-// CommandMap is a concurrent-safe map of commands
+// CommandMap is a concurrent-safe map of commands, keyed by every trigger (name and aliases) of each command.
 type CommandMap struct {
-	commands map[string]Command
+	commands map[string]*CommandSpec
 	lock     *sync.RWMutex
 }
 
 // NewCommandMap returns a new concurrent-safe CommandMap.
 func NewCommandMap() *CommandMap {
 	cm := &CommandMap{lock: new(sync.RWMutex)}
-	cm.commands = make(map[string]Command, 4)
+	cm.commands = make(map[string]*CommandSpec, 4)
 	return cm
 }
 
 // Get a command from the CommandMap.
 func (cm *CommandMap) Get(commandName string) Command {
+	spec := cm.GetSpec(commandName)
+	if spec == nil {
+		return nil
+	}
+	if spec.Command == nil && spec.ContextCommand != nil {
+		return func(msg Message, sender Sender) {
+			spec.ContextCommand(PluginContext(spec.Plugin), msg, sender)
+		}
+	}
+	return spec.Command
+}
+
+// GetSpec gets the spec of a command from the CommandMap, using any of the command's triggers.
+func (cm *CommandMap) GetSpec(commandName string) *CommandSpec {
 	cm.lock.RLock()
-	command := cm.commands[commandName]
+	spec := cm.commands[commandName]
 	cm.lock.RUnlock()
-	return command
+	return spec
 }
 
-// Put a command into the CommandMap.
+// Put a command into the CommandMap, with no description.
 func (cm *CommandMap) Put(commandName string, command Command) {
+	cm.PutSpec(&CommandSpec{Name: commandName, Command: command})
+}
+
+// PutSpec puts a command into the CommandMap under its name and every alias.
+func (cm *CommandMap) PutSpec(spec *CommandSpec) {
 	cm.lock.Lock()
-	cm.commands[commandName] = command
+	cm.commands[spec.Name] = spec
+	for _, alias := range spec.Aliases {
+		cm.commands[alias] = spec
+	}
 	cm.lock.Unlock()
 }
 
-// Delete removes the command from the active command list, calling the command's unload method via goroutine.
+// Permission returns the permission required to call a command.
+func (cm *CommandMap) Permission(commandName string) Permission {
+	spec := cm.GetSpec(commandName)
+	if spec == nil {
+		return PermissionUser
+	}
+	return spec.Permission
+}
+
+// List returns the spec of every command in the CommandMap (once each, regardless of aliases), sorted by plugin, then
+// name.
+func (cm *CommandMap) List() []*CommandSpec {
+	cm.lock.RLock()
+	list := make([]*CommandSpec, 0, len(cm.commands))
+	for trigger, spec := range cm.commands {
+		if trigger == spec.Name {
+			list = append(list, spec)
+		}
+	}
+	cm.lock.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Plugin != list[j].Plugin {
+			return list[i].Plugin < list[j].Plugin
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Delete removes the command from the active command list.
 func (cm *CommandMap) Delete(commandName string) {
 	cm.lock.Lock()
 	delete(cm.commands, commandName)
 	cm.lock.Unlock()
 }
 
-// DeleteSet removes a map of commands from the active command list, calling the command's unload method via goroutine.
+// DeleteSet removes a map of commands from the active command list.
 func (cm *CommandMap) DeleteSet(set map[string]Command) {
 	if set == nil {
 		return
@@ -221,10 +276,21 @@ func (cm *CommandMap) DeleteSet(set map[string]Command) {
 	cm.lock.Unlock()
 }
 
+// DeletePlugin removes every command provided by plugin from the active command list.
+func (cm *CommandMap) DeletePlugin(plugin string) {
+	cm.lock.Lock()
+	for trigger, spec := range cm.commands {
+		if spec.Plugin == plugin {
+			delete(cm.commands, trigger)
+		}
+	}
+	cm.lock.Unlock()
+}
+
 // DeleteAll removes all commands from the active command list.
 func (cm *CommandMap) DeleteAll() {
 	cm.lock.Lock()
-	cm.commands = make(map[string]Command)
+	cm.commands = make(map[string]*CommandSpec)
 	cm.lock.Unlock()
 }
 
@@ -300,11 +366,11 @@ type Location interface {
 	Nickname() string    // The nickname of the bot in the location
 	Topic() string       // The topic of the location
 	// Picture // TODO The avatar of the location
-	UUID() UUID                                   // Unique identifier for the location
-	Send(msg Message)                             // Sends a message to the location
-	SendText(text string)                         // Sends text to the location
-	SendFormattedText(text, formattedText string) // Sends formatted text to the location (correctness might vary between protocols)
-	Protocol() string                             // Returns the name of the protocol the location is in
+	UUID() UUID                                                         // Unique identifier for the location
+	Send(msg Message) (*SentMessage, error)                             // Sends a message to the location
+	SendText(text string) (*SentMessage, error)                         // Sends text to the location
+	SendFormattedText(text, formattedText string) (*SentMessage, error) // Sends formatted text to the location (correctness might vary between protocols)
+	Protocol() string                                                   // Returns the name of the protocol the location is in
 }
 
 // Message contains information either being sent or received
@@ -319,6 +385,58 @@ type Message interface {
 	// Reactions() []Reaction // TODO The reactions on the message
 }
 
+// MessageWrapper can optionally be implemented by a Message wrapping another one (Ex: a command call carrying its parsed
+// args, see CommandArgs), so the optional interfaces of the wrapped message can still be found.
+type MessageWrapper interface {
+	Unwrap() Message // Returns the wrapped message
+}
+
+// UnwrapMessage returns the message given by the protocol, unwrapping msg if it wraps one (see MessageWrapper).
+// Optional interfaces (Ex: ThreadMessage) should be checked on the returned message.
+func UnwrapMessage(msg Message) Message {
+	for {
+		mw, ok := msg.(MessageWrapper)
+		if !ok {
+			return msg
+		}
+		msg = mw.Unwrap()
+	}
+}
+
+// ThreadMessage can optionally be implemented by a Message which can reply to another message, or be part of a thread.
+type ThreadMessage interface {
+	ReplyTo() UUID // The UUID of the message this message replies to, empty if none
+	Thread() UUID  // The UUID of the thread the message is in (usually the UUID of its first message), empty if none
+}
+
+// Replier can optionally be implemented by a Location or Sender which can send text in reply to a message. If the
+// message is part of a thread (see ThreadMessage), the reply is sent to the same thread.
+type Replier interface {
+	Reply(to Message, text, formattedText string) (*SentMessage, error) // Sends formatted text in reply to the message (correctness might vary between protocols)
+}
+
+// Reactor can optionally be implemented by a Location where the bot can react to messages. Emojis are given as unicode
+// (ex: "👍"), or in the protocol's format for custom emojis. Protocols only supporting one kind of reaction (ex:
+// Bluesky's likes) treat every emoji as that reaction.
+type Reactor interface {
+	React(messageID UUID, emoji string) error   // Adds the emoji as a reaction to the message
+	Unreact(messageID UUID, emoji string) error // Removes the bot's reaction with the emoji from the message
+}
+
+// SentMessage is a handle to a message the bot sent, so it can be edited, deleted, or reacted to later.
+type SentMessage struct {
+	UUID     UUID      // Unique identifier for the message, empty if the protocol doesn't give one (Ex: IRC)
+	Parts    []UUID    // If the protocol split the message up (Ex: Bluesky's 300 character limit), every part in order, UUID is the first
+	Location UUID      // The location the message was sent to
+	Protocol string    // The name of the protocol the message was sent with
+	Time     time.Time // When the message was sent
+}
+
+// NewSentMessage returns a handle to a message sent just now.
+func NewSentMessage(uuid, location UUID, protocol string) *SentMessage {
+	return &SentMessage{UUID: uuid, Location: location, Protocol: protocol, Time: time.Now()}
+}
+
 // Emoji contains data which should be useful around emojis.
 type Emoji struct {
 	ID    UUID   // The UUID of the emoji, should never be blank.
@@ -326,18 +444,77 @@ type Emoji struct {
 	Added bool   // If true, the emoji was just added as a reaction. If false, it was just removed. Ignore field on reaction lists (See Message.Reactions()).
 }
 
+// MessageEdit describes a message being edited.
+type MessageEdit struct {
+	Old Message // The message before it was edited, nil if unknown
+	New Message // The message after it was edited, its UUID is the UUID of the original message
+}
+
+// MessageDelete describes a message being deleted.
+type MessageDelete struct {
+	UUID   UUID    // The UUID of the deleted message
+	Old    Message // The message before it was deleted, nil if unknown
+	Sender Sender  // Who sent the message, nil if unknown
+	By     UUID    // Who deleted the message, if known and not the sender
+}
+
+// PresenceType is the kind of change described by a PresenceUpdate.
+type PresenceType int
+
+const (
+	// PresenceStatus is a change in status (Ex: from "online" to "idle").
+	PresenceStatus PresenceType = iota
+	// PresenceJoin is the user joining the location.
+	PresenceJoin
+	// PresenceLeave is the user leaving the location.
+	PresenceLeave
+	// PresenceInvite is the user being invited to the location.
+	PresenceInvite
+	// PresenceKick is the user being removed from the location by someone else.
+	PresenceKick
+	// PresenceBan is the user being banned from the location.
+	PresenceBan
+)
+
+// PresenceUpdate describes a change in a user's presence or membership. The user is the Sender it's passed with.
+type PresenceUpdate struct {
+	Type       PresenceType // The kind of change
+	Status     string       // The new status as named by the protocol (ex: "online", "idle"), only set for PresenceStatus
+	StatusText string       // The user's status message, if any, only set for PresenceStatus
+	By         UUID         // Who made the change, if it wasn't the user (ex: who kicked or invited them)
+	Reason     string       // The reason given for the change, if any
+}
+
+// LocationUpdateType is the kind of change described by a LocationUpdate.
+type LocationUpdateType int
+
+const (
+	// LocationTopic is a change in the location's topic.
+	LocationTopic LocationUpdateType = iota
+	// LocationName is a change in the location's display name.
+	LocationName
+)
+
+// LocationUpdate describes a change to a location. The location is the Location it's passed with.
+type LocationUpdate struct {
+	Type LocationUpdateType // The kind of change
+	Old  string             // The previous value, if known
+	New  string             // The new value
+	By   UUID               // Who made the change, if known
+}
+
 // Sender contains information about who and where a message came from
 type Sender interface {
 	DisplayName() string // Display name of the sender
 	Username() string    // Username of the sender (often unknown, should return an empty string if so)
 	UUID() UUID          // Unique identifier for the sender
 	// Picture // TODO The avatar of the sender
-	Location() Location                           // The location where this sender sent the message from
-	Protocol() string                             // Returns the protocol name responsible for the sender
-	Self() bool                                   // Returns true if the sender is the bot
-	Send(msg Message)                             // Sends a Message to the sender
-	SendText(text string)                         // Sends text to the sender
-	SendFormattedText(text, formattedText string) // Sends formatted text to the sender (correctness might vary between protocols)
+	Location() Location                                                 // The location where this sender sent the message from
+	Protocol() string                                                   // Returns the protocol name responsible for the sender
+	Self() bool                                                         // Returns true if the sender is the bot
+	Send(msg Message) (*SentMessage, error)                             // Sends a Message to the sender
+	SendText(text string) (*SentMessage, error)                         // Sends text to the sender
+	SendFormattedText(text, formattedText string) (*SentMessage, error) // Sends formatted text to the sender (correctness might vary between protocols)
 }
 
 /* PROTOCOL SPEC
@@ -348,14 +525,14 @@ Plugins should contain a function named "Load() Protocol".
 
 // Protocol contains information about a protocol plugin
 type Protocol interface {
-	Name() string                                          // The name of the protocol, used in the protocol map (should be same as filename, minus extension)
-	LongName() string                                      // The display name of the protocol
-	Version() string                                       // The version of the protocol
-	NewMessage(raw []byte) Message                         // Returns a new Message object built from []byte (TODO: I hate this)
-	Send(to UUID, msg Message)                             // Sends a Message to a location
-	SendText(to UUID, text string)                         // Sends text to a location
-	SendFormattedText(to UUID, text, formattedText string) // Sends formatted text to a location (correctness might vary between protocols)
-	Remove()                                               // Called when the protocol is about to be terminated
+	Name() string                                                                // The name of the protocol, used in the protocol map (should be same as filename, minus extension)
+	LongName() string                                                            // The display name of the protocol
+	Version() string                                                             // The version of the protocol
+	NewMessage(raw []byte) Message                                               // Returns a new Message object built from []byte (TODO: I hate this)
+	Send(to UUID, msg Message) (*SentMessage, error)                             // Sends a Message to a location
+	SendText(to UUID, text string) (*SentMessage, error)                         // Sends text to a location
+	SendFormattedText(to UUID, text, formattedText string) (*SentMessage, error) // Sends formatted text to a location (correctness might vary between protocols)
+	Remove()                                                                     // Called when the protocol is about to be terminated
 }
 
 /* PLUGIN SPEC
@@ -375,12 +552,57 @@ type Plugin interface {
 
 // Monitor is a struct containing pointers to functions which are called on certain events (can be nil).
 type Monitor struct {
-	OnMessage         func(from Sender, msg Message)    // Called on every new message
-	OnMessageWithText func(from Sender, msg Message)    // Called on every new message containing text
-	OnMessageUpdate   func(from Sender, update Message) // Called on message update (IE: edit, reaction)
-	//    OnPresenceUpdate func(from Sender, update UserPresence) // Called on user presence update
-	//    OnLocationUpdate func(from Location, update LocationPresence) // Called on location update
+	OnMessage         func(from Sender, msg Message)              // Called on every new message
+	OnMessageWithText func(from Sender, msg Message)              // Called on every new message containing text
+	OnMessageUpdate   func(from Sender, update Message)           // Called on message update (IE: reaction)
+	OnMessageEdit     func(from Sender, edit *MessageEdit)        // Called when a message is edited
+	OnMessageDelete   func(from Location, delete *MessageDelete)  // Called when a message is deleted
+	OnPresenceUpdate  func(from Sender, update *PresenceUpdate)   // Called on user presence or membership update
+	OnLocationUpdate  func(from Location, update *LocationUpdate) // Called on location update (IE: topic change)
 }
 
 // Command is a function called when a certain key is triggered.
 type Command func(msg Message, sender Sender)
+
+// ContextCommand is a Command taking a context, which is cancelled when the plugin or protocol is unloaded, OneBot
+// shuts down, or the command runs past its deadline. Long running commands should stop once it's done.
+type ContextCommand func(ctx context.Context, msg Message, sender Sender)
+
+// CommandSpec describes a command, so it can be listed, explained, and permission checked before being called.
+type CommandSpec struct {
+	Name           string         // The main trigger of the command (ex: "roll")
+	Aliases        []string       // Other triggers for the command (ex: "r")
+	Description    string         // What the command does, in a sentence or two
+	Usage          string         // The arguments taken, without the prefix or trigger (ex: "[sides]"), generated from Args if blank
+	Args           []*Arg         // If set, the arguments are parsed before the command is called (see CommandArgs)
+	Permission     Permission     // The permission required to call the command
+	RateLimits     []*RateLimit   // Limits on how often the command can be called, every limit must allow a call
+	Hidden         bool           // If true, the command isn't listed by help (it can still be called, and explained)
+	Plugin         string         // The name of the plugin providing the command, set by OneBot on load
+	Command        Command        // Called when triggered. If nil, the command under Name returned by Implements is used.
+	ContextCommand ContextCommand // Called in place of Command if set, with a context cancelled once the call should stop
+	Timeout        time.Duration  // The longest the command may run for, CommandTimeout is used if 0, no deadline if negative
+}
+
+// call calls the command, passing ctx if it takes a context.
+func (spec *CommandSpec) call(ctx context.Context, msg Message, sender Sender) {
+	if spec.ContextCommand != nil {
+		spec.ContextCommand(ctx, msg, sender)
+	} else {
+		spec.Command(msg, sender)
+	}
+}
+
+// UsageText returns the arguments taken by the command, without the prefix or trigger (Ex: "[sides]").
+func (spec *CommandSpec) UsageText() string {
+	if spec.Usage == "" {
+		return ArgsUsage(spec.Args)
+	}
+	return spec.Usage
+}
+
+// SpecPlugin can optionally be implemented by a Plugin to describe the commands it implements. Commands returned by
+// Implements, but not described here, are given a spec containing only their name.
+type SpecPlugin interface {
+	CommandSpecs() []*CommandSpec
+}
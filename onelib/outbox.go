@@ -0,0 +1,189 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// RetryError is a send error which is worth retrying (ex: the protocol is rate limiting, or is briefly down). See
+// RetryAfter.
+type RetryError struct {
+	Err   error
+	After time.Duration // How long to wait before retrying, 0 to back off as usual
+}
+
+func (re *RetryError) Error() string {
+	return re.Err.Error()
+}
+
+func (re *RetryError) Unwrap() error {
+	return re.Err
+}
+
+// RetryAfter marks err as temporary, so an Outbox retries the send after waiting for after (or backing off as usual if
+// after is 0). It returns nil if err is nil.
+func RetryAfter(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryError{Err: err, After: after}
+}
+
+// Retryable returns true if a send which failed with err is worth retrying, and how long to wait first (0 to back off
+// as usual). Errors marked with RetryAfter, and network timeouts are retried.
+func Retryable(err error) (bool, time.Duration) {
+	var re *RetryError
+	if errors.As(err, &re) {
+		return true, re.After
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true, 0
+	}
+	return false, 0
+}
+
+// outboxItem is a send waiting its turn in an Outbox.
+type outboxItem struct {
+	send func() error
+	done chan error
+}
+
+// Outbox is a concurrent-safe queue of a protocol's outgoing sends. Sends to the same location happen one at a time in
+// the order they were queued, sends across the protocol are spaced out by the outbox's interval, and sends failing
+// with a temporary error (see Retryable) are retried with exponential backoff.
+type Outbox struct {
+	Retries  int           // How many times a failed send is retried before giving up
+	Backoff  time.Duration // How long to wait before the first retry, doubling for each retry after
+	name     string
+	log      *Log
+	interval time.Duration
+	next     time.Time              // The soonest the next send may happen
+	queues   map[UUID][]*outboxItem // keyed by location, the first item is being sent
+	lock     *sync.Mutex
+}
+
+// NewOutbox returns a new concurrent-safe Outbox for the protocol name, spacing sends out by at least interval.
+func NewOutbox(name string, interval time.Duration) *Outbox {
+	return &Outbox{Retries: 3, Backoff: time.Second, name: name, log: NewProtocolLog(name), interval: interval,
+		queues: make(map[UUID][]*outboxItem), lock: new(sync.Mutex)}
+}
+
+// Send queues send to be called once the sends queued for location before it are done, and the rate limit allows.
+// It waits until send succeeds, returning nil, or fails permanently, logging and returning the error. If the protocol
+// is unloaded while waiting, the context's error is returned. As it blocks through every retry, it shouldn't be called
+// from a protocol's receive loop.
+func (ob *Outbox) Send(location UUID, send func() error) error {
+	item := &outboxItem{send: send, done: make(chan error, 1)}
+	ob.lock.Lock()
+	queue := ob.queues[location]
+	ob.queues[location] = append(queue, item)
+	if len(queue) == 0 {
+		go ob.work(location)
+	}
+	ob.lock.Unlock()
+	return <-item.done
+}
+
+// work sends the items queued for location in order, until the queue is empty.
+func (ob *Outbox) work(location UUID) {
+	for {
+		ob.lock.Lock()
+		item := ob.queues[location][0]
+		ob.lock.Unlock()
+
+		err := ob.send(item.send)
+		if err != nil {
+			SendFailures.Inc(ob.name)
+			ob.log.Error.Printf("Failed to send to '%s': %s\n", location, err)
+		} else {
+			MessagesSent.Inc(ob.name)
+		}
+		item.done <- err
+
+		ob.lock.Lock()
+		queue := ob.queues[location][1:]
+		if len(queue) == 0 {
+			delete(ob.queues, location)
+			ob.lock.Unlock()
+			return
+		}
+		ob.queues[location] = queue
+		ob.lock.Unlock()
+	}
+}
+
+// send calls send once the rate limit allows, retrying it if it fails with a temporary error.
+func (ob *Outbox) send(send func() error) error {
+	backoff := ob.Backoff
+	for attempt := 0; ; attempt++ {
+		if err := ob.wait(ob.reserve()); err != nil {
+			return err
+		}
+		err := send()
+		if err == nil {
+			return nil
+		}
+		retry, after := Retryable(err)
+		if !retry {
+			return err
+		}
+		if attempt >= ob.Retries {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt+1, err)
+		}
+		if after > 0 {
+			// The protocol told us to wait, so hold back every send
+			ob.delay(after)
+		} else {
+			after = backoff
+			backoff *= 2
+		}
+		ob.log.Debug.Printf("Send failed, retrying in %s: %s\n", after, err)
+		if err := ob.wait(time.Now().Add(after)); err != nil {
+			return err
+		}
+	}
+}
+
+// reserve returns when the next send may happen, and spaces the send after it out by the interval.
+func (ob *Outbox) reserve() time.Time {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	at := time.Now()
+	if ob.next.After(at) {
+		at = ob.next
+	}
+	ob.next = at.Add(ob.interval)
+	return at
+}
+
+// delay holds back every send for at least d.
+func (ob *Outbox) delay(d time.Duration) {
+	ob.lock.Lock()
+	if next := time.Now().Add(d); next.After(ob.next) {
+		ob.next = next
+	}
+	ob.lock.Unlock()
+}
+
+// wait waits until at, returning an error if the protocol is unloaded first.
+func (ob *Outbox) wait(at time.Time) error {
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	ctx := ProtocolContext(ob.name)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
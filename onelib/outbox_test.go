@@ -0,0 +1,237 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error which timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryable(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name      string
+		err       error
+		wantRetry bool
+		wantAfter time.Duration
+	}{
+		{"plain error", failed, false, 0},
+		{"retry", RetryAfter(failed, 0), true, 0},
+		{"retry after", RetryAfter(failed, time.Second), true, time.Second},
+		{"wrapped retry", &net.OpError{Op: "write", Err: RetryAfter(failed, time.Second)}, true, time.Second},
+		{"network timeout", &net.OpError{Op: "write", Err: timeoutError{}}, true, 0},
+		{"closed connection", &net.OpError{Op: "write", Err: net.ErrClosed}, false, 0},
+	}
+	for _, test := range tests {
+		if retry, after := Retryable(test.err); retry != test.wantRetry || after != test.wantAfter {
+			t.Errorf("%s: Retryable() = %t, %s, want %t, %s", test.name, retry, after, test.wantRetry, test.wantAfter)
+		}
+	}
+	if err := RetryAfter(nil, time.Second); err != nil {
+		t.Errorf("RetryAfter(nil) = %v, want nil", err)
+	}
+}
+
+// queued returns how many sends are queued for location.
+func (ob *Outbox) queued(location UUID) int {
+	ob.lock.Lock()
+	defer ob.lock.Unlock()
+	return len(ob.queues[location])
+}
+
+func TestOutboxOrder(t *testing.T) {
+	ob := NewOutbox("outbox-order", 0)
+	release := make(chan struct{})
+	var (
+		order []int
+		lock  sync.Mutex
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 5; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ob.Send("room", func() error {
+				if i == 0 {
+					<-release // Holds the queue until every send is queued
+				}
+				lock.Lock()
+				order = append(order, i)
+				lock.Unlock()
+				return nil
+			})
+		}()
+		for ob.queued("room") != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// Other locations aren't held up by the queue
+	if err := ob.Send("other", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	wg.Wait()
+	if want := []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(order, want) {
+		t.Errorf("sent in order %v, want %v", order, want)
+	}
+	if n := ob.queued("room"); n != 0 {
+		t.Errorf("%d sends left queued, want 0", n)
+	}
+}
+
+func TestOutboxInterval(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	ob := NewOutbox("outbox-interval", interval)
+	var (
+		last time.Time
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+	start := time.Now()
+	locations := []UUID{"a", "b", "c", "a"}
+	for _, location := range locations {
+		location := location
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ob.Send(location, func() error {
+				lock.Lock()
+				if now := time.Now(); now.After(last) {
+					last = now
+				}
+				lock.Unlock()
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	// Each send waits for the interval after the one before it, across every location
+	if took, want := last.Sub(start), time.Duration(len(locations)-1)*interval; took < want {
+		t.Errorf("%d sends took %s, want at least %s", len(locations), took, want)
+	}
+}
+
+func TestOutboxRetries(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name         string
+		errs         []error // Returned by each attempt in order, nil once they run out
+		wantAttempts int
+		wantErr      string
+		minTook      time.Duration
+	}{
+		{"success", nil, 1, "", 0},
+		{"not retryable", []error{failed}, 1, "failed", 0},
+		{"backoff", []error{RetryAfter(failed, 0), RetryAfter(failed, 0)}, 3, "", 30 * time.Millisecond},
+		{"retry after", []error{RetryAfter(failed, 40*time.Millisecond)}, 2, "", 40 * time.Millisecond},
+		{"network timeout", []error{&net.OpError{Op: "write", Err: timeoutError{}}}, 2, "", 10 * time.Millisecond},
+		{"closed connection", []error{&net.OpError{Op: "write", Err: net.ErrClosed}}, 1,
+			"write: use of closed network connection", 0},
+		{"gives up", []error{RetryAfter(failed, 0), RetryAfter(failed, 0), RetryAfter(failed, 0)}, 3,
+			"giving up after 3 attempts: failed", 30 * time.Millisecond},
+		{"retry then fail", []error{RetryAfter(failed, 0), failed}, 2, "failed", 10 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ob := NewOutbox("outbox-retries", 0)
+			ob.Retries, ob.Backoff = 2, 10*time.Millisecond
+			attempts := 0
+			start := time.Now()
+			err := ob.Send("room", func() error {
+				attempts++
+				if attempts <= len(test.errs) {
+					return test.errs[attempts-1]
+				}
+				return nil
+			})
+			took := time.Since(start)
+			if test.wantErr == "" && err != nil {
+				t.Errorf("Send() error = %v", err)
+			} else if test.wantErr != "" && (err == nil || err.Error() != test.wantErr) {
+				t.Errorf("Send() error = %v, want %q", err, test.wantErr)
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("sent %d times, want %d", attempts, test.wantAttempts)
+			}
+			if took < test.minTook {
+				t.Errorf("Send() took %s, want at least %s", took, test.minTook)
+			}
+		})
+	}
+}
+
+func TestOutboxRetryAfterHoldsBack(t *testing.T) {
+	ob := NewOutbox("outbox-hold", 0)
+	ob.Retries = 1
+	attempts := 0
+	limited := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- ob.Send("a", func() error {
+			attempts++
+			if attempts == 1 {
+				close(limited)
+				return RetryAfter(errors.New("rate limited"), 50*time.Millisecond)
+			}
+			return nil
+		})
+	}()
+	<-limited
+	for held := false; !held; time.Sleep(time.Millisecond) {
+		// Wait for the outbox to take in the rate limit
+		ob.lock.Lock()
+		held = time.Until(ob.next) > 30*time.Millisecond
+		ob.lock.Unlock()
+	}
+	start := time.Now()
+	if err := ob.Send("b", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < 25*time.Millisecond {
+		t.Errorf("send to another location took %s, want it held back by the rate limit", took)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("rate limited Send() error = %v", err)
+	}
+}
+
+func TestOutboxUnload(t *testing.T) {
+	ob := NewOutbox("outbox-unload", 0)
+	ob.Backoff = time.Hour
+	retrying := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- ob.Send("room", func() error {
+			close(retrying)
+			return RetryAfter(errors.New("down"), 0)
+		})
+	}()
+	<-retrying
+	time.Sleep(10 * time.Millisecond)
+	protocolContexts.Delete("outbox-unload")
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Send() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send() still retrying after the protocol was unloaded")
+	}
+	// Loading the protocol again gives it a new context
+	if err := ob.Send("room", func() error { return nil }); err != nil {
+		t.Errorf("Send() after reload error = %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Permission is a level of trust. Commands require one to be called, and users are granted one per protocol or
+// location. Each level includes every level below it.
+type Permission int
+
+const (
+	// PermissionUser is held by everyone, it's the default for commands.
+	PermissionUser Permission = iota
+	// PermissionModerator is for users trusted to manage a location.
+	PermissionModerator
+	// PermissionAdmin is for users trusted to manage the bot.
+	PermissionAdmin
+)
+
+// String returns the name of the permission as used in the config file.
+func (p Permission) String() string {
+	switch p {
+	case PermissionUser:
+		return "user"
+	case PermissionModerator:
+		return "moderator"
+	case PermissionAdmin:
+		return "admin"
+	}
+	return fmt.Sprintf("permission(%d)", int(p))
+}
+
+// ParsePermission returns the Permission named by s (ex: "admin").
+func ParsePermission(s string) (Permission, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "user", "":
+		return PermissionUser, nil
+	case "moderator", "mod":
+		return PermissionModerator, nil
+	case "admin":
+		return PermissionAdmin, nil
+	}
+	return PermissionUser, fmt.Errorf("unknown permission '%s'", s)
+}
+
+// Permissions stores the permissions granted to users.
+var Permissions *permissionStore
+
+func init() {
+	Permissions = &permissionStore{
+		grants: make(map[string]Permission, 1),
+		lock:   new(sync.RWMutex),
+	}
+}
+
+type permissionStore struct {
+	grants map[string]Permission // key: "protocol/location/user", location is blank for protocol-wide grants
+	lock   *sync.RWMutex
+}
+
+func permissionKey(protocol string, location, user UUID) string {
+	return fmt.Sprintf("%s/%s/%s", protocol, location, user)
+}
+
+// Grant gives user perm on protocol. If location is blank, the grant applies to every location on the protocol.
+func (ps *permissionStore) Grant(protocol string, location, user UUID, perm Permission) {
+	ps.lock.Lock()
+	ps.grants[permissionKey(protocol, location, user)] = perm
+	ps.lock.Unlock()
+}
+
+// Revoke removes a grant made with the same protocol, location, and user.
+func (ps *permissionStore) Revoke(protocol string, location, user UUID) {
+	ps.lock.Lock()
+	delete(ps.grants, permissionKey(protocol, location, user))
+	ps.lock.Unlock()
+}
+
+// Get returns the highest permission user holds in location on protocol.
+func (ps *permissionStore) Get(protocol string, location, user UUID) Permission {
+	ps.lock.RLock()
+	perm := ps.grants[permissionKey(protocol, "", user)]
+	if location != "" {
+		if locPerm := ps.grants[permissionKey(protocol, location, user)]; locPerm > perm {
+			perm = locPerm
+		}
+	}
+	ps.lock.RUnlock()
+	return perm
+}
+
+// Reset removes every grant.
+func (ps *permissionStore) Reset() {
+	ps.lock.Lock()
+	ps.grants = make(map[string]Permission, 1)
+	ps.lock.Unlock()
+}
+
+// HasPermission returns true if sender holds at least perm in the location they're in.
+func HasPermission(sender Sender, perm Permission) bool {
+	if perm <= PermissionUser {
+		return true
+	}
+	var location UUID
+	if loc := sender.Location(); loc != nil {
+		location = loc.UUID()
+	}
+	return Permissions.Get(sender.Protocol(), location, sender.UUID()) >= perm
+}
+
+// configGrant is a grant listed under "permissions.grants" in the config file.
+type configGrant struct {
+	protocol string
+	location UUID
+	user     UUID
+	perm     Permission
+}
+
+// configGrants returns the grants listed under "permissions.grants" in tree, keyed by permissionKey. Invalid grants
+// are logged and skipped if logInvalid is true, otherwise they're skipped silently.
+func configGrants(tree *toml.Tree, logInvalid bool) map[string]*configGrant {
+	all := make(map[string]*configGrant)
+	grants, ok := tree.Get("permissions.grants").([]*toml.Tree)
+	if !ok {
+		return all
+	}
+	for _, grant := range grants {
+		protocol, _ := grant.Get("protocol").(string)
+		location, _ := grant.Get("location").(string)
+		level, _ := grant.Get("level").(string)
+		users, _ := grant.Get("users").([]interface{})
+		perm, err := ParsePermission(level)
+		if err != nil || protocol == "" {
+			if logInvalid {
+				Error.Printf("Skipping permission grant (protocol: '%s', level: '%s'): invalid protocol or level.\n", protocol, level)
+			}
+			continue
+		}
+		for _, user := range users {
+			if uuid, ok := user.(string); ok {
+				all[permissionKey(protocol, UUID(location), UUID(uuid))] = &configGrant{protocol: protocol,
+					location: UUID(location), user: UUID(uuid), perm: perm}
+			}
+		}
+	}
+	return all
+}
+
+// loadPermissions grants the permissions listed under "permissions.grants" in tree.
+func loadPermissions(tree *toml.Tree) {
+	for _, grant := range configGrants(tree, true) {
+		Permissions.Grant(grant.protocol, grant.location, grant.user, grant.perm)
+	}
+}
+
+// reloadPermissions applies the changes to "permissions.grants" between old and new. Only grants removed from the
+// config file are revoked, and only new or changed grants are made, so grants made elsewhere (Ex: by a protocol for
+// its admin) are kept.
+func reloadPermissions(old, new *toml.Tree) {
+	oldGrants, newGrants := configGrants(old, false), configGrants(new, true)
+	for key, grant := range oldGrants {
+		if _, ok := newGrants[key]; !ok {
+			Permissions.Revoke(grant.protocol, grant.location, grant.user)
+		}
+	}
+	for key, grant := range newGrants {
+		if oldGrant, ok := oldGrants[key]; !ok || oldGrant.perm != grant.perm {
+			Permissions.Grant(grant.protocol, grant.location, grant.user, grant.perm)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"testing"
+
+	"github.com/pelletier/go-toml"
+)
+
+func TestReloadPermissions(t *testing.T) {
+	t.Cleanup(Permissions.Reset)
+	old, err := toml.Load(`[[permissions.grants]]
+protocol = "discord"
+level = "moderator"
+users = ["mod", "removed"]
+
+[[permissions.grants]]
+protocol = "matrix"
+location = "!room:example.org"
+level = "moderator"
+users = ["@promoted:example.org"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := toml.Load(`[[permissions.grants]]
+protocol = "discord"
+level = "moderator"
+users = ["mod", "added"]
+
+[[permissions.grants]]
+protocol = "matrix"
+location = "!room:example.org"
+level = "admin"
+users = ["@promoted:example.org"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadPermissions(old)
+	Permissions.Grant("discord", "", "owner", PermissionAdmin) // Granted by the protocol, not the config
+	reloadPermissions(old, new)
+
+	tests := []struct {
+		protocol string
+		location UUID
+		user     UUID
+		want     Permission
+	}{
+		{"discord", "", "owner", PermissionAdmin},
+		{"discord", "", "mod", PermissionModerator},
+		{"discord", "", "removed", PermissionUser},
+		{"discord", "", "added", PermissionModerator},
+		{"matrix", "!room:example.org", "@promoted:example.org", PermissionAdmin},
+		{"matrix", "!other:example.org", "@promoted:example.org", PermissionUser},
+	}
+	for _, test := range tests {
+		if got := Permissions.Get(test.protocol, test.location, test.user); got != test.want {
+			t.Errorf("Get(%q, %q, %q) = %s, want %s", test.protocol, test.location, test.user, got, test.want)
+		}
+	}
+}
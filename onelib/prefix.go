@@ -0,0 +1,70 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// prefixTable is the DB table holding per-location prefixes.
+	prefixTable = "onelib_prefixes"
+	// maxPrefixLength is the longest prefix allowed to be set via SetPrefix.
+	maxPrefixLength = 16
+)
+
+// MentionPrefix is true if protocols should accept mentioning the bot as a prefix (Ex: "@OneBot say Hello").
+var MentionPrefix = true
+
+func locationPrefixKey(protocol string, location UUID) string {
+	return fmt.Sprintf("%s/%s", protocol, location)
+}
+
+// GetPrefix returns the prefix used to trigger commands in location on protocol. A prefix set for the location takes
+// priority, followed by one set for the protocol (in the DB, then the config file as "prefix" under the protocol),
+// falling back on DefaultPrefix.
+func GetPrefix(protocol string, location UUID) string {
+	if location != "" {
+		if prefix, _ := Db.GetString(prefixTable, locationPrefixKey(protocol, location)); prefix != "" {
+			return prefix
+		}
+	}
+	if prefix := GetTextConfig(protocol, "prefix"); prefix != "" {
+		return prefix
+	}
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return DefaultPrefix
+}
+
+// SetPrefix sets the prefix used to trigger commands in location on protocol, saving it to the DB. If location is
+// blank, the prefix is set for every location on the protocol without their own prefix. If prefix is blank, the
+// prefix is reset, falling back on the next prefix in line (see GetPrefix).
+func SetPrefix(protocol string, location UUID, prefix string) error {
+	if strings.ContainsAny(prefix, " \t\r\n") {
+		return fmt.Errorf("prefix can't contain whitespace")
+	}
+	if len(prefix) > maxPrefixLength {
+		return fmt.Errorf("prefix can't be longer than %d characters", maxPrefixLength)
+	}
+	if location == "" {
+		if prefix == "" {
+			return Db.Remove(protocol, "prefix")
+		}
+		return Db.PutString(protocol, "prefix", prefix)
+	}
+	if prefix == "" {
+		return Db.Remove(prefixTable, locationPrefixKey(protocol, location))
+	}
+	return Db.PutString(prefixTable, locationPrefixKey(protocol, location), prefix)
+}
+
+// SenderPrefix returns the prefix used to trigger commands in the location sender is in.
+func SenderPrefix(sender Sender) string {
+	var location UUID
+	if loc := sender.Location(); loc != nil {
+		location = loc.UUID()
+	}
+	return GetPrefix(sender.Protocol(), location)
+}
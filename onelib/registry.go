@@ -0,0 +1,46 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"sync"
+)
+
+// Plugins and protocols compiled into the binary register themselves here (see tools/gen_static.sh), and are loaded
+// from here before looking for a .so file.
+var (
+	staticPlugins   = make(map[string]func() Plugin)
+	staticProtocols = make(map[string]func() Protocol)
+	staticLock      = new(sync.RWMutex)
+)
+
+// RegisterPlugin registers the Load function of a plugin compiled into the binary, so LoadPlugin can load it by name
+// without opening a .so file. It's usually called from init().
+func RegisterPlugin(name string, load func() Plugin) {
+	staticLock.Lock()
+	staticPlugins[name] = load
+	staticLock.Unlock()
+}
+
+// RegisterProtocol registers the Load function of a protocol compiled into the binary, so LoadProtocol can load it by
+// name without opening a .so file. It's usually called from init().
+func RegisterProtocol(name string, load func() Protocol) {
+	staticLock.Lock()
+	staticProtocols[name] = load
+	staticLock.Unlock()
+}
+
+// staticPlugin returns the Load function of a plugin registered with RegisterPlugin, or nil if it isn't registered.
+func staticPlugin(name string) func() Plugin {
+	staticLock.RLock()
+	defer staticLock.RUnlock()
+	return staticPlugins[name]
+}
+
+// staticProtocol returns the Load function of a protocol registered with RegisterProtocol, or nil if it isn't
+// registered.
+func staticProtocol(name string) func() Protocol {
+	staticLock.RLock()
+	defer staticLock.RUnlock()
+	return staticProtocols[name]
+}
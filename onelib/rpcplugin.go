@@ -0,0 +1,813 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+/* RPC PLUGIN SPEC
+
+RPC plugins run as a child process, speaking JSON-RPC 2.0 over stdio, one JSON object per line. Anything the plugin
+writes to stderr is logged. See plugins/rpc/README.md for the full list of methods and notifications.
+
+*/
+
+const (
+	// RPCProtocolVersion is the version of the protocol spoken with RPC plugins, sent on initialize.
+	RPCProtocolVersion = 1
+
+	// rpcCallTimeout is how long to wait on a plugin to answer initialize or shutdown.
+	rpcCallTimeout = 10 * time.Second
+	// rpcMaxRestartDelay is the longest to wait before restarting a plugin which keeps exiting.
+	rpcMaxRestartDelay = time.Minute
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// RPCPluginConfig describes how to start an RPC plugin, as read from "[[rpc_plugins]]" in the config file.
+type RPCPluginConfig struct {
+	Name    string   // The name of the plugin, used in the plugin map
+	Command []string // The program to run, followed by its arguments (ex: ["python3", "plugins/rpc/example.py"])
+}
+
+// RPCPluginLoadList is the list of RPC plugins to load on startup.
+var RPCPluginLoadList []*RPCPluginConfig
+
+// loadRPCPluginConfig reads the RPC plugins to load from the config file.
+func loadRPCPluginConfig() {
+	plugins, ok := configGet("rpc_plugins").([]*toml.Tree)
+	if !ok {
+		return
+	}
+	RPCPluginLoadList = make([]*RPCPluginConfig, 0, len(plugins))
+	for _, plug := range plugins {
+		name, _ := plug.Get("name").(string)
+		command, _ := plug.Get("command").([]interface{})
+		rpc := &RPCPluginConfig{Name: name, Command: make([]string, 0, len(command))}
+		for _, arg := range command {
+			if s, ok := arg.(string); ok {
+				rpc.Command = append(rpc.Command, s)
+			}
+		}
+		if name == "" || len(rpc.Command) == 0 {
+			Error.Printf("Skipping RPC plugin '%s': a name and command are required.\n", name)
+			continue
+		}
+		RPCPluginLoadList = append(RPCPluginLoadList, rpc)
+	}
+}
+
+// RPCError is an error returned by the other end of an RPC connection.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// rpcMessage is a JSON-RPC 2.0 request, notification, or response.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// rpcConn is one end of a JSON-RPC 2.0 connection.
+type rpcConn struct {
+	w         io.Writer
+	writeLock *sync.Mutex
+	nextID    int64
+	pending   map[int64]chan *rpcMessage
+	closed    bool
+	lock      *sync.Mutex
+}
+
+func newRPCConn(w io.Writer) *rpcConn {
+	return &rpcConn{w: w, writeLock: new(sync.Mutex), pending: make(map[int64]chan *rpcMessage), lock: new(sync.Mutex)}
+}
+
+// write sends a single message, as a line of JSON.
+func (rc *rpcConn) write(msg *rpcMessage) error {
+	msg.JSONRPC = "2.0"
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	rc.writeLock.Lock()
+	defer rc.writeLock.Unlock()
+	_, err = rc.w.Write(append(b, '\n'))
+	return err
+}
+
+// Notify sends a notification, which isn't answered.
+func (rc *rpcConn) Notify(method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return rc.write(&rpcMessage{Method: method, Params: raw})
+}
+
+// Call sends a request and waits for the answer, decoding it into result if it's not nil. If ctx is cancelled first,
+// a "cancel" notification is sent for the request.
+func (rc *rpcConn) Call(ctx context.Context, method string, params, result interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	id := atomic.AddInt64(&rc.nextID, 1)
+	ch := make(chan *rpcMessage, 1)
+	rc.lock.Lock()
+	if rc.closed {
+		rc.lock.Unlock()
+		return fmt.Errorf("connection closed")
+	}
+	rc.pending[id] = ch
+	rc.lock.Unlock()
+	defer func() {
+		rc.lock.Lock()
+		delete(rc.pending, id)
+		rc.lock.Unlock()
+	}()
+
+	if err = rc.write(&rpcMessage{ID: &id, Method: method, Params: raw}); err != nil {
+		return err
+	}
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return fmt.Errorf("connection closed")
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	case <-ctx.Done():
+		rc.Notify("cancel", map[string]int64{"id": id})
+		return ctx.Err()
+	}
+}
+
+// respond answers the request with id, sending an error instead if err isn't nil.
+func (rc *rpcConn) respond(id *int64, result interface{}, err error) {
+	if id == nil {
+		return
+	}
+	resp := &rpcMessage{ID: id}
+	if err != nil {
+		rpcErr, ok := err.(*RPCError)
+		if !ok {
+			rpcErr = &RPCError{Code: rpcInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	} else {
+		if result == nil {
+			result = struct{}{}
+		}
+		if resp.Result, err = json.Marshal(result); err != nil {
+			resp.Error = &RPCError{Code: rpcInternalError, Message: err.Error()}
+		}
+	}
+	if err = rc.write(resp); err != nil {
+		Debug.Println("Failed to write RPC response:", err)
+	}
+}
+
+// Serve reads messages from r until it's closed, passing answers to the waiting calls, and requests and notifications
+// to handle. handle is called in a new goroutine for requests, and in order for notifications.
+func (rc *rpcConn) Serve(r io.Reader, handle func(method string, params json.RawMessage) (interface{}, error)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		msg := new(rpcMessage)
+		if err := json.Unmarshal(scanner.Bytes(), msg); err != nil {
+			Debug.Println("Failed to parse RPC message:", err)
+			continue
+		}
+		if msg.Method == "" {
+			if msg.ID == nil {
+				continue
+			}
+			rc.lock.Lock()
+			ch := rc.pending[*msg.ID]
+			rc.lock.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+			continue
+		}
+		if msg.ID == nil {
+			handle(msg.Method, msg.Params)
+			continue
+		}
+		go func(msg *rpcMessage) {
+			result, err := handle(msg.Method, msg.Params)
+			rc.respond(msg.ID, result, err)
+		}(msg)
+	}
+	rc.lock.Lock()
+	rc.closed = true
+	for id, ch := range rc.pending {
+		close(ch)
+		delete(rc.pending, id)
+	}
+	rc.lock.Unlock()
+}
+
+// rpcLocation is a Location as it's sent to RPC plugins.
+type rpcLocation struct {
+	UUID        UUID   `json:"uuid"`
+	DisplayName string `json:"display_name"`
+	Protocol    string `json:"protocol"`
+}
+
+func newRPCLocation(location Location) *rpcLocation {
+	if location == nil {
+		return nil
+	}
+	return &rpcLocation{UUID: location.UUID(), DisplayName: location.DisplayName(), Protocol: location.Protocol()}
+}
+
+// rpcSender is a Sender as it's sent to RPC plugins.
+type rpcSender struct {
+	UUID        UUID         `json:"uuid"`
+	Username    string       `json:"username"`
+	DisplayName string       `json:"display_name"`
+	Protocol    string       `json:"protocol"`
+	Self        bool         `json:"self"`
+	Location    *rpcLocation `json:"location"`
+}
+
+func newRPCSender(sender Sender) *rpcSender {
+	if sender == nil {
+		return nil
+	}
+	return &rpcSender{UUID: sender.UUID(), Username: sender.Username(), DisplayName: sender.DisplayName(),
+		Protocol: sender.Protocol(), Self: sender.Self(), Location: newRPCLocation(sender.Location())}
+}
+
+// rpcEmoji is an Emoji as it's sent to RPC plugins.
+type rpcEmoji struct {
+	ID    UUID   `json:"id"`
+	Name  string `json:"name"`
+	Added bool   `json:"added"`
+}
+
+// rpcMsg is a Message as it's sent to RPC plugins.
+type rpcMsg struct {
+	UUID          UUID             `json:"uuid"`
+	Text          string           `json:"text"`
+	FormattedText string           `json:"formatted_text"`
+	Mentioned     bool             `json:"mentioned"`
+	Reaction      *rpcEmoji        `json:"reaction,omitempty"`
+	ReplyTo       UUID             `json:"reply_to,omitempty"`
+	Thread        UUID             `json:"thread,omitempty"`
+	Attachments   []*rpcAttachment `json:"attachments,omitempty"`
+	Mentions      []*rpcMention    `json:"mentions,omitempty"`
+}
+
+// rpcMention is a Mention as it's sent to RPC plugins.
+type rpcMention struct {
+	Type        string `json:"type"`
+	UUID        UUID   `json:"uuid"`
+	DisplayName string `json:"display_name"`
+}
+
+// rpcAttachment is an Attachment as it's sent to RPC plugins.
+type rpcAttachment struct {
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	URL      string `json:"url"`
+	Alt      string `json:"alt,omitempty"`
+}
+
+// rpcSent is a SentMessage as it's sent to RPC plugins.
+type rpcSent struct {
+	UUID     UUID   `json:"uuid"`
+	Parts    []UUID `json:"parts,omitempty"`
+	Location UUID   `json:"location"`
+	Protocol string `json:"protocol"`
+	Time     string `json:"time"` // RFC 3339
+}
+
+func newRPCSent(sent *SentMessage) *rpcSent {
+	if sent == nil {
+		return nil
+	}
+	return &rpcSent{UUID: sent.UUID, Parts: sent.Parts, Location: sent.Location, Protocol: sent.Protocol, Time: sent.Time.Format(time.RFC3339)}
+}
+
+func newRPCMsg(msg Message) *rpcMsg {
+	if msg == nil {
+		return nil
+	}
+	m := &rpcMsg{UUID: msg.UUID(), Text: msg.Text(), FormattedText: msg.FormattedText(), Mentioned: msg.Mentioned()}
+	if emoji := msg.Reaction(); emoji != nil {
+		m.Reaction = &rpcEmoji{ID: emoji.ID, Name: emoji.Name, Added: emoji.Added}
+	}
+	m.ReplyTo, m.Thread = ReplyTo(msg)
+	for _, a := range Attachments(msg) {
+		m.Attachments = append(m.Attachments, &rpcAttachment{Name: a.Name, MIMEType: a.MIMEType, Size: a.Size, URL: a.URL, Alt: a.Alt})
+	}
+	for _, mention := range Mentions(msg) {
+		m.Mentions = append(m.Mentions, &rpcMention{Type: rpcMentionTypes[mention.Type], UUID: mention.UUID, DisplayName: mention.DisplayName})
+	}
+	return m
+}
+
+// newRPCArgs returns the parsed args of a command call as they're sent to RPC plugins. Durations are sent in Go's
+// format (ex: "1h30m0s"), and ints given "all" are sent as "all".
+func newRPCArgs(args *Args) map[string]interface{} {
+	values := make(map[string]interface{}, len(args.values))
+	for name, value := range args.values {
+		switch v := value.(type) {
+		case allValue:
+			values[name] = "all"
+		case time.Duration:
+			values[name] = v.String()
+		default:
+			values[name] = v
+		}
+	}
+	return values
+}
+
+var (
+	rpcArgTypes = map[string]ArgType{"string": ArgString, "text": ArgText, "int": ArgInt, "duration": ArgDuration,
+		"user": ArgUser, "role": ArgRole, "location": ArgLocation, "cid": ArgCID}
+	rpcScopes         = map[string]RateLimitScope{"user": ScopeUser, "location": ScopeLocation, "global": ScopeGlobal}
+	rpcPresenceTypes  = []string{"status", "join", "leave", "invite", "kick", "ban"}
+	rpcLocationUpdate = []string{"topic", "name"}
+	rpcMentionTypes   = []string{"user", "role", "location"}
+)
+
+// rpcArg is an Arg as it's described by RPC plugins.
+type rpcArg struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Optional bool   `json:"optional"`
+	Default  string `json:"default"`
+	Min      *int   `json:"min"`
+	Max      *int   `json:"max"`
+	AllowAll bool   `json:"allow_all"`
+}
+
+// rpcRateLimit is a RateLimit as it's described by RPC plugins.
+type rpcRateLimit struct {
+	Scope string `json:"scope"`
+	Burst int    `json:"burst"`
+	Per   string `json:"per"`
+}
+
+// rpcCommandSpec is a CommandSpec as it's described by RPC plugins.
+type rpcCommandSpec struct {
+	Name        string          `json:"name"`
+	Aliases     []string        `json:"aliases"`
+	Description string          `json:"description"`
+	Usage       string          `json:"usage"`
+	Args        []*rpcArg       `json:"args"`
+	Permission  string          `json:"permission"`
+	RateLimits  []*rpcRateLimit `json:"rate_limits"`
+	Hidden      bool            `json:"hidden"`
+	Timeout     string          `json:"timeout"`
+}
+
+// spec converts the description into a CommandSpec, calling command when triggered.
+func (rs *rpcCommandSpec) spec(command ContextCommand) (*CommandSpec, error) {
+	spec := &CommandSpec{Name: rs.Name, Aliases: rs.Aliases, Description: rs.Description, Usage: rs.Usage,
+		Hidden: rs.Hidden, ContextCommand: command}
+	if rs.Name == "" {
+		return nil, fmt.Errorf("command has no name")
+	}
+	var err error
+	if spec.Permission, err = ParsePermission(rs.Permission); err != nil {
+		return nil, err
+	}
+	if rs.Timeout != "" {
+		if spec.Timeout, err = time.ParseDuration(rs.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	for _, arg := range rs.Args {
+		argType, ok := rpcArgTypes[arg.Type]
+		if !ok && arg.Type != "" {
+			return nil, fmt.Errorf("arg '%s' has unknown type '%s'", arg.Name, arg.Type)
+		}
+		spec.Args = append(spec.Args, &Arg{Name: arg.Name, Type: argType, Optional: arg.Optional, Default: arg.Default,
+			Min: arg.Min, Max: arg.Max, AllowAll: arg.AllowAll})
+	}
+	for _, rl := range rs.RateLimits {
+		scope, ok := rpcScopes[rl.Scope]
+		if !ok && rl.Scope != "" {
+			return nil, fmt.Errorf("rate limit has unknown scope '%s'", rl.Scope)
+		}
+		per, err := time.ParseDuration(rl.Per)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit: %w", err)
+		}
+		spec.RateLimits = append(spec.RateLimits, &RateLimit{Scope: scope, Burst: rl.Burst, Per: per})
+	}
+	return spec, nil
+}
+
+// rpcInitResult is the answer to initialize.
+type rpcInitResult struct {
+	Name     string            `json:"name"`
+	LongName string            `json:"long_name"`
+	Version  string            `json:"version"`
+	Commands []*rpcCommandSpec `json:"commands"`
+	Monitor  []string          `json:"monitor"` // The notifications the plugin wants (ex: "message_with_text")
+}
+
+// RPCPlugin is a plugin running as a child process, see LoadRPCPlugin.
+type RPCPlugin struct {
+	name    string
+	log     *Log
+	command []string
+
+	info    *rpcInitResult
+	specs   []*CommandSpec
+	monitor *Monitor
+	cmd     *exec.Cmd
+	conn    *rpcConn
+	exited  chan struct{} // closed once the current process exits
+	removed bool
+	lock    *sync.RWMutex
+
+	restartLock *sync.Mutex // held while the process is being restarted
+}
+
+// LoadRPCPlugin starts a plugin as a child process running command, and loads it under name. If the process exits, it's
+// restarted until the plugin is unloaded.
+func LoadRPCPlugin(name string, command []string) error {
+	if Plugins.Get(name) != nil {
+		return fmt.Errorf("Plugin '%s' already loaded.", name)
+	}
+	rp := &RPCPlugin{name: name, log: NewLog(name), command: command, lock: new(sync.RWMutex), restartLock: new(sync.Mutex)}
+	if err := rp.start(); err != nil {
+		return err
+	}
+	registerPlugin(name, rp)
+	go rp.watch()
+	return nil
+}
+
+// LoadRPCPlugins loads every RPC plugin in RPCPluginLoadList.
+func LoadRPCPlugins() {
+	for _, rpc := range RPCPluginLoadList {
+		if err := LoadRPCPlugin(rpc.Name, rpc.Command); err != nil {
+			Error.Printf("Failed to load RPC plugin '%s': %v\n", rpc.Name, err)
+		}
+	}
+}
+
+// start starts the process and initializes it.
+func (rp *RPCPlugin) start() error {
+	cmd := exec.Command(rp.command[0], rp.command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	conn := newRPCConn(stdin)
+	exited := make(chan struct{})
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			rp.log.Info.Println(scanner.Text())
+		}
+	}()
+	go func() {
+		conn.Serve(stdout, rp.handle)
+		// Wait closes the pipes, so every read must be done first
+		<-stderrDone
+		cmd.Wait()
+		close(exited)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcCallTimeout)
+	defer cancel()
+	info := new(rpcInitResult)
+	err = conn.Call(ctx, "initialize", map[string]interface{}{"version": RPCProtocolVersion, "name": rp.name}, info)
+	if err != nil {
+		cmd.Process.Kill()
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+	if info.Name == "" {
+		info.Name = rp.name
+	}
+	if info.LongName == "" {
+		info.LongName = info.Name
+	}
+
+	specs := make([]*CommandSpec, 0, len(info.Commands))
+	for _, rs := range info.Commands {
+		spec, err := rs.spec(rp.commandFunc(rs.Name))
+		if err != nil {
+			Error.Printf("Plugin '%s' described an invalid command '%s': %s\n", rp.name, rs.Name, err)
+			continue
+		}
+		specs = append(specs, spec)
+	}
+
+	rp.lock.Lock()
+	rp.info, rp.specs, rp.monitor = info, specs, rp.newMonitor(info.Monitor)
+	rp.cmd, rp.conn, rp.exited = cmd, conn, exited
+	rp.lock.Unlock()
+	return nil
+}
+
+// watch restarts the process whenever it exits, until the plugin is removed.
+func (rp *RPCPlugin) watch() {
+	delay := time.Second
+	for {
+		rp.lock.RLock()
+		exited := rp.exited
+		rp.lock.RUnlock()
+		started := time.Now()
+		<-exited
+		if time.Since(started) > rpcMaxRestartDelay {
+			delay = time.Second
+		}
+		for rp.exitedUnexpectedly(exited) {
+			Error.Printf("RPC plugin '%s' exited, restarting in %s.\n", rp.name, delay)
+			time.Sleep(delay)
+			if delay *= 2; delay > rpcMaxRestartDelay {
+				delay = rpcMaxRestartDelay
+			}
+			if !rp.exitedUnexpectedly(exited) {
+				break
+			}
+			err := rp.Restart()
+			if err == nil {
+				break
+			}
+			Error.Printf("Failed to restart RPC plugin '%s': %s\n", rp.name, err)
+		}
+		rp.lock.RLock()
+		removed := rp.removed
+		rp.lock.RUnlock()
+		if removed {
+			return
+		}
+	}
+}
+
+// exitedUnexpectedly returns true if the process which closed exited is still the current one, and the plugin wasn't
+// removed or restarted since. It waits on any restart in progress.
+func (rp *RPCPlugin) exitedUnexpectedly(exited chan struct{}) bool {
+	rp.restartLock.Lock()
+	defer rp.restartLock.Unlock()
+	rp.lock.RLock()
+	defer rp.lock.RUnlock()
+	return !rp.removed && rp.exited == exited
+}
+
+// Restart stops the process (if it's running), and starts it again, picking up any changes to its commands.
+func (rp *RPCPlugin) Restart() error {
+	rp.restartLock.Lock()
+	defer rp.restartLock.Unlock()
+	return rp.restart()
+}
+
+func (rp *RPCPlugin) restart() error {
+	rp.lock.RLock()
+	removed, oldMonitor := rp.removed, rp.monitor
+	rp.lock.RUnlock()
+	if removed || Plugins.Get(rp.name) != rp {
+		return fmt.Errorf("Plugin '%s' not loaded.", rp.name)
+	}
+	rp.stop()
+	if err := rp.start(); err != nil {
+		return err
+	}
+	Monitors.Delete(oldMonitor)
+	Commands.DeletePlugin(rp.name)
+	registerPlugin(rp.name, rp)
+	return nil
+}
+
+// stop asks the process to shut down, killing it if it doesn't exit in time.
+func (rp *RPCPlugin) stop() {
+	rp.lock.RLock()
+	cmd, conn, exited := rp.cmd, rp.conn, rp.exited
+	rp.lock.RUnlock()
+	select {
+	case <-exited:
+		return
+	default:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcCallTimeout)
+	defer cancel()
+	if err := conn.Call(ctx, "shutdown", nil, nil); err != nil {
+		Debug.Printf("RPC plugin '%s' didn't shut down cleanly: %s\n", rp.name, err)
+	}
+	if closer, ok := conn.w.(io.Closer); ok {
+		closer.Close()
+	}
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// commandFunc returns a ContextCommand calling command in the process.
+func (rp *RPCPlugin) commandFunc(command string) ContextCommand {
+	return func(ctx context.Context, msg Message, sender Sender) {
+		rp.lock.RLock()
+		conn := rp.conn
+		rp.lock.RUnlock()
+		err := conn.Call(ctx, "command", map[string]interface{}{"command": command, "message": newRPCMsg(msg),
+			"sender": newRPCSender(sender), "args": newRPCArgs(CommandArgs(msg))}, nil)
+		if err != nil && ctx.Err() == nil {
+			Error.Printf("RPC plugin '%s' failed to run command '%s': %s\n", rp.name, command, err)
+		}
+	}
+}
+
+// notify sends a notification to the process, logging any error.
+func (rp *RPCPlugin) notify(method string, params interface{}) {
+	rp.lock.RLock()
+	conn := rp.conn
+	rp.lock.RUnlock()
+	if err := conn.Notify(method, params); err != nil {
+		Debug.Printf("Failed to notify RPC plugin '%s' of %s: %s\n", rp.name, method, err)
+	}
+}
+
+// newMonitor returns a monitor forwarding the events named in events to the process.
+func (rp *RPCPlugin) newMonitor(events []string) *Monitor {
+	mon := new(Monitor)
+	for _, event := range events {
+		event := event
+		switch event {
+		case "message":
+			mon.OnMessage = func(from Sender, msg Message) {
+				rp.notify(event, map[string]interface{}{"sender": newRPCSender(from), "message": newRPCMsg(msg)})
+			}
+		case "message_with_text":
+			mon.OnMessageWithText = func(from Sender, msg Message) {
+				rp.notify(event, map[string]interface{}{"sender": newRPCSender(from), "message": newRPCMsg(msg)})
+			}
+		case "message_update":
+			mon.OnMessageUpdate = func(from Sender, update Message) {
+				rp.notify(event, map[string]interface{}{"sender": newRPCSender(from), "message": newRPCMsg(update)})
+			}
+		case "message_edit":
+			mon.OnMessageEdit = func(from Sender, edit *MessageEdit) {
+				rp.notify(event, map[string]interface{}{"sender": newRPCSender(from), "old": newRPCMsg(edit.Old),
+					"new": newRPCMsg(edit.New)})
+			}
+		case "message_delete":
+			mon.OnMessageDelete = func(from Location, del *MessageDelete) {
+				rp.notify(event, map[string]interface{}{"location": newRPCLocation(from), "uuid": del.UUID,
+					"old": newRPCMsg(del.Old), "sender": newRPCSender(del.Sender), "by": del.By})
+			}
+		case "presence_update":
+			mon.OnPresenceUpdate = func(from Sender, update *PresenceUpdate) {
+				rp.notify(event, map[string]interface{}{"sender": newRPCSender(from),
+					"type": rpcPresenceTypes[update.Type], "status": update.Status, "status_text": update.StatusText,
+					"by": update.By, "reason": update.Reason})
+			}
+		case "location_update":
+			mon.OnLocationUpdate = func(from Location, update *LocationUpdate) {
+				rp.notify(event, map[string]interface{}{"location": newRPCLocation(from),
+					"type": rpcLocationUpdate[update.Type], "old": update.Old, "new": update.New, "by": update.By})
+			}
+		default:
+			Error.Printf("RPC plugin '%s' asked to monitor unknown event '%s'.\n", rp.name, event)
+		}
+	}
+	return mon
+}
+
+// handle answers requests and notifications sent by the process.
+func (rp *RPCPlugin) handle(method string, raw json.RawMessage) (interface{}, error) {
+	var params struct {
+		Protocol      string `json:"protocol"`
+		Location      UUID   `json:"location"`
+		Text          string `json:"text"`
+		FormattedText string `json:"formatted_text"`
+		Key           string `json:"key"`
+		Level         string `json:"level"`
+		Message       string `json:"message"`
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, &RPCError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+	}
+	switch method {
+	case "send_text", "send_formatted_text":
+		proto := Protocols.Get(params.Protocol)
+		if proto == nil {
+			return nil, &RPCError{Code: rpcInvalidParams, Message: fmt.Sprintf("protocol '%s' not loaded", params.Protocol)}
+		}
+		var (
+			sent *SentMessage
+			err  error
+		)
+		if method == "send_text" {
+			sent, err = proto.SendText(params.Location, params.Text)
+		} else {
+			sent, err = proto.SendFormattedText(params.Location, params.Text, params.FormattedText)
+		}
+		if err != nil {
+			return nil, &RPCError{Code: rpcInternalError, Message: err.Error()}
+		}
+		return newRPCSent(sent), nil
+	case "get_config":
+		return GetTextConfig(rp.name, params.Key), nil
+	case "log":
+		switch params.Level {
+		case "error":
+			rp.log.Error.Println(params.Message)
+		case "debug":
+			rp.log.Debug.Println(params.Message)
+		default:
+			rp.log.Info.Println(params.Message)
+		}
+		return nil, nil
+	}
+	return nil, &RPCError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method '%s' not found", method)}
+}
+
+// Name returns the name the plugin was loaded under.
+func (rp *RPCPlugin) Name() string {
+	return rp.name
+}
+
+// LongName returns the display name given by the plugin.
+func (rp *RPCPlugin) LongName() string {
+	rp.lock.RLock()
+	defer rp.lock.RUnlock()
+	return rp.info.LongName
+}
+
+// Version returns the version given by the plugin.
+func (rp *RPCPlugin) Version() string {
+	rp.lock.RLock()
+	defer rp.lock.RUnlock()
+	return rp.info.Version
+}
+
+// Implements returns the monitor forwarding events to the plugin, its commands are returned by CommandSpecs.
+func (rp *RPCPlugin) Implements() (map[string]Command, *Monitor) {
+	rp.lock.RLock()
+	defer rp.lock.RUnlock()
+	return nil, rp.monitor
+}
+
+// CommandSpecs returns the commands described by the plugin.
+func (rp *RPCPlugin) CommandSpecs() []*CommandSpec {
+	rp.lock.RLock()
+	defer rp.lock.RUnlock()
+	return rp.specs
+}
+
+// Remove stops the process, it won't be restarted.
+func (rp *RPCPlugin) Remove() {
+	rp.lock.Lock()
+	rp.removed = true
+	rp.lock.Unlock()
+	rp.stop()
+}
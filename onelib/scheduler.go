@@ -0,0 +1,344 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+package onelib
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// jobTable is the DB table holding persisted jobs.
+	jobTable = "onelib_jobs"
+	// schedulerTick is how often the scheduler checks for jobs which are due, and the shortest interval allowed.
+	schedulerTick = time.Second
+)
+
+// Scheduler runs jobs on a schedule, see Job.
+var Scheduler = NewJobScheduler()
+
+// JobFunc is called when a job is due. ctx is cancelled if the job's owner is unloaded, or OneBot shuts down. A
+// returned error is logged, and kept in the job's LastError.
+type JobFunc func(ctx context.Context, job *Job) error
+
+// Job is work scheduled to run on a cron expression, at a fixed interval, or once. Jobs call a handler registered by
+// their owner with JobScheduler.Handle, so jobs can be saved to the DB, and picked up by the handler once it's
+// registered again after a restart.
+type Job struct {
+	ID        string        // Unique identifier for the job, generated by Schedule if blank
+	Owner     string        // The name of the plugin or protocol the job belongs to (ex: "bluesky")
+	Handler   string        // The name of the handler to call, registered by the owner (ex: "syncfollowers")
+	Cron      string        // A cron expression to run on, in local time (ex: "0 9 * * mon"), see ParseCron
+	Every     time.Duration // An interval to run on, used if Cron is blank
+	At        time.Time     // When to run once, used if Cron and Every are blank
+	Data      string        // Passed to the handler (ex: text to post)
+	Protocol  string        // The protocol the job was scheduled from, if any
+	Location  UUID          // The location the job was scheduled from, if any
+	Persist   bool          // If true, the job is saved to the DB and survives restarts
+	Next      time.Time     // When the job runs next, set by Schedule
+	Last      time.Time     // When the job last ran
+	Runs      int           // The number of times the job has run
+	LastError string        // The error returned by the last run, if any
+}
+
+// Describe returns the job's schedule in words (Ex: "every 1h0m0s").
+func (job *Job) Describe() string {
+	switch {
+	case job.Cron != "":
+		return fmt.Sprintf("on cron '%s'", job.Cron)
+	case job.Every > 0:
+		return fmt.Sprintf("every %s", job.Every)
+	}
+	return fmt.Sprintf("once at %s", job.At.Local().Format("2006-01-02 15:04"))
+}
+
+// next returns when the job should run after now, or the zero time if it shouldn't run again.
+func (job *Job) next(now time.Time) (time.Time, error) {
+	switch {
+	case job.Cron != "":
+		cron, err := ParseCron(job.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		next := cron.Next(now.Local())
+		if next.IsZero() {
+			return next, fmt.Errorf("cron expression '%s' never matches", job.Cron)
+		}
+		return next, nil
+	case job.Every > 0:
+		if job.Every < schedulerTick {
+			return time.Time{}, fmt.Errorf("interval must be at least %s", schedulerTick)
+		}
+		// Keep to the original schedule unless runs were missed
+		if next := job.Next.Add(job.Every); !job.Next.IsZero() && next.After(now) {
+			return next, nil
+		}
+		return now.Add(job.Every), nil
+	case job.At.IsZero():
+		return time.Time{}, fmt.Errorf("job has no schedule, set one of Cron, Every, or At")
+	case job.Runs > 0:
+		return time.Time{}, nil
+	}
+	return job.At, nil
+}
+
+// storedJobs is how persisted jobs are stored in the DB.
+type storedJobs struct {
+	Jobs []*Job
+}
+
+// JobScheduler is a concurrent-safe scheduler, running jobs once they're due.
+type JobScheduler struct {
+	jobs     map[string]*Job
+	handlers map[string]JobFunc            // keyed by "owner/handler"
+	running  map[string]context.CancelFunc // keyed by job ID
+	started  bool
+	lock     *sync.Mutex
+}
+
+// NewJobScheduler returns a new concurrent-safe JobScheduler. It doesn't run jobs until started.
+func NewJobScheduler() *JobScheduler {
+	return &JobScheduler{jobs: make(map[string]*Job), handlers: make(map[string]JobFunc),
+		running: make(map[string]context.CancelFunc), lock: new(sync.Mutex)}
+}
+
+func handlerKey(owner, handler string) string {
+	return owner + "/" + handler
+}
+
+// Handle registers fn to be called for jobs owned by owner with the handler name handler. Handlers, and any jobs which
+// aren't persisted, are removed when the owner is unloaded.
+func (js *JobScheduler) Handle(owner, handler string, fn JobFunc) {
+	js.lock.Lock()
+	js.handlers[handlerKey(owner, handler)] = fn
+	js.lock.Unlock()
+}
+
+// Schedule adds job to the scheduler, replacing any job with the same ID. The job runs once it's due, and its
+// handler is registered.
+func (js *JobScheduler) Schedule(job *Job) error {
+	if job.Owner == "" || job.Handler == "" {
+		return fmt.Errorf("job must have an owner and handler")
+	}
+	job.Next, job.Runs = time.Time{}, 0
+	next, err := job.next(time.Now())
+	if err != nil {
+		return err
+	}
+	job.Next = next
+
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	if job.ID == "" {
+		job.ID = js.newID()
+	}
+	old := js.jobs[job.ID]
+	js.jobs[job.ID] = job
+	if job.Persist || (old != nil && old.Persist) {
+		js.save()
+	}
+	return nil
+}
+
+// newID returns a short, unused job ID. js.lock must be held.
+func (js *JobScheduler) newID() string {
+	b := make([]byte, 4)
+	for {
+		rand.Read(b)
+		if id := hex.EncodeToString(b); js.jobs[id] == nil {
+			return id
+		}
+	}
+}
+
+// Unschedule removes the job with id, cancelling it if it's running. It returns an error if there's no such job.
+func (js *JobScheduler) Unschedule(id string) error {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	job := js.jobs[id]
+	if job == nil {
+		return fmt.Errorf("job '%s' not found", id)
+	}
+	delete(js.jobs, id)
+	if cancel := js.running[id]; cancel != nil {
+		cancel()
+	}
+	if job.Persist {
+		js.save()
+	}
+	return nil
+}
+
+// Get returns a copy of the job with id, or nil if there's no such job.
+func (js *JobScheduler) Get(id string) *Job {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	if job := js.jobs[id]; job != nil {
+		jobCopy := *job
+		return &jobCopy
+	}
+	return nil
+}
+
+// List returns a copy of every job, sorted by when they run next.
+func (js *JobScheduler) List() []*Job {
+	js.lock.Lock()
+	jobs := make([]*Job, 0, len(js.jobs))
+	for _, job := range js.jobs {
+		jobCopy := *job
+		jobs = append(jobs, &jobCopy)
+	}
+	js.lock.Unlock()
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Next.Equal(jobs[j].Next) {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return jobs[i].Next.Before(jobs[j].Next)
+	})
+	return jobs
+}
+
+// Running returns true if the job with id is currently running.
+func (js *JobScheduler) Running(id string) bool {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	return js.running[id] != nil
+}
+
+// DeleteOwner removes every handler registered by owner, and every job of theirs which isn't persisted, cancelling any
+// of their jobs which are running. Persisted jobs wait until the owner registers their handler again.
+func (js *JobScheduler) DeleteOwner(owner string) {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	for key := range js.handlers {
+		if len(key) > len(owner) && key[:len(owner)+1] == owner+"/" {
+			delete(js.handlers, key)
+		}
+	}
+	for id, job := range js.jobs {
+		if job.Owner != owner {
+			continue
+		}
+		if cancel := js.running[id]; cancel != nil {
+			cancel()
+		}
+		if !job.Persist {
+			delete(js.jobs, id)
+		}
+	}
+}
+
+// save writes every persisted job to the DB. js.lock must be held.
+func (js *JobScheduler) save() {
+	stored := &storedJobs{Jobs: make([]*Job, 0, len(js.jobs))}
+	for _, job := range js.jobs {
+		if job.Persist {
+			stored.Jobs = append(stored.Jobs, job)
+		}
+	}
+	if err := Db.PutObj(jobTable, "jobs", stored); err != nil {
+		Error.Println("Failed to save jobs:", err)
+	}
+}
+
+// start loads the persisted jobs from the DB, and starts running jobs once they're due. Jobs which were due while
+// OneBot wasn't running are run right away.
+func (js *JobScheduler) start() {
+	stored := new(storedJobs)
+	if err := Db.GetObj(jobTable, "jobs", stored); err == nil {
+		js.lock.Lock()
+		for _, job := range stored.Jobs {
+			if js.jobs[job.ID] == nil {
+				js.jobs[job.ID] = job
+			}
+		}
+		js.lock.Unlock()
+	}
+
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	if js.started {
+		return
+	}
+	js.started = true
+	go func() {
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rootCtx.Done():
+				return
+			case now := <-ticker.C:
+				js.tick(now)
+			}
+		}
+	}()
+}
+
+// tick runs every job which is due, isn't already running, and has its handler registered.
+func (js *JobScheduler) tick(now time.Time) {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	for id, job := range js.jobs {
+		if job.Next.IsZero() || job.Next.After(now) || js.running[id] != nil {
+			continue
+		}
+		fn := js.handlers[handlerKey(job.Owner, job.Handler)]
+		if fn == nil {
+			continue
+		}
+		ctx, cancel := context.WithCancel(rootCtx)
+		js.running[id] = cancel
+		jobCopy := *job
+		go js.run(ctx, job, &jobCopy, fn)
+	}
+}
+
+// run calls fn for job, then works out when it should run next. jobCopy is passed to fn, so it can't race with the
+// scheduler.
+func (js *JobScheduler) run(ctx context.Context, job, jobCopy *Job, fn JobFunc) {
+	var err error
+	start := time.Now()
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+				PanicsRecovered.Inc("job")
+				Error.Println("panic:", string(debug.Stack()))
+			}
+		}()
+		err = fn(ctx, jobCopy)
+	}()
+
+	js.lock.Lock()
+	defer js.lock.Unlock()
+	if cancel := js.running[job.ID]; cancel != nil {
+		cancel()
+	}
+	delete(js.running, job.ID)
+	if js.jobs[job.ID] != job {
+		return // Unscheduled or replaced while running
+	}
+	job.Last = start
+	job.Runs++
+	job.LastError = ""
+	if err != nil {
+		job.LastError = err.Error()
+		Error.Printf("Job '%s' (%s/%s) failed: %s\n", job.ID, job.Owner, job.Handler, err)
+	}
+	if job.Next, err = job.next(time.Now()); err != nil || job.Next.IsZero() {
+		if err != nil {
+			Error.Printf("Job '%s' (%s/%s) removed: %s\n", job.ID, job.Owner, job.Handler, err)
+		}
+		delete(js.jobs, job.ID)
+	}
+	if job.Persist {
+		js.save()
+	}
+}
@@ -26,8 +26,8 @@ func eightball(msg onelib.Message, sender onelib.Sender) {
 	var formattedText string
 	text := msg.Text()
 	if len(text) < 3 {
-		text = fmt.Sprintf("Predicts the future. Usage: %s8ball `<y/n question>`", onelib.DefaultPrefix)
-		formattedText = fmt.Sprintf("Predicts the future. Usage: <code>%s8ball &lt;y/n question&gt;</code>", onelib.DefaultPrefix)
+		text = fmt.Sprintf("Predicts the future. Usage: %s8ball `<y/n question>`", onelib.SenderPrefix(sender))
+		formattedText = fmt.Sprintf("Predicts the future. Usage: <code>%s8ball &lt;y/n question&gt;</code>", onelib.SenderPrefix(sender))
 	} else {
 		eightballAnswers := []string{"As I see it, yes", "It is certain", "It is decidedly so", "Most likely",
 			"Outlook good", "Signs point to yes", "Without a doubt", "Yes", "Yes, definitely",
@@ -65,6 +65,18 @@ func (eb *EightBallPlugin) Implements() (map[string]onelib.Command, *onelib.Moni
 	return map[string]onelib.Command{"8b": eightball, "8ball": eightball}, nil
 }
 
+// CommandSpecs describes the commands returned by Implements.
+func (eb *EightBallPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:        "8ball",
+			Aliases:     []string{"8b"},
+			Usage:       "<question>",
+			Description: "Predicts the future.",
+		},
+	}
+}
+
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
 func (eb *EightBallPlugin) Remove() {
 }
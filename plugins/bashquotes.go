@@ -91,6 +91,16 @@ func (bp *BashPlugin) Implements() (map[string]onelib.Command, *onelib.Monitor)
 	return map[string]onelib.Command{"bash": bashQuote}, nil
 }
 
+// CommandSpecs describes the commands returned by Implements.
+func (bp *BashPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:        "bash",
+			Description: "Shares a random quote from bash.org.",
+		},
+	}
+}
+
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
 func (bp *BashPlugin) Remove() {
 }
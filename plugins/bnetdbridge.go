@@ -3,7 +3,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"github.com/TheDiscordian/onebot/onelib"
@@ -21,24 +20,33 @@ const (
 )
 
 var (
+	// log tags lines with the name of the plugin
+	log = onelib.NewLog(NAME)
+
 	bnetdChannel string // channel to bridge
-	bnetdDest    string // json `[{"protocol":"matrix","channel":"!example:matrix.thedisco.zone"}]`
+
+	configSchema = &onelib.ConfigSchema{Section: NAME, Keys: []*onelib.ConfigKey{
+		{Name: "channel", Type: onelib.ConfigString, Required: true, Description: "bnetd irc channel to watch."},
+		{Name: "dest", Type: onelib.ConfigTables, Description: "Rooms to bridge with bnetd, each with a protocol and channel."},
+	}}
 
 	monitor *onelib.Monitor
 )
 
 func loadConfig() {
-	bnetdChannel = onelib.GetTextConfig(NAME, "channel")
-	bnetdDest = onelib.GetTextConfig(NAME, "dest")
+	bnetdChannel = onelib.Config(NAME).String("channel")
 }
 
 // Load returns the Plugin object.
 func Load() onelib.Plugin {
+	if err := onelib.RegisterConfig(configSchema); err != nil {
+		panic(err)
+	}
 	loadConfig()
-	channels := make([]*BridgedChannel, 0, 1)
-	err := json.Unmarshal([]byte(bnetdDest), &channels)
-	if err != nil {
-		onelib.Error.Println(err)
+	dest := onelib.Config(NAME).Tables("dest")
+	channels := make([]*BridgedChannel, 0, len(dest))
+	for _, d := range dest {
+		channels = append(channels, &BridgedChannel{Protocol: d.String("protocol"), Channel: d.String("channel")})
 	}
 	return &BNetdBridge{Channels: channels}
 }
@@ -68,20 +76,31 @@ func (bnb *BNetdBridge) Version() string {
 	return VERSION
 }
 
+// OnMessageWithText bridges a message between BNetd and the bridged channels.
 func (bnb *BNetdBridge) OnMessageWithText(from onelib.Sender, msg onelib.Message) {
+	bnb.bridge(from, msg.Text())
+}
+
+// OnMessageEdit bridges an edited message, marking it as edited.
+func (bnb *BNetdBridge) OnMessageEdit(from onelib.Sender, edit *onelib.MessageEdit) {
+	bnb.bridge(from, "(edited) "+edit.New.Text())
+}
+
+// bridge sends text from a user to the other side of the bridge, if it was sent in a bridged channel.
+func (bnb *BNetdBridge) bridge(from onelib.Sender, text string) {
 	if from.Protocol() == "irc_bnetd" {
 		if from.Location().UUID() != onelib.UUID(bnetdChannel) {
 			return
 		}
 		for _, chn := range bnb.Channels {
 			proto := onelib.Protocols.Get(chn.Protocol)
-			proto.SendText(onelib.UUID(chn.Channel), fmt.Sprintf("[%s] %s", from.DisplayName(), msg.Text()))
+			proto.SendText(onelib.UUID(chn.Channel), fmt.Sprintf("[%s] %s", from.DisplayName(), text))
 		}
 	} else {
 		ircBnetd := onelib.Protocols.Get("irc_bnetd")
 		for _, chn := range bnb.Channels {
 			if from.Protocol() == chn.Protocol && from.Location().UUID() == onelib.UUID(chn.Channel) {
-				ircBnetd.SendText(onelib.UUID(bnetdChannel), fmt.Sprintf("[%s] %s", from.DisplayName(), msg.Text()))
+				ircBnetd.SendText(onelib.UUID(bnetdChannel), fmt.Sprintf("[%s] %s", from.DisplayName(), text))
 				return
 			}
 		}
@@ -92,7 +111,7 @@ func (bnb *BNetdBridge) OnMessageWithText(from onelib.Sender, msg onelib.Message
 func (bnb *BNetdBridge) Implements() (map[string]onelib.Command, *onelib.Monitor) {
 	monitor = &onelib.Monitor{
 		OnMessageWithText: bnb.OnMessageWithText,
-		OnMessageUpdate:   bnb.OnMessageWithText,
+		OnMessageEdit:     bnb.OnMessageEdit,
 	}
 	return nil, monitor
 }
@@ -3,11 +3,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/TheDiscordian/onebot/onelib"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"path"
 	"strings"
 	"time"
 )
@@ -21,6 +23,9 @@ const (
 	VERSION = "v0.0.0"
 )
 
+// log tags lines with the name of the plugin
+var log = onelib.NewLog(NAME)
+
 // Load returns the Plugin object.
 func Load() onelib.Plugin {
 	rand.Seed(time.Now().UnixNano())
@@ -90,6 +95,15 @@ func comic(msg onelib.Message, sender onelib.Sender) {
 	url := fmt.Sprintf("https://www.xkcd.com/%d", rand.Intn(max-min+1)+min)
 	title, imageURL, extraText := getComicInfo(url)
 	text := fmt.Sprintf("Your comic: \"%s\": %s\n*%s*", title, url, extraText)
+	if imageURL != "" {
+		attachment := &onelib.Attachment{Name: path.Base(imageURL), URL: imageURL, Alt: extraText}
+		_, err := onelib.SendAttachment(onelib.PluginContext(NAME), sender.Location(), attachment, text)
+		if err == nil {
+			return
+		} else if !errors.Is(err, onelib.ErrNotSupported) {
+			log.Error.Printf("Error sending comic: %s\n", err)
+		}
+	}
 	formattedText := fmt.Sprintf("Your comic: <a href=\"%s\">%s</a> (<a href=\"%s\">Web</a>)<br />\n<i>%s</i>", imageURL, title, url, extraText)
 	sender.Location().SendFormattedText(text, formattedText)
 }
@@ -99,6 +113,16 @@ func (cp *ComicPlugin) Implements() (map[string]onelib.Command, *onelib.Monitor)
 	return map[string]onelib.Command{"comic": comic}, nil
 }
 
+// CommandSpecs describes the commands returned by Implements.
+func (cp *ComicPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:        "comic",
+			Description: "Shares a random XKCD comic, with its flavour text.",
+		},
+	}
+}
+
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
 func (cp *ComicPlugin) Remove() {
 }
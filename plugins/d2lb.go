@@ -3,7 +3,6 @@
 package main
 
 import (
-	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -25,6 +24,9 @@ const (
 )
 
 var (
+	// log tags lines with the name of the plugin
+	log = onelib.NewLog(NAME)
+
 	// Path to ladder.D2DV
 	d2lbLadderPath string
 )
@@ -45,30 +47,21 @@ func formatXp(xp int) string {
 	return p.Sprintf(outMsg, xp)
 }
 
-func createTable(title string, chars []*CharInfo) (text, formattedText string) {
-	text = fmt.Sprintf("Diablo II %s Ladder:\n", title)
-	formattedText = fmt.Sprintf("<strong>Diablo II %s Ladder:</strong><br />\n<table><tr><th> # </th><th> Name </th><th> Class </th><th> Level </th><th> XP </th></tr><br />\n", title)
+// ladderColors highlights the top three characters of a ladder: gold, silver, and bronze.
+var ladderColors = []string{"#C9B037", "#D7D7D7", "#6A3805"}
+
+// createTable returns the title and a table of the characters on a ladder.
+func createTable(title string, chars []*CharInfo) []*onelib.Node {
+	rows := make([][]*onelib.Node, len(chars))
 	for i, char := range chars { // getTitle(c Class, expansion bool, difficulty int, hardcore bool)
-		text += fmt.Sprintf("    %d. %s [%s] Lvl.%d (%sxp)\n", i+1, getTitle(char.Class, char.expansion, char.difficulty, char.hardcore)+char.CharName, classToString(char.Class), char.Level, formatXp(char.Experience))
-		var highlight, highlightCloser string
-		switch i {
-		case 0:
-			highlight = `<font color="#C9B037">`
-			highlightCloser = "</font>"
-		case 1:
-			highlight = `<font color="#D7D7D7">`
-			highlightCloser = "</font>"
-		case 2:
-			highlight = `<font color="#6A3805">`
-			highlightCloser = "</font>"
-		}
-		formattedText += fmt.Sprintf("<tr><td> %s%d%s  </td><th>  <strong>%s%s%s</strong>  </th><td> %s  </td><td> %d  </td><td> %s<br /></td></tr>\n", highlight, i+1, highlightCloser, highlight, getTitle(char.Class, char.expansion, char.difficulty, char.hardcore)+char.CharName, highlightCloser, classToString(char.Class), char.Level, formatXp(char.Experience))
-		if i <= 2 {
-			formattedText += "</font>"
+		rank, name := onelib.Textf("%d.", i+1), onelib.Bold(onelib.Text(getTitle(char.Class, char.expansion, char.difficulty, char.hardcore)+char.CharName))
+		if i < len(ladderColors) {
+			rank, name = onelib.Color(ladderColors[i], rank), onelib.Color(ladderColors[i], name)
 		}
+		rows[i] = []*onelib.Node{rank, name, onelib.Text(classToString(char.Class)), onelib.Textf("%d", char.Level), onelib.Text(formatXp(char.Experience))}
 	}
-	formattedText += "</table>"
-	return
+	header := []*onelib.Node{onelib.Text("#"), onelib.Text("Name"), onelib.Text("Class"), onelib.Text("Level"), onelib.Text("XP")}
+	return []*onelib.Node{onelib.Bold(onelib.Textf("Diablo II %s Ladder:", title)), onelib.Table(header, rows...)}
 }
 
 func d2xpLb(msg onelib.Message, sender onelib.Sender) {
@@ -77,8 +70,7 @@ func d2xpLb(msg onelib.Message, sender onelib.Sender) {
 		lbn = 10
 	}
 	_, _, exp, _ := getLeaderboards(lbn)
-	text, formattedText := createTable("Expansion", exp)
-	sender.Location().SendFormattedText(text, formattedText)
+	onelib.SendDocument(sender.Location(), onelib.NewDocument(createTable("Expansion", exp)...))
 }
 
 func d2xphcLb(msg onelib.Message, sender onelib.Sender) {
@@ -87,8 +79,7 @@ func d2xphcLb(msg onelib.Message, sender onelib.Sender) {
 		lbn = 10
 	}
 	_, _, _, exphc := getLeaderboards(lbn)
-	text, formattedText := createTable("Expansion Hardcore", exphc)
-	sender.Location().SendFormattedText(text, formattedText)
+	onelib.SendDocument(sender.Location(), onelib.NewDocument(createTable("Expansion Hardcore", exphc)...))
 }
 
 func d2Lb(msg onelib.Message, sender onelib.Sender) {
@@ -97,8 +88,7 @@ func d2Lb(msg onelib.Message, sender onelib.Sender) {
 		lbn = 10
 	}
 	d2, _, _, _ := getLeaderboards(lbn)
-	text, formattedText := createTable("Standard", d2)
-	sender.Location().SendFormattedText(text, formattedText)
+	onelib.SendDocument(sender.Location(), onelib.NewDocument(createTable("Standard", d2)...))
 }
 
 func d2hcLb(msg onelib.Message, sender onelib.Sender) {
@@ -107,8 +97,7 @@ func d2hcLb(msg onelib.Message, sender onelib.Sender) {
 		lbn = 10
 	}
 	_, hc, _, _ := getLeaderboards(lbn)
-	text, formattedText := createTable("Standard Hardcore", hc)
-	sender.Location().SendFormattedText(text, formattedText)
+	onelib.SendDocument(sender.Location(), onelib.NewDocument(createTable("Standard Hardcore", hc)...))
 }
 
 func d2AllLb(msg onelib.Message, sender onelib.Sender) {
@@ -117,11 +106,11 @@ func d2AllLb(msg onelib.Message, sender onelib.Sender) {
 		lbn = 3
 	}
 	d2, hc, exp, exphc := getLeaderboards(lbn)
-	text, formattedText := createTable("Standard", d2)
-	text2, formattedText2 := createTable("Standard Hardcore", hc)
-	text3, formattedText3 := createTable("Expansion", exp)
-	text4, formattedText4 := createTable("Expansion Hardcore", exphc)
-	sender.Location().SendFormattedText(text+"\n"+text2+"\n"+text3+"\n"+text4, formattedText+"<br>"+formattedText2+"<br>"+formattedText3+"<br>"+formattedText4)
+	doc := onelib.NewDocument(createTable("Standard", d2)...)
+	doc.Append(onelib.LineBreak()).Append(createTable("Standard Hardcore", hc)...)
+	doc.Append(onelib.LineBreak()).Append(createTable("Expansion", exp)...)
+	doc.Append(onelib.LineBreak()).Append(createTable("Expansion Hardcore", exphc)...)
+	onelib.SendDocument(sender.Location(), doc)
 }
 
 // D2LBPlugin is an object for satisfying the Plugin interface.
@@ -147,6 +136,37 @@ func (dp *D2LBPlugin) Implements() (map[string]onelib.Command, *onelib.Monitor)
 	return map[string]onelib.Command{"d2xp": d2xpLb, "d2": d2Lb, "d2hc": d2hcLb, "d2xphc": d2xphcLb, "d2all": d2AllLb}, nil
 }
 
+// CommandSpecs describes the commands returned by Implements.
+func (dp *D2LBPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:        "d2xp",
+			Usage:       "[count]",
+			Description: "Shows the Diablo II Expansion ladder, up to count (default 10).",
+		},
+		{
+			Name:        "d2",
+			Usage:       "[count]",
+			Description: "Shows the Diablo II Standard ladder, up to count (default 10).",
+		},
+		{
+			Name:        "d2hc",
+			Usage:       "[count]",
+			Description: "Shows the Diablo II Standard Hardcore ladder, up to count (default 10).",
+		},
+		{
+			Name:        "d2xphc",
+			Usage:       "[count]",
+			Description: "Shows the Diablo II Expansion Hardcore ladder, up to count (default 10).",
+		},
+		{
+			Name:        "d2all",
+			Usage:       "[count]",
+			Description: "Shows every Diablo II ladder, up to count (default 3).",
+		},
+	}
+}
+
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
 func (dp *D2LBPlugin) Remove() {
 }
@@ -306,13 +326,13 @@ func getLeaderboards(count int) (norm, hc, exp, expHc []*CharInfo) {
 	}
 	f, err := os.Open(d2lbLadderPath)
 	if err != nil {
-		onelib.Error.Println(err)
+		log.Error.Println(err)
 		return
 	}
 	ladderHeader := new(LadderHeader)
 	err = struc.Unpack(f, ladderHeader)
 	if err != nil {
-		onelib.Error.Println(err)
+		log.Error.Println(err)
 		return
 	}
 
@@ -321,7 +341,7 @@ func getLeaderboards(count int) (norm, hc, exp, expHc []*CharInfo) {
 		ladderIndex := new(LadderIndex)
 		err = struc.Unpack(f, ladderIndex)
 		if err != nil {
-			onelib.Error.Println(err)
+			log.Error.Println(err)
 			return
 		}
 	}
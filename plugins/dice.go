@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"github.com/TheDiscordian/onebot/onelib"
 	"math/rand"
-	"strconv"
 )
 
 const (
@@ -24,19 +23,8 @@ func Load() onelib.Plugin {
 }
 
 func roll(msg onelib.Message, sender onelib.Sender) {
-	var text string
-	droll := 0
-	if mtext := msg.Text(); mtext == "" {
-		droll = 20
-	} else {
-		droll, _ = strconv.Atoi(mtext)
-	}
-	if droll > 1 {
-		text = fmt.Sprintf("You rolled a %d.", rand.Intn(droll)+1)
-	} else {
-		text = fmt.Sprintf("Rolls one die. Usage: %sroll <number of sides> (min 2)", onelib.DefaultPrefix)
-	}
-	sender.Location().SendText(text)
+	sides := onelib.CommandArgs(msg).Int("sides")
+	sender.Location().SendText(fmt.Sprintf("You rolled a %d.", rand.Intn(sides)+1))
 }
 
 // DicePlugin is an object for satisfying the Plugin interface.
@@ -62,6 +50,18 @@ func (dp *DicePlugin) Implements() (map[string]onelib.Command, *onelib.Monitor)
 	return map[string]onelib.Command{"roll": roll, "r": roll}, nil
 }
 
+// CommandSpecs describes the commands returned by Implements.
+func (dp *DicePlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:        "roll",
+			Aliases:     []string{"r"},
+			Args:        []*onelib.Arg{{Name: "sides", Type: onelib.ArgInt, Optional: true, Default: "20", Min: onelib.Bound(2)}},
+			Description: "Rolls one die with the given number of sides (default 20).",
+		},
+	}
+}
+
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
 func (dp *DicePlugin) Remove() {
 }
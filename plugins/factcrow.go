@@ -186,6 +186,17 @@ func (eb *FactCrowPlugin) Implements() (map[string]onelib.Command, *onelib.Monit
 	return map[string]onelib.Command{"fc": factCrow, "fact": factCrow}, nil
 }
 
+// CommandSpecs describes the commands returned by Implements.
+func (eb *FactCrowPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:        "fact",
+			Aliases:     []string{"fc"},
+			Description: `Shares a random "fact".`,
+		},
+	}
+}
+
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
 func (eb *FactCrowPlugin) Remove() {
 }
@@ -46,6 +46,11 @@ func (fp *FirstPlugin) Implements() (map[string]onelib.Command, *onelib.Monitor)
 	return nil, nil
 }
 
+// CommandSpecs optionally describes the commands returned by Implements, for the help command.
+func (fp *FirstPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return nil
+}
+
 // Remove is called when the plugin is about to be terminated.
 func (fp *FirstPlugin) Remove() {
 	/*
@@ -26,6 +26,9 @@ const (
 )
 
 var (
+	// log tags lines with the name of the plugin
+	log = onelib.NewLog(NAME)
+
 	sharedWeb3StorageKey string
 )
 
@@ -63,9 +66,8 @@ type IPFSPeer struct {
 	ID    string
 }
 
-func doRequest(timeout time.Duration, url string, limit int64) ([]byte, error) {
+func doRequest(ctx context.Context, timeout time.Duration, url string, limit int64) ([]byte, error) {
 	var cancel context.CancelFunc
-	ctx := context.Background()
 	if timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
@@ -93,9 +95,8 @@ func doRequest(timeout time.Duration, url string, limit int64) ([]byte, error) {
 	return body, nil
 }
 
-func doWeb3Request(timeout time.Duration, url string, data []byte) ([]byte, error) {
+func doWeb3Request(ctx context.Context, timeout time.Duration, url string, data []byte) ([]byte, error) {
 	var cancel context.CancelFunc
-	ctx := context.Background()
 	if timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
@@ -120,8 +121,8 @@ func doWeb3Request(timeout time.Duration, url string, data []byte) ([]byte, erro
 	return body, nil
 }
 
-func doIPFSCheckRequest(timeout time.Duration, url string) (*IPFSCheckResp, error) {
-	body, err := doRequest(timeout, url, -1)
+func doIPFSCheckRequest(ctx context.Context, timeout time.Duration, url string) (*IPFSCheckResp, error) {
+	body, err := doRequest(ctx, timeout, url, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -135,9 +136,8 @@ func doIPFSCheckRequest(timeout time.Duration, url string) (*IPFSCheckResp, erro
 	return out, nil
 }
 
-func doIPFSFindProvsRequest(timeout time.Duration, url string) (int, error) {
+func doIPFSFindProvsRequest(ctx context.Context, timeout time.Duration, url string) (int, error) {
 	var cancel context.CancelFunc
-	ctx := context.Background()
 	if timeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
@@ -178,16 +178,10 @@ func doIPFSFindProvsRequest(timeout time.Duration, url string) (int, error) {
 	return len(peers), nil
 }
 
-func ipfsDHTFindProvs(msg onelib.Message, sender onelib.Sender) {
-	const USAGE = "Usage: ipfs-findprovs <CID>"
-	txt := msg.Text()
-	if len(txt) <= 1 {
-		sender.Location().SendText(USAGE)
-		return
-	}
-
+func ipfsDHTFindProvs(ctx context.Context, msg onelib.Message, sender onelib.Sender) {
+	txt := onelib.CommandArgs(msg).String("CID")
 	sender.Location().SendText("Checking DHT for " + txt + " (up to 30s)")
-	providers, err := doIPFSFindProvsRequest(time.Second*30, "http://127.0.0.1:5001/api/v0/dht/findprovs?arg="+txt)
+	providers, err := doIPFSFindProvsRequest(ctx, time.Second*30, "http://127.0.0.1:5001/api/v0/dht/findprovs?arg="+txt)
 	if err != nil && providers == 0 {
 		sender.Location().SendText(fmt.Sprintf("No providers found for %s within 30s.", txt))
 		return
@@ -196,16 +190,10 @@ func ipfsDHTFindProvs(msg onelib.Message, sender onelib.Sender) {
 	sender.Location().SendText(fmt.Sprintf("%d providers found for %s.", providers, txt))
 }
 
-func ipfsBlockStat(msg onelib.Message, sender onelib.Sender) {
-	const USAGE = "Usage: ipfs-stat <CID>"
-	txt := msg.Text()
-	if len(txt) <= 1 {
-		sender.Location().SendText(USAGE)
-		return
-	}
-
+func ipfsBlockStat(ctx context.Context, msg onelib.Message, sender onelib.Sender) {
+	txt := onelib.CommandArgs(msg).String("CID")
 	sender.Location().SendText("Trying to stat " + txt + " (up to 30s)")
-	body, err := doRequest(time.Second*30, "http://127.0.0.1:5001/api/v0/block/stat?arg="+txt, -1)
+	body, err := doRequest(ctx, time.Second*30, "http://127.0.0.1:5001/api/v0/block/stat?arg="+txt, -1)
 	if err != nil || string(body) == "" {
 		sender.Location().SendText(fmt.Sprintf("Failed to retrieve %s within 30s.", txt))
 		return
@@ -214,19 +202,12 @@ func ipfsBlockStat(msg onelib.Message, sender onelib.Sender) {
 	sender.Location().SendText(fmt.Sprintf("Successfully retrieved %s.", txt))
 }
 
-func ipfsCheck(msg onelib.Message, sender onelib.Sender) {
+func ipfsCheck(ctx context.Context, msg onelib.Message, sender onelib.Sender) {
 	const USAGE = "Usage: ipfs-check <multiaddr> <CID> [Backend URL]"
-	splitTxt := strings.Split(msg.Text(), " ")
-	if len(splitTxt) < 2 || len(splitTxt) > 3 {
-		sender.Location().SendText(USAGE)
-		return
-	}
-	multiaddr := splitTxt[0]
-	cid := splitTxt[1]
-	backend := "https://ipfs-check-backend.ipfs.io"
-	if len(splitTxt) == 3 {
-		backend = splitTxt[2]
-	}
+	args := onelib.CommandArgs(msg)
+	multiaddr := args.String("multiaddr")
+	cid := args.String("CID")
+	backend := args.String("backend URL")
 	peerIdIndex := strings.LastIndex(multiaddr, "/p2p/")
 	if peerIdIndex < 0 || len(multiaddr)-10 < peerIdIndex {
 		sender.Location().SendText("Multiaddr appears malformed (can't find peerId)")
@@ -235,9 +216,9 @@ func ipfsCheck(msg onelib.Message, sender onelib.Sender) {
 	}
 	// peerId := multiaddr[peerIdIndex+5:]
 	addrPart := multiaddr[:peerIdIndex]
-	out, err := doIPFSCheckRequest(time.Minute, backend+"?multiaddr="+multiaddr+"&cid="+cid)
+	out, err := doIPFSCheckRequest(ctx, time.Minute, backend+"?multiaddr="+multiaddr+"&cid="+cid)
 	if err != nil {
-		onelib.Error.Println("[IPFS] " + err.Error())
+		log.Error.Println(err)
 		sender.Location().SendText("Error parsing response: " + err.Error())
 		return
 	}
@@ -292,29 +273,33 @@ func web3Help(msg onelib.Message, sender onelib.Sender) {
 More features coming soon like being able to set your own API key and bypass the 100MB limit, stay tuned 🚀`)
 }
 
-func web3Store(msg onelib.Message, sender onelib.Sender) {
+func web3Store(ctx context.Context, msg onelib.Message, sender onelib.Sender) {
 	const USAGE = "Usage: web3-store <cid> (100MB limit)"
 	if sharedWeb3StorageKey == "" {
 		sender.Location().SendText("This feature hasn't been enabled by the owner of this bot, please contact them for details.")
 		return
 	}
-	if msg.Text() == "" {
-		sender.Location().SendText(USAGE)
-		return
+	cid := onelib.CommandArgs(msg).String("CID")
+	// Progress is shown by editing the first message, where the protocol supports it
+	progress, _ := sender.Location().SendText("Beginning download of '" + cid + "' 🚀")
+	update := func(text string) {
+		var err error
+		if progress, err = onelib.Update(sender.Location(), progress, text, ""); err != nil {
+			log.Error.Printf("Error updating progress: %s\n", err)
+		}
 	}
-	sender.Location().SendText("Beginning download of '" + msg.Text() + "' 🚀")
-	data, err := doRequest(time.Second*120, "http://127.0.0.1:5001/api/v0/dag/export?arg="+msg.Text(), 100000000) // 100MB limit
+	data, err := doRequest(ctx, time.Second*120, "http://127.0.0.1:5001/api/v0/dag/export?arg="+cid, 100000000) // 100MB limit
 	if err != nil {
-		sender.Location().SendText(fmt.Sprintf("Error exporting CID: %s\n\n%s", err.Error(), USAGE))
+		update(fmt.Sprintf("Error exporting CID: %s\n\n%s", err.Error(), USAGE))
 		return
 	}
-	sender.Location().SendText(fmt.Sprintf("Got %dMiB of data! Uploading to web3.storage...", len(data)/1048576))
-	resp, err := doWeb3Request(time.Second*120, "https://api.web3.storage/car", data)
+	update(fmt.Sprintf("Got %dMiB of data! Uploading to web3.storage...", len(data)/1048576))
+	resp, err := doWeb3Request(ctx, time.Second*120, "https://api.web3.storage/car", data)
 	if err != nil {
-		sender.Location().SendText(fmt.Sprintf("Error uploading CID: %s\n\n%s", err.Error(), USAGE))
+		update(fmt.Sprintf("Error uploading CID: %s\n\n%s", err.Error(), USAGE))
 		return
 	}
-	sender.Location().SendText("Upload complete! web3.storage responded: " + string(resp))
+	update("Upload complete! web3.storage responded: " + string(resp))
 }
 
 // IPFSPlugin is an object for satisfying the Plugin interface.
@@ -335,9 +320,54 @@ func (ip *IPFSPlugin) Version() string {
 	return VERSION
 }
 
-// Implements returns a map of commands and monitor the plugin implements.
+// Implements returns a map of commands and monitor the plugin implements. Commands which take a context are only
+// returned by CommandSpecs.
 func (ip *IPFSPlugin) Implements() (map[string]onelib.Command, *onelib.Monitor) {
-	return map[string]onelib.Command{"ipfs-check": ipfsCheck, "ipfs-findprovs": ipfsDHTFindProvs, "ipfs-stat": ipfsBlockStat, "web3-help": web3Help, "web3-store": web3Store}, nil
+	return map[string]onelib.Command{"web3-help": web3Help}, nil
+}
+
+// CommandSpecs describes the commands returned by Implements.
+func (ip *IPFSPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:           "ipfs-check",
+			ContextCommand: ipfsCheck,
+			Args: []*onelib.Arg{
+				{Name: "multiaddr", Type: onelib.ArgString},
+				{Name: "CID", Type: onelib.ArgCID},
+				{Name: "backend URL", Type: onelib.ArgString, Optional: true, Default: "https://ipfs-check-backend.ipfs.io"},
+			},
+			Description: "Checks if a CID is retrievable from a multiaddr, and advertised in the DHT.",
+			RateLimits:  []*onelib.RateLimit{{Scope: onelib.ScopeUser, Burst: 2, Per: 30 * time.Second}},
+		},
+		{
+			Name:           "ipfs-findprovs",
+			ContextCommand: ipfsDHTFindProvs,
+			Args:           []*onelib.Arg{{Name: "CID", Type: onelib.ArgCID}},
+			Description:    "Counts the providers of a CID in the DHT, using a local Kubo node.",
+		},
+		{
+			Name:           "ipfs-stat",
+			ContextCommand: ipfsBlockStat,
+			Args:           []*onelib.Arg{{Name: "CID", Type: onelib.ArgCID}},
+			Description:    "Checks if a CID can be retrieved by a local Kubo node.",
+		},
+		{
+			Name:        "web3-help",
+			Description: "Explains the web3.storage commands.",
+		},
+		{
+			Name:           "web3-store",
+			ContextCommand: web3Store,
+			Timeout:        5 * time.Minute, // Downloading and uploading can take up to 4 minutes
+			Args:           []*onelib.Arg{{Name: "CID", Type: onelib.ArgCID}},
+			Description:    "Stores up to 100MB on web3.storage.",
+			RateLimits: []*onelib.RateLimit{
+				{Scope: onelib.ScopeUser, Per: 10 * time.Minute},
+				{Scope: onelib.ScopeGlobal, Burst: 3, Per: 5 * time.Minute},
+			},
+		},
+	}
 }
 
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
@@ -3,13 +3,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/TheDiscordian/onebot/libs/onecurrency"
 	"github.com/TheDiscordian/onebot/onelib"
 	"math/rand"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -19,153 +18,78 @@ const (
 	// LONGNAME is what's presented to the user
 	LONGNAME = "Currency Plugin"
 	// VERSION of the plugin
-	VERSION = "v0.0.2"
+	VERSION = "v0.0.3"
 
 	// DEFAULT_CURRENCY is the default currency symbol
 	DEFAULT_CURRENCY = "★"
+
+	// riskTime is the time until "risk" can be called again
+	riskTime = time.Second * 121
+
+	// aliasConfirmTime is how long the target account has to confirm an alias
+	aliasConfirmTime = time.Minute * 5
 )
 
 // TODO command to assign a location to a currency location uuid. Allow it to only be unset by whoever set it.
 
 var (
-	// UserActionMap used for storing the last time an action was called
-	UserActionMap *userMap
-	// AliasConfirmMap stores aliases waiting to be confirmed, key is requester, val is target
-	AliasConfirmMap *aliasConfirmMap
+	// log tags lines with the name of the plugin
+	log = onelib.NewLog(NAME)
 
 	cuteTime  time.Duration
 	chillTime time.Duration
 	memeTime  time.Duration
+
+	configSchema = &onelib.ConfigSchema{Section: NAME, Keys: []*onelib.ConfigKey{
+		{Name: "cute_time", Type: onelib.ConfigDuration, Default: 150 * time.Minute, Description: "Time until \"cute\" can be called again."},
+		{Name: "chill_time", Type: onelib.ConfigDuration, Default: 30 * time.Minute, Description: "Time until \"chill\" can be called again."},
+		{Name: "meme_time", Type: onelib.ConfigDuration, Default: 260 * time.Second, Description: "Time until \"meme\" can be called again."},
+	}}
 )
 
 // Load returns the Plugin object.
 func Load() onelib.Plugin {
-	rand.Seed(time.Now().UnixNano())
-	UserActionMap = new(userMap)
-	UserActionMap.uMap = make(map[onelib.UUID]lastAction, 1)
-	UserActionMap.lock = new(sync.RWMutex)
-	AliasConfirmMap = new(aliasConfirmMap)
-	AliasConfirmMap.uMap = make(map[onelib.UUID]onelib.UUID, 1)
-	AliasConfirmMap.lock = new(sync.RWMutex)
-
-	var err error
-	cuteTime, err = time.ParseDuration(onelib.GetTextConfig(NAME, "cute_time"))
-	if err != nil {
-		onelib.Error.Panicln("Error parsing cute_time duration.")
-	}
-	chillTime, err = time.ParseDuration(onelib.GetTextConfig(NAME, "chill_time"))
-	if err != nil {
-		onelib.Error.Panicln("Error parsing chill_time duration.")
-	}
-	memeTime, err = time.ParseDuration(onelib.GetTextConfig(NAME, "meme_time"))
-	if err != nil {
-		onelib.Error.Panicln("Error parsing meme_time duration.")
-	}
-	return new(MoneyPlugin)
-}
-
-type aliasConfirmMap struct {
-	uMap map[onelib.UUID]onelib.UUID
-	lock *sync.RWMutex
-}
-
-func (acm *aliasConfirmMap) Get(requester onelib.UUID) (target onelib.UUID) {
-	acm.lock.RLock()
-	target = acm.uMap[requester]
-	acm.lock.RUnlock()
-	return
-}
-
-func (acm *aliasConfirmMap) Set(requester, target onelib.UUID) {
-	acm.lock.Lock()
-	acm.uMap[requester] = target
-	acm.lock.Unlock()
-}
-
-func (acm *aliasConfirmMap) Delete(requester onelib.UUID) {
-	acm.lock.Lock()
-	delete(acm.uMap, requester)
-	acm.lock.Unlock()
-}
-
-type userMap struct {
-	uMap map[onelib.UUID]lastAction
-	lock *sync.RWMutex
-}
-
-func (um *userMap) Get(user onelib.UUID, action string) time.Time {
-	um.lock.RLock()
-	if um.uMap[user] == nil {
-		um.lock.RUnlock()
-		return time.Time{}
+	if err := onelib.RegisterConfig(configSchema); err != nil {
+		panic(err)
 	}
-	lastTime := um.uMap[user][action]
-	um.lock.RUnlock()
-	return lastTime
-}
+	rand.Seed(time.Now().UnixNano())
 
-func (um *userMap) Set(user onelib.UUID, action string, lastTime time.Time) {
-	um.lock.Lock()
-	if um.uMap[user] == nil {
-		um.uMap[user] = make(lastAction, 3)
-	}
-	um.uMap[user][action] = lastTime
-	um.lock.Unlock()
+	loadTimes()
+	onelib.OnConfigChange(NAME, NAME, reloadConfig)
+	return new(MoneyPlugin)
 }
 
-// Update returns the time stored, and updates the stored time if longer than duration.
-// TODO support location and currency parameters
-func (um *userMap) Update(user onelib.UUID, action string, duration time.Duration) (lastTime time.Time) {
-	um.lock.Lock()
-	if um.uMap[user] == nil {
-		um.uMap[user] = make(lastAction, 3)
-	}
-	lastTime = um.uMap[user][action]
-	if time.Since(lastTime) >= duration {
-		um.uMap[user][action] = time.Now()
-	}
-	um.lock.Unlock()
-	return
+// loadTimes reads the time between each action from the config.
+func loadTimes() {
+	cfg := onelib.Config(NAME)
+	cuteTime, chillTime, memeTime = cfg.Duration("cute_time"), cfg.Duration("chill_time"), cfg.Duration("meme_time")
 }
 
-type lastAction map[string]time.Time
-
-func formatDuration(action string, d time.Duration) (text string, formattedText string) {
-	if days := int(d.Hours() / 24); days > 0 {
-		text = fmt.Sprintf("You cannot %s for another %d days, %d hours, and %d minutes.", action, days, int(d.Hours())%24, int(d.Minutes())%60)
-		formattedText = fmt.Sprintf("You cannot %s for another <strong>%d days</strong>, <strong>%d hours</strong>, and <strong>%d minutes</strong>.", action, days, int(d.Hours())%24, int(d.Minutes())%60)
-	} else if int(d.Hours()) > 0 {
-		text = fmt.Sprintf("You cannot %s for another %d hours, and %d minutes.", action, int(d.Hours()), int(d.Minutes())%60)
-		formattedText = fmt.Sprintf("You cannot %s for another <strong>%d hours</strong>, and <strong>%d minutes</strong>.", action, int(d.Hours()), int(d.Minutes())%60)
-	} else {
-		text = fmt.Sprintf("You cannot %s for another %d minutes, and %d seconds.", action, int(d.Minutes()), int(d.Seconds())%60)
-		formattedText = fmt.Sprintf("You cannot %s for another <strong>%d minutes</strong>, and <strong>%d seconds</strong>.", action, int(d.Minutes()), int(d.Seconds())%60)
+// reloadConfig picks up new action times once the config is reloaded.
+func reloadConfig(section string) {
+	loadTimes()
+	if err := onelib.RefreshCommands(NAME); err != nil {
+		log.Error.Println("Error refreshing commands:", err)
 	}
-	return
 }
 
-func performAction(uuid onelib.UUID, actionName, actionText string, actionMinPayout, actionMaxPayout, actionMinFine, actionMaxFine, actionFailRate int, positiveResponses, negativeResponses [][2]string, actionCallRate time.Duration) (text string, formattedText string) {
+func performAction(uuid onelib.UUID, actionMinPayout, actionMaxPayout, actionMinFine, actionMaxFine, actionFailRate int, positiveResponses, negativeResponses [][2]string) (text string, formattedText string) {
 	tuuid, _, _ := onecurrency.Currency.Get(DEFAULT_CURRENCY, onelib.UUID("global"), uuid)
 	if tuuid != onelib.UUID("") {
 		uuid = tuuid
 	}
-	if storedTime := UserActionMap.Update(uuid, actionName, actionCallRate); time.Since(storedTime) >= actionCallRate {
-		if actionFailRate > 1 && rand.Intn(actionFailRate) == 0 {
-			roll := rand.Intn(actionMaxFine-actionMinFine) + actionMinFine
-			negativeResponse := negativeResponses[rand.Intn(len(negativeResponses))]
-			text = fmt.Sprintf(negativeResponse[0], DEFAULT_CURRENCY, roll)
-			formattedText = fmt.Sprintf(negativeResponse[1], DEFAULT_CURRENCY, roll)
-			onecurrency.Currency.Add(DEFAULT_CURRENCY, onelib.UUID("global"), uuid, roll*-1, 0)
-		} else {
-			roll := rand.Intn(actionMaxPayout-actionMinPayout) + actionMinPayout
-			positiveResponse := positiveResponses[rand.Intn(len(positiveResponses))]
-			text = fmt.Sprintf(positiveResponse[0], DEFAULT_CURRENCY, roll)
-			formattedText = fmt.Sprintf(positiveResponse[1], DEFAULT_CURRENCY, roll)
-			onecurrency.Currency.Add(DEFAULT_CURRENCY, onelib.UUID("global"), uuid, roll, 0)
-		}
+	if actionFailRate > 1 && rand.Intn(actionFailRate) == 0 {
+		roll := rand.Intn(actionMaxFine-actionMinFine) + actionMinFine
+		negativeResponse := negativeResponses[rand.Intn(len(negativeResponses))]
+		text = fmt.Sprintf(negativeResponse[0], DEFAULT_CURRENCY, roll)
+		formattedText = fmt.Sprintf(negativeResponse[1], DEFAULT_CURRENCY, roll)
+		onecurrency.Currency.Add(DEFAULT_CURRENCY, onelib.UUID("global"), uuid, roll*-1, 0)
 	} else {
-		timeUntil := time.Until(storedTime.Add(actionCallRate))
-		text, formattedText = formatDuration(actionText, timeUntil)
+		roll := rand.Intn(actionMaxPayout-actionMinPayout) + actionMinPayout
+		positiveResponse := positiveResponses[rand.Intn(len(positiveResponses))]
+		text = fmt.Sprintf(positiveResponse[0], DEFAULT_CURRENCY, roll)
+		formattedText = fmt.Sprintf(positiveResponse[1], DEFAULT_CURRENCY, roll)
+		onecurrency.Currency.Add(DEFAULT_CURRENCY, onelib.UUID("global"), uuid, roll, 0)
 	}
 	return
 }
@@ -205,7 +129,7 @@ func cute(msg onelib.Message, sender onelib.Sender) {
 		{"You plant tulips with Roxy and gain **%s%d**.", "You plant tulips with Roxy and gain <strong>%s%d</strong>."},
 		{"Your favourite Animal Crossing villager gives you **%s%d**!", "Your favourite Animal Crossing villager gives you <strong>%s%d</strong>!"},
 	}
-	text, formattedText := performAction(sender.UUID(), "cute", "be cute", cuteMin, cuteMax, 0, 0, 0, cuteResponses, nil, cuteTime)
+	text, formattedText := performAction(sender.UUID(), cuteMin, cuteMax, 0, 0, 0, cuteResponses, nil)
 	sender.Location().SendFormattedText(text, formattedText)
 	onecurrency.Currency.UpdateDisplayName(DEFAULT_CURRENCY, onelib.UUID("global"), sender.UUID(), sender.DisplayName())
 }
@@ -265,7 +189,7 @@ func chill(msg onelib.Message, sender onelib.Sender) {
 		{"You take a dry hit from your vape and lose **%s%d**.", "You take a dry hit from your vape and lose <strong>%s%d</strong>."},
 		{"You take too many shrooms and run into the woods so a search team has to be dispatched to find you. They charge you **%s%d** for the service.", "You take too many shrooms and run into the woods so a search team has to be dispatched to find you. They charge you <strong>%s%d</strong> for the service."},
 	}
-	text, formattedText := performAction(sender.UUID(), "chill", "chill", chillMin, chillMax, chillFineMin, chillFineMax, chillFail, chillResponses, chillNegativeResponses, chillTime)
+	text, formattedText := performAction(sender.UUID(), chillMin, chillMax, chillFineMin, chillFineMax, chillFail, chillResponses, chillNegativeResponses)
 	sender.Location().SendFormattedText(text, formattedText)
 	onecurrency.Currency.UpdateDisplayName(DEFAULT_CURRENCY, onelib.UUID("global"), sender.UUID(), sender.DisplayName())
 }
@@ -303,7 +227,7 @@ func meme(msg onelib.Message, sender onelib.Sender) {
 		{"You let your memes be dreams and lost **%s%d**.", "You let your memes be dreams and lost <strong>%s%d</strong>."},
 		{"You think you made a decent meme, but the mods delete it and take **%s%d** from you 😰.", "You think you made a decent meme, but the mods delete it and take <strong>%s%d</strong> from you 😰."},
 	}
-	text, formattedText := performAction(sender.UUID(), "meme", "meme", memeMin, memeMax, memeFineMin, memeFineMax, memeFail, memeResponses, memeNegativeResponses, memeTime)
+	text, formattedText := performAction(sender.UUID(), memeMin, memeMax, memeFineMin, memeFineMax, memeFail, memeResponses, memeNegativeResponses)
 	sender.Location().SendFormattedText(text, formattedText)
 	onecurrency.Currency.UpdateDisplayName(DEFAULT_CURRENCY, onelib.UUID("global"), sender.UUID(), sender.DisplayName())
 }
@@ -314,8 +238,7 @@ func risk(msg onelib.Message, sender onelib.Sender) {
 		riskMin     = 81
 		riskFineMax = 499
 		riskFineMin = 80
-		riskFail    = 2                 // 1 in x of failure
-		riskTime    = time.Second * 121 // time until command can be called again
+		riskFail    = 2 // 1 in x of failure
 	)
 	if strings.TrimSpace(msg.Text()) != "" {
 		return
@@ -334,58 +257,52 @@ func risk(msg onelib.Message, sender onelib.Sender) {
 		{"You have to pay interest to your loanshark, you pay **%s%d**.", "You have to pay interest to your loanshark, you pay <strong>%s%d</strong>."},
 		{"You sacrifice to the gambling gods and lose **%s%d**.", "You sacrifice to the gambling gods and lose <strong>%s%d</strong>."},
 	}
-	text, formattedText := performAction(sender.UUID(), "risk", "risk", riskMin, riskMax, riskFineMin, riskFineMax, riskFail, riskResponses, riskNegativeResponses, riskTime)
+	text, formattedText := performAction(sender.UUID(), riskMin, riskMax, riskFineMin, riskFineMax, riskFail, riskResponses, riskNegativeResponses)
 	sender.Location().SendFormattedText(text, formattedText)
 	onecurrency.Currency.UpdateDisplayName(DEFAULT_CURRENCY, onelib.UUID("global"), sender.UUID(), sender.DisplayName())
 }
 
-func alias(msg onelib.Message, sender onelib.Sender) {
+func alias(ctx context.Context, msg onelib.Message, sender onelib.Sender) {
 	text := strings.ReplaceAll(msg.Text(), "`", "")
 	if text == "" {
-		txt := fmt.Sprintf("Turns current UUID into target of another UUID. Usage: %salias <UUID>", onelib.DefaultPrefix)
-		formattedTxt := fmt.Sprintf("Turns current UUID into target of another UUID. Usage: <code>%salias &lt;UUID&gt;</code>", onelib.DefaultPrefix)
+		txt := fmt.Sprintf("Turns current UUID into target of another UUID. Usage: %salias <UUID>", onelib.SenderPrefix(sender))
+		formattedTxt := fmt.Sprintf("Turns current UUID into target of another UUID. Usage: <code>%salias &lt;UUID&gt;</code>", onelib.SenderPrefix(sender))
 		sender.Location().SendFormattedText(txt, formattedTxt)
 		return
 	}
-	AliasConfirmMap.Set(sender.UUID(), onelib.UUID(text))
-	txt := fmt.Sprintf("Almost done, just type '%sconfirmalias `%s`' in a room the bot can see on the target account, and you're set!", onelib.DefaultPrefix, sender.UUID())
-	formattedTxt := fmt.Sprintf("Almost done, just type <code>%sconfirmalias `%s`</code> in a room the bot can see on the target account, and you're set!", onelib.DefaultPrefix, sender.UUID())
-	sender.Location().SendFormattedText(txt, formattedTxt)
-}
-
-func confirmalias(msg onelib.Message, sender onelib.Sender) {
-	text := strings.ReplaceAll(msg.Text(), "`", "")
-	if text == "" {
-		txt := fmt.Sprintf("Confirms an alias. Usage: '%sconfirmalias `<UUID>`'", onelib.DefaultPrefix)
-		formattedTxt := fmt.Sprintf("Confirms an alias. Usage: <code>%sconfirmalias &lt;UUID&gt;</code>", onelib.DefaultPrefix)
-		sender.Location().SendFormattedText(txt, formattedTxt)
+	target := onelib.UUID(text)
+	if target == sender.UUID() {
+		sender.Location().SendText("You can't alias yourself.")
 		return
 	}
-	alias := AliasConfirmMap.Get(onelib.UUID(text))
-	if alias == onelib.UUID("") {
-		txt := "That account isn't trying to alias with anyone."
-		sender.Location().SendText(txt)
+	phrase := "confirm alias " + string(sender.UUID())
+	txt := fmt.Sprintf("Almost done, just say '%s' in a room the bot can see on the target account within %s, and you're set!", phrase, aliasConfirmTime)
+	formattedTxt := fmt.Sprintf("Almost done, just say <code>%s</code> in a room the bot can see on the target account within %s, and you're set!", phrase, aliasConfirmTime)
+	sender.Location().SendFormattedText(txt, formattedTxt)
+
+	resp, err := onelib.Await(ctx, &onelib.Waiter{Sender: target, Match: func(msg onelib.Message, sender onelib.Sender) bool {
+		text := strings.TrimPrefix(strings.ReplaceAll(msg.Text(), "`", ""), onelib.SenderPrefix(sender))
+		return strings.TrimSpace(text) == phrase
+	}}, aliasConfirmTime)
+	if err == onelib.ErrNoResponse {
+		sender.Location().SendText(fmt.Sprintf("Alias to %s wasn't confirmed in time.", target))
 		return
-	}
-	if alias != sender.UUID() {
-		txt := "That account isn't trying to alias with you."
-		sender.Location().SendText(txt)
+	} else if err != nil {
 		return
 	}
-	err := onelib.Alias.Set(onelib.UUID(text), sender.UUID())
+	err = onelib.Alias.Set(sender.UUID(), target)
 	if err != nil {
-		sender.Location().SendText(fmt.Sprintf("Alias failed (%s): %s", text, err))
+		resp.Sender.Location().SendText(fmt.Sprintf("Alias failed (%s): %s", sender.UUID(), err))
 		return
 	}
-	AliasConfirmMap.Delete(onelib.UUID(text))
-	sender.Location().SendText("Alias succeeded!")
+	resp.Sender.Location().SendText("Alias succeeded!")
 }
 
 func unalias(msg onelib.Message, sender onelib.Sender) {
 	text := msg.Text()
 	if text != "" {
-		txt := fmt.Sprintf("Removes alias on current UUID. Usage: %sunalias", onelib.DefaultPrefix)
-		formattedTxt := fmt.Sprintf("Removes alias on current UUID. Usage: <code>%sunalias</code>", onelib.DefaultPrefix)
+		txt := fmt.Sprintf("Removes alias on current UUID. Usage: %sunalias", onelib.SenderPrefix(sender))
+		formattedTxt := fmt.Sprintf("Removes alias on current UUID. Usage: <code>%sunalias</code>", onelib.SenderPrefix(sender))
 		sender.Location().SendFormattedText(txt, formattedTxt)
 		return
 	}
@@ -421,25 +338,21 @@ func checkBal(msg onelib.Message, sender onelib.Sender) {
 		displayName = sender.DisplayName()
 		onecurrency.Currency.UpdateDisplayName(DEFAULT_CURRENCY, onelib.UUID("global"), uuid, displayName)
 	} else {
-		displayName = text[:len(text)]
-		if sender.Protocol() == "matrix" {
-			formattedText := msg.FormattedText()
-			if len(formattedText) > 29 && string(formattedText[:29]) == "<a href=\"https://matrix.to/#/" {
-				tuuid := formattedText[29:]
-				if end := strings.Index(tuuid, "\""); end > 0 {
-					uuid = onelib.UUID(tuuid[:end])
+		displayName = text
+		uuid = onelib.UUID(text)
+		for _, mention := range onelib.Mentions(msg) {
+			if mention.Type == onelib.MentionUser {
+				uuid = mention.UUID
+				if mention.DisplayName != "" {
+					displayName = mention.DisplayName
 				}
-			} else {
-				uuid = onelib.UUID(displayName)
+				break
 			}
-		} else {
-			uuid = onelib.UUID(displayName)
 		}
-
 	}
 
 	if uuid == onelib.UUID("") {
-		sender.Location().SendFormattedText(fmt.Sprintf("Check balance. Usage: `%sbal [uuid]`", onelib.DefaultPrefix), fmt.Sprintf("Check balance. Usage: <code>%sbal [uuid]</code>", onelib.DefaultPrefix))
+		sender.Location().SendFormattedText(fmt.Sprintf("Check balance. Usage: `%sbal [uuid]`", onelib.SenderPrefix(sender)), fmt.Sprintf("Check balance. Usage: <code>%sbal [uuid]</code>", onelib.SenderPrefix(sender)))
 		return
 	}
 
@@ -448,16 +361,21 @@ func checkBal(msg onelib.Message, sender onelib.Sender) {
 		cObj = new(onecurrency.CurrencyObject)
 	}
 	if err != nil {
-		onelib.Error.Printf("(UUID: %s) %s\n", uuid, err)
+		log.Error.Printf("(UUID: %s) %s\n", uuid, err)
 	}
-	text := fmt.Sprintf("%s's balance:\n\nOn-hand | Bank | Net\n**%s%d**    | **%s%d**   | **%s%d**", displayName, DEFAULT_CURRENCY, cObj.Quantity, DEFAULT_CURRENCY, cObj.BankQuantity, DEFAULT_CURRENCY, cObj.Quantity+cObj.BankQuantity)
-	formattedText := fmt.Sprintf("<strong>%s's balance:</strong><br /><table><tr><th> On-hand </th><th> Bank </th><th> Net </th></tr><br /><tr><th> <strong>%s%d</strong>  </th><th>  <strong>%s%d</strong>  </th><th> <strong>%s%d</strong></th></tr></table>", displayName, DEFAULT_CURRENCY, cObj.Quantity, DEFAULT_CURRENCY, cObj.BankQuantity, DEFAULT_CURRENCY, cObj.Quantity+cObj.BankQuantity)
-	sender.Location().SendFormattedText(text, formattedText)
+	amount := func(q int) *onelib.Node {
+		return onelib.Bold(onelib.Textf("%s%d", DEFAULT_CURRENCY, q))
+	}
+	onelib.SendDocument(sender.Location(), onelib.NewDocument(
+		onelib.Bold(onelib.Textf("%s's balance:", displayName)),
+		onelib.Table([]*onelib.Node{onelib.Text("On-hand"), onelib.Text("Bank"), onelib.Text("Net")},
+			[]*onelib.Node{amount(cObj.Quantity), amount(cObj.BankQuantity), amount(cObj.Quantity + cObj.BankQuantity)}),
+	))
 }
 
 func deposit(msg onelib.Message, sender onelib.Sender) {
-	text := msg.Text()
-	if text == "all" {
+	args := onelib.CommandArgs(msg)
+	if args.All("amount") {
 		q, err := onecurrency.Currency.DepositAll(DEFAULT_CURRENCY, onelib.UUID("global"), sender.UUID())
 		if err != nil {
 			sender.Location().SendText("Nothing to deposit!")
@@ -466,12 +384,8 @@ func deposit(msg onelib.Message, sender onelib.Sender) {
 		sender.Location().SendFormattedText(fmt.Sprintf("Deposited all **%s%d**!", DEFAULT_CURRENCY, q), fmt.Sprintf("Deposited all <strong>%s%d</strong>!", DEFAULT_CURRENCY, q))
 		return
 	}
-	q, err := strconv.Atoi(text)
-	if err != nil {
-		sender.Location().SendText("Quantity must be an integer.")
-		return
-	}
-	err = onecurrency.Currency.Deposit(DEFAULT_CURRENCY, onelib.UUID("global"), sender.UUID(), q)
+	q := args.Int("amount")
+	err := onecurrency.Currency.Deposit(DEFAULT_CURRENCY, onelib.UUID("global"), sender.UUID(), q)
 	if err != nil {
 		sender.Location().SendText(err.Error())
 		return
@@ -481,8 +395,8 @@ func deposit(msg onelib.Message, sender onelib.Sender) {
 }
 
 func withdraw(msg onelib.Message, sender onelib.Sender) {
-	text := msg.Text()
-	if text == "all" {
+	args := onelib.CommandArgs(msg)
+	if args.All("amount") {
 		q, err := onecurrency.Currency.WithdrawAll(DEFAULT_CURRENCY, onelib.UUID("global"), sender.UUID())
 		if err != nil {
 			sender.Location().SendText("Nothing to withdraw!")
@@ -491,12 +405,8 @@ func withdraw(msg onelib.Message, sender onelib.Sender) {
 		sender.Location().SendFormattedText(fmt.Sprintf("Withdrew all **%s%d**!", DEFAULT_CURRENCY, q), fmt.Sprintf("Withdrew all <strong>%s%d</strong>!", DEFAULT_CURRENCY, q))
 		return
 	}
-	q, err := strconv.Atoi(text)
-	if err != nil {
-		sender.Location().SendText("Quantity must be an integer.")
-		return
-	}
-	err = onecurrency.Currency.Withdraw(DEFAULT_CURRENCY, onelib.UUID("global"), sender.UUID(), q)
+	q := args.Int("amount")
+	err := onecurrency.Currency.Withdraw(DEFAULT_CURRENCY, onelib.UUID("global"), sender.UUID(), q)
 	if err != nil {
 		sender.Location().SendText(err.Error())
 		return
@@ -525,7 +435,66 @@ func (mp *MoneyPlugin) Version() string {
 
 // Implements returns a map of commands and monitor the plugin implements.
 func (mp *MoneyPlugin) Implements() (map[string]onelib.Command, *onelib.Monitor) {
-	return map[string]onelib.Command{"bal": checkBal, "balance": checkBal, "cute": cute, "chill": chill, "meme": meme, "risk": risk, "dep": deposit, "deposit": deposit, "withdraw": withdraw, "alias": alias, "unalias": unalias, "confirmalias": confirmalias, "leaderboard": leaderboard, "lb": leaderboard}, nil
+	return map[string]onelib.Command{"bal": checkBal, "balance": checkBal, "cute": cute, "chill": chill, "meme": meme, "risk": risk, "dep": deposit, "deposit": deposit, "withdraw": withdraw, "unalias": unalias, "leaderboard": leaderboard, "lb": leaderboard}, nil
+}
+
+// CommandSpecs describes the commands returned by Implements.
+func (mp *MoneyPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:        "balance",
+			Aliases:     []string{"bal"},
+			Usage:       "[user]",
+			Description: "Shows your balance, or the balance of another user.",
+		},
+		{
+			Name:        "cute",
+			Description: "Attempts to gain currency by doing something cute.",
+			RateLimits:  []*onelib.RateLimit{{Scope: onelib.ScopeUser, Per: cuteTime}},
+		},
+		{
+			Name:        "chill",
+			Description: "Attempts to gain currency by doing something chill.",
+			RateLimits:  []*onelib.RateLimit{{Scope: onelib.ScopeUser, Per: chillTime}},
+		},
+		{
+			Name:        "meme",
+			Description: "Attempts to gain currency by doing something memey.",
+			RateLimits:  []*onelib.RateLimit{{Scope: onelib.ScopeUser, Per: memeTime}},
+		},
+		{
+			Name:        "risk",
+			Description: "Attempts to gain currency by doing something risky.",
+			RateLimits:  []*onelib.RateLimit{{Scope: onelib.ScopeUser, Per: riskTime}},
+		},
+		{
+			Name:        "deposit",
+			Aliases:     []string{"dep"},
+			Args:        []*onelib.Arg{{Name: "amount", Type: onelib.ArgInt, Min: onelib.Bound(1), AllowAll: true}},
+			Description: "Deposits currency into the bank.",
+		},
+		{
+			Name:        "withdraw",
+			Args:        []*onelib.Arg{{Name: "amount", Type: onelib.ArgInt, Min: onelib.Bound(1), AllowAll: true}},
+			Description: "Withdraws currency from the bank.",
+		},
+		{
+			Name:           "alias",
+			Usage:          "<UUID>",
+			Description:    "Turns your account into an alias of another account, once confirmed from that account.",
+			ContextCommand: alias,
+			Timeout:        aliasConfirmTime,
+		},
+		{
+			Name:        "unalias",
+			Description: "Removes the alias on your account.",
+		},
+		{
+			Name:        "leaderboard",
+			Aliases:     []string{"lb"},
+			Description: "Shows who has the most currency.",
+		},
+	}
 }
 
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
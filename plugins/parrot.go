@@ -96,6 +96,31 @@ func (pp *ParrotPlugin) Implements() (map[string]onelib.Command, *onelib.Monitor
 	return map[string]onelib.Command{"say": parrot, "s": parrot, "r": revParrot, "rev": revParrot, "format": formatParrot, "form": formatParrot}, pp.monitor
 }
 
+// CommandSpecs describes the commands returned by Implements.
+func (pp *ParrotPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:        "say",
+			Aliases:     []string{"s"},
+			Usage:       "<text>",
+			Description: "Repeats the text back.",
+		},
+		{
+			Name:        "rev",
+			Aliases:     []string{"r"},
+			Usage:       "<text>",
+			Description: "Repeats the text back in reverse.",
+		},
+		{
+			Name:        "format",
+			Aliases:     []string{"form"},
+			Usage:       "<html>",
+			Description: "Repeats the text back, formatted as HTML where supported.",
+			Hidden:      true,
+		},
+	}
+}
+
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
 func (pp *ParrotPlugin) Remove() {
 }
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -14,7 +15,6 @@ import (
 	"time"
 	"bytes"
 
-	"github.com/TheDiscordian/onebot/libs/discord"
 	"github.com/TheDiscordian/onebot/libs/missioncontrol"
 	"github.com/TheDiscordian/onebot/onelib"
 )
@@ -28,13 +28,30 @@ const (
 	VERSION = "v0.1.0"
 )
 
+var (
+	// log tags lines with the name of the plugin
+	log = onelib.NewLog(NAME)
+
+	configSchema = &onelib.ConfigSchema{Section: NAME, Keys: []*onelib.ConfigKey{
+		{Name: "openai_key", Type: onelib.ConfigString, Required: true, Secret: true, Description: "API key for OpenAI."},
+		{Name: "prompt", Type: onelib.ConfigString, Description: "Prompt for the AI."},
+		{Name: "channels", Type: onelib.ConfigTable, Description: "Channels to respond in per protocol, * for all."},
+		{Name: "update_databases", Type: onelib.ConfigBool, Description: "Update all knowledgebases on load."},
+		{Name: "reply_to_questions", Type: onelib.ConfigBool, Description: "Answer messages that look like questions."},
+		{Name: "reply_to_mentions", Type: onelib.ConfigBool, Description: "Answer messages mentioning the bot."},
+	}}
+)
+
 // Load returns the Plugin object.
 func Load() onelib.Plugin {
+	if err := onelib.RegisterConfig(configSchema); err != nil {
+		panic(err)
+	}
 	qa := new(QAPlugin)
 	// Load expertise from expertise.json, which contains a string map where the values are arrays of strings. Store just the keys in qa.expertise
 	expertise_file, err := os.Open("plugins/qa/expertise.json")
 	if err != nil {
-		onelib.Error.Println("Error opening expertise.json:", err)
+		log.Error.Println("Error opening expertise.json:", err)
 		return nil
 	}
 	defer expertise_file.Close()
@@ -45,7 +62,7 @@ func Load() onelib.Plugin {
 		if err := dec.Decode(&m); err == io.EOF {
 			break
 		} else if err != nil {
-			onelib.Error.Println("Error decoding expertise.json:", err)
+			log.Error.Println("Error decoding expertise.json:", err)
 			return nil
 		}
 		for k := range m {
@@ -53,34 +70,21 @@ func Load() onelib.Plugin {
 		}
 	}
 
-	// Check if openai_key is set
-	if onelib.GetTextConfig(NAME, "openai_key") == "" {
-		onelib.Error.Println("[qa] openai_key can't be blank.")
-		return nil
-	}
-
-	// channelsJson is in the format: {"protocol": ["channel1", "channel2"]}
-	channelsJson := onelib.GetTextConfig(NAME, "channels")
-	qa.channels = make(map[string][]string)
-	err = json.Unmarshal([]byte(channelsJson), &qa.channels)
-	if err != nil {
-		onelib.Error.Println("[qa] Error decoding channels:", err)
-		return nil
-	}
+	qa.channels = getChannelsMap()
 
-	updateDbs := onelib.GetBoolConfig(NAME, "update_databases")
+	updateDbs := onelib.Config(NAME).Bool("update_databases")
 	if updateDbs {
 		// TODO Currently these run every time, which takes a long time, and costs some money. We should
 		// instead have a goroutine check if the file is updated, if so, then do some updates instead of
 		// the whole thing.
-		_, err = runqa("db")
+		_, err = runqa(onelib.PluginContext(NAME), "db")
 		if err != nil {
-			onelib.Error.Println("Error downloading db:", err)
+			log.Error.Println("Error downloading db:", err)
 			return nil
 		}
-		_, err = runqa("aidb")
+		_, err = runqa(onelib.PluginContext(NAME), "aidb")
 		if err != nil {
-			onelib.Error.Println("Error updating aidb:", err)
+			log.Error.Println("Error updating aidb:", err)
 			return nil
 		}
 	}
@@ -91,18 +95,19 @@ func Load() onelib.Plugin {
 	}
 
 	qa.DbLock = new(sync.RWMutex)
+	qa.channelsLock = new(sync.RWMutex)
+	onelib.OnConfigChange(NAME, NAME, qa.reloadConfig)
 
 	missioncontrol.Plugins.Set(LONGNAME, new(QAMissionControlPlugin))
 	return qa
 }
 
+// getChannelsMap returns the channels to respond in, in the format: {"protocol": ["channel1", "channel2"]}
 func getChannelsMap() map[string][]string {
-	channelsJson := onelib.GetTextConfig(NAME, "channels")
+	table := onelib.Config(NAME).Table("channels")
 	channels := make(map[string][]string)
-	err := json.Unmarshal([]byte(channelsJson), &channels)
-	if err != nil {
-		onelib.Error.Println("[qa] Error decoding channels:", err)
-		return nil
+	for _, protocol := range table.Keys() {
+		channels[protocol] = table.List(protocol)
 	}
 	return channels
 }
@@ -111,19 +116,19 @@ func getMisinfosMap() map[string][]string {
 	// misinfos are stored in plugins/qa/misinfos.json
 	misinfosFile, err := os.Open("plugins/qa/misinfos.json")
 	if err != nil {
-		onelib.Error.Println("[qa] Error opening misinfos.json:", err)
+		log.Error.Println("Error opening misinfos.json:", err)
 		return nil
 	}
 	defer misinfosFile.Close()
 	misinfosBytes, err := io.ReadAll(misinfosFile)
 	if err != nil {
-		onelib.Error.Println("[qa] Error reading misinfos.json:", err)
+		log.Error.Println("Error reading misinfos.json:", err)
 		return nil
 	}
 	misinfos := make(map[string][]string)
 	err = json.Unmarshal(misinfosBytes, &misinfos)
 	if err != nil {
-		onelib.Error.Println("[qa] Error decoding misinfos:", err)
+		log.Error.Println("Error decoding misinfos:", err)
 		return nil
 	}
 	return misinfos
@@ -235,7 +240,7 @@ Add subject: <input type="text" id="add_misinfo_subject" name="add_misinfo_subje
 `
 	tmpl, err := template.New("qa").Parse(templateString)
 	if err != nil {
-		onelib.Error.Println("Error parsing template:", err)
+		log.Error.Println("Error parsing template:", err)
 		return ""
 	}
 
@@ -243,38 +248,38 @@ Add subject: <input type="text" id="add_misinfo_subject" name="add_misinfo_subje
 	// Read the entire contents of the file into expertise
 	expertiseFile, err := os.Open("plugins/qa/expertise.json")
 	if err != nil {
-		onelib.Error.Println("Error opening expertise.json:", err)
+		log.Error.Println("Error opening expertise.json:", err)
 		return ""
 	}
 	defer expertiseFile.Close()
 	expertiseBytes, err := io.ReadAll(expertiseFile)
 	if err != nil {
-		onelib.Error.Println("Error reading expertise.json:", err)
+		log.Error.Println("Error reading expertise.json:", err)
 		return ""
 	}
 	expertise := make(map[string][]string)
 	err = json.Unmarshal(expertiseBytes, &expertise)
 	if err != nil {
-		onelib.Error.Println("Error decoding expertise.json:", err)
+		log.Error.Println("Error decoding expertise.json:", err)
 		return ""
 	}
 
 	// Read the entire contents of the file into misinfos
 	misinfosFile, err := os.Open("plugins/qa/misinfos.json")
 	if err != nil {
-		onelib.Error.Println("Error opening misinfos.json:", err)
+		log.Error.Println("Error opening misinfos.json:", err)
 		return ""
 	}
 	defer misinfosFile.Close()
 	misinfosBytes, err := io.ReadAll(misinfosFile)
 	if err != nil {
-		onelib.Error.Println("Error reading misinfos.json:", err)
+		log.Error.Println("Error reading misinfos.json:", err)
 		return ""
 	}
 	misinfos := make(map[string][]string)
 	err = json.Unmarshal(misinfosBytes, &misinfos)
 	if err != nil {
-		onelib.Error.Println("Error decoding misinfos.json:", err)
+		log.Error.Println("Error decoding misinfos.json:", err)
 		return ""
 	}
 
@@ -301,7 +306,7 @@ Add subject: <input type="text" id="add_misinfo_subject" name="add_misinfo_subje
 	var output bytes.Buffer
 	err = tmpl.Execute(&output, templateVars)
 	if err != nil {
-		onelib.Error.Println("Error executing template:", err)
+		log.Error.Println("Error executing template:", err)
 		return ""
 	}
 	return template.HTML(output.String())
@@ -323,9 +328,9 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 			return "Reply settings saved!", nil
 		},
 		"question": func(args map[string]any) (string, error) {
-			txt, err := runqa("-q", args["q"].(string), "question", "-p", args["p"].(string))
+			txt, err := runqa(onelib.PluginContext(NAME), "-q", args["q"].(string), "question", "-p", args["p"].(string))
 			if err != nil {
-				onelib.Error.Println("Error running qa.py:", err)
+				log.Error.Println("Error running qa.py:", err)
 				return "", err
 			}
 			return txt, nil
@@ -336,7 +341,7 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 			channels[proto] = append(channels[proto], args["c"].(string))
 			channelsJson, err := json.Marshal(channels)
 			if err != nil {
-				onelib.Error.Println("[qa] Error encoding channels:", err)
+				log.Error.Println("Error encoding channels:", err)
 				return "", err
 			}
 			onelib.SetTextConfig(NAME, "channels", string(channelsJson))
@@ -353,7 +358,7 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 			}
 			channelsJson, err := json.Marshal(channels)
 			if err != nil {
-				onelib.Error.Println("[qa] Error encoding channels:", err)
+				log.Error.Println("Error encoding channels:", err)
 				return "", err
 			}
 			onelib.SetTextConfig(NAME, "channels", string(channelsJson))
@@ -364,7 +369,7 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 			channels[args["v"].(string)] = make([]string, 0)
 			channelsJson, err := json.Marshal(channels)
 			if err != nil {
-				onelib.Error.Println("[qa] Error encoding channels:", err)
+				log.Error.Println("Error encoding channels:", err)
 				return "", err
 			}
 			onelib.SetTextConfig(NAME, "channels", string(channelsJson))
@@ -375,7 +380,7 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 			delete(channels, args["v"].(string))
 			channelsJson, err := json.Marshal(channels)
 			if err != nil {
-				onelib.Error.Println("[qa] Error encoding channels:", err)
+				log.Error.Println("Error encoding channels:", err)
 				return "", err
 			}
 			onelib.SetTextConfig(NAME, "channels", string(channelsJson))
@@ -387,7 +392,7 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 			misinfos[topic] = append(misinfos[topic], args["m"].(string))
 			err := saveMisinfosMap(misinfos)
 			if err != nil {
-				onelib.Error.Println("[qa] Error saving misinfos:", err)
+				log.Error.Println("Error saving misinfos:", err)
 				return "", err
 			}
 			return "", nil
@@ -403,7 +408,7 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 			}
 			err := saveMisinfosMap(misinfos)
 			if err != nil {
-				onelib.Error.Println("[qa] Error saving misinfos:", err)
+				log.Error.Println("Error saving misinfos:", err)
 				return "", err
 			}
 			return "", nil
@@ -413,7 +418,7 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 			misinfos[args["v"].(string)] = make([]string, 0)
 			err := saveMisinfosMap(misinfos)
 			if err != nil {
-				onelib.Error.Println("[qa] Error saving misinfos:", err)
+				log.Error.Println("Error saving misinfos:", err)
 				return "", err
 			}
 			return "", nil
@@ -423,20 +428,20 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 			delete(misinfos, args["v"].(string))
 			err := saveMisinfosMap(misinfos)
 			if err != nil {
-				onelib.Error.Println("[qa] Error saving misinfos:", err)
+				log.Error.Println("Error saving misinfos:", err)
 				return "", err
 			}
 			return "", nil
 		},
 		"rebuild_db": func(args map[string]any) (string, error) {
-			_, err := runqa("db")
+			_, err := runqa(onelib.PluginContext(NAME), "db")
 			if err != nil {
-				onelib.Error.Println("Error downloading db:", err)
+				log.Error.Println("Error downloading db:", err)
 				return "", err
 			}
-			_, err = runqa("aidb")
+			_, err = runqa(onelib.PluginContext(NAME), "aidb")
 			if err != nil {
-				onelib.Error.Println("Error updating aidb:", err)
+				log.Error.Println("Error updating aidb:", err)
 				return "", err
 			}
 			return "DB rebuilt!", nil
@@ -444,15 +449,15 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 		"delete_expertise": func(args map[string]any) (string, error) {
 			url := args["e"].(string)
 			subject := args["t"].(string)
-			_, err := runqa("remove", "--url", url, "--subject", subject)
+			_, err := runqa(onelib.PluginContext(NAME), "remove", "--url", url, "--subject", subject)
 			if err != nil {
-				onelib.Error.Println("Error removing expertise:", err)
+				log.Error.Println("Error removing expertise:", err)
 				return "", err
 			}
 			// Remove the expertise from expertise.json too
 			expertise, err := getExpertiseMap()
 			if err != nil {
-				onelib.Error.Println("Error getting expertise:", err)
+				log.Error.Println("Error getting expertise:", err)
 				return "", err
 			}
 			for i, v := range expertise[subject] {
@@ -463,7 +468,7 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 			}
 			err = saveExpertiseMap(expertise)
 			if err != nil {
-				onelib.Error.Println("Error saving expertise:", err)
+				log.Error.Println("Error saving expertise:", err)
 				return "", err
 			}
 			return fmt.Sprintf("[%s] Removed: %s", subject, url), nil
@@ -471,21 +476,21 @@ func (qamc *QAMissionControlPlugin) Functions() map[string]func(map[string]any)
 		"add_expertise": func(args map[string]any) (string, error) {
 			url := args["e"].(string)
 			subject := args["t"].(string)
-			_, err := runqa("ingest", "--url", url, "--subject", subject)
+			_, err := runqa(onelib.PluginContext(NAME), "ingest", "--url", url, "--subject", subject)
 			if err != nil {
-				onelib.Error.Println("Error adding expertise:", err)
+				log.Error.Println("Error adding expertise:", err)
 				return "", err
 			}
 			// Add the expertise to expertise.json too
 			expertise, err := getExpertiseMap()
 			if err != nil {
-				onelib.Error.Println("Error getting expertise:", err)
+				log.Error.Println("Error getting expertise:", err)
 				return "", err
 			}
 			expertise[subject] = append(expertise[subject], url)
 			err = saveExpertiseMap(expertise)
 			if err != nil {
-				onelib.Error.Println("Error saving expertise:", err)
+				log.Error.Println("Error saving expertise:", err)
 				return "", err
 			}
 			return fmt.Sprintf("[%s] Added: %s", subject, url), nil
@@ -515,33 +520,79 @@ type QAPlugin struct {
 	expertise []string
 	channels  map[string][]string
 
-	lastMsg string
+	DbLock       *sync.RWMutex
+	channelsLock *sync.RWMutex
+}
 
-	DbLock *sync.RWMutex
+// reloadConfig picks up changes to the monitored channels once the config is reloaded.
+func (qa *QAPlugin) reloadConfig(section string) {
+	channels := getChannelsMap()
+	qa.channelsLock.Lock()
+	qa.channels = channels
+	qa.channelsLock.Unlock()
 }
 
-func runqa(args ...string) (string, error) {
+// runqa runs qa.py with args, killing it if ctx is cancelled first.
+func runqa(ctx context.Context, args ...string) (string, error) {
 	// Call the python script plugins/qa/qa.py, passing the openai key as an environment variable, and capturing the output.
 	_args := []string{"plugins/qa/qa.py", "-e", "plugins/qa/expertise.json", "-mi", "plugins/qa/misinfos.json", "-db", "plugins/qa/db-noembed.csv", "-edb", "plugins/qa/db.csv"}
-	cmd := exec.Command("python3", append(_args, args...)...)
+	cmd := exec.CommandContext(ctx, "python3", append(_args, args...)...)
 	cmd.Env = append(os.Environ(), "OPENAI_API_KEY="+onelib.GetTextConfig(NAME, "openai_key"))
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		onelib.Debug.Println("qa.py output:", string(out))
+		log.Debug.Println("qa.py output:", string(out))
 		return string(out), err
 	}
 	return string(out), nil
 }
 
-func (qa *QAPlugin) ask_question(msg onelib.Message, sender onelib.Sender) {
-	txt, err := runqa("-q", msg.Text(), "question", "-p", onelib.GetTextConfig(NAME, "prompt"))
+func (qa *QAPlugin) ask_question(ctx context.Context, msg onelib.Message, sender onelib.Sender) {
+	txt, err := runqa(ctx, "-q", msg.Text(), "question", "-p", onelib.GetTextConfig(NAME, "prompt"))
 	if err != nil {
-		onelib.Error.Println("Error running qa.py:", err)
+		log.Error.Println("Error running qa.py:", err)
 		return
 	}
-	onelib.Debug.Println("Replying:", txt)
-	qa.lastMsg = txt
-	sender.Location().SendText(txt)
+	log.Debug.Println("Replying:", txt)
+	sent, err := sender.Location().SendText(txt)
+	if err != nil {
+		log.Error.Printf("Error sending answer: %s\n", err)
+		return
+	}
+	qa.recordAnswer(sender.Location(), sent, txt)
+}
+
+// recordAnswer adds an answer the bot sent to the DB, and reacts to it to encourage feedback.
+func (qa *QAPlugin) recordAnswer(location onelib.Location, sent *onelib.SentMessage, txt string) {
+	if sent.UUID == "" {
+		return // Votes can't be tracked without knowing which message is the answer
+	}
+	qa.DbLock.Lock()
+	// Add DB entries for the response (FIXME: Question should be logged too)
+	now := time.Now()
+	indexKey := fmt.Sprintf("%d-%d-index", now.Year(), now.Month())
+	questionIndex := new(QuestionIndex)
+	err := onelib.Db.GetObj(NAME, indexKey, questionIndex)
+	if err != nil {
+		questionIndex = new(QuestionIndex)
+		questionIndex.Ids = make([]onelib.UUID, 0)
+	}
+	questionIndex.Ids = append(questionIndex.Ids, sent.UUID)
+	onelib.Db.PutObj(NAME, indexKey, questionIndex)
+	questionAnswer := new(QuestionAnswer)
+	questionAnswer.Id = sent.UUID
+	questionAnswer.Answer = txt
+	questionAnswer.Date = now.Unix()
+	onelib.Db.PutObj(NAME, string(sent.UUID), questionAnswer)
+	qa.DbLock.Unlock()
+	// Add reactions to encourage feedback
+	for _, emoji := range []string{"👍", "👎"} {
+		if err := onelib.React(location, sent.UUID, emoji); err != nil {
+			if err != onelib.ErrNotSupported {
+				log.Error.Printf("Error adding reaction: %s\n", err)
+			}
+			break
+		}
+	}
 }
 
 func (qa *QAPlugin) stats(msg onelib.Message, sender onelib.Sender) {
@@ -571,7 +622,7 @@ func (qa *QAPlugin) stats(msg onelib.Message, sender onelib.Sender) {
 		var answer QuestionAnswer
 		err := onelib.Db.GetObj(NAME, string(id), &answer)
 		if err != nil {
-			onelib.Error.Println("Error getting answer:", err)
+			log.Error.Println("Error getting answer:", err)
 			continue
 		}
 		totalUpvotes += answer.UpVotes
@@ -598,42 +649,20 @@ func (qa *QAPlugin) Version() string {
 
 func (qa *QAPlugin) OnMessageWithText(from onelib.Sender, msg onelib.Message) {
 	if from.Self() {
-		if strings.TrimSpace(msg.Text()) == strings.TrimSpace(qa.lastMsg) {
-			qa.DbLock.Lock()
-			// Add DB entries for the response (FIXME: Question should be logged too)
-			now := time.Now()
-			indexKey := fmt.Sprintf("%d-%d-index", now.Year(), now.Month())
-			questionIndex := new(QuestionIndex)
-			err := onelib.Db.GetObj(NAME, indexKey, questionIndex)
-			if err != nil {
-				questionIndex = new(QuestionIndex)
-				questionIndex.Ids = make([]onelib.UUID, 0)
-			}
-			questionIndex.Ids = append(questionIndex.Ids, msg.UUID())
-			onelib.Db.PutObj(NAME, indexKey, questionIndex)
-			questionAnswer := new(QuestionAnswer)
-			questionAnswer.Id = msg.UUID()
-			questionAnswer.Answer = msg.Text()
-			questionAnswer.Date = now.Unix()
-			onelib.Db.PutObj(NAME, string(msg.UUID()), questionAnswer)
-			qa.DbLock.Unlock()
-			if from.Protocol() == "discord" { // Add reactions to encourage feedback
-				disClient := from.Location().(*discord.DiscordLocation).Client
-				disClient.MessageReactionAdd(string(from.Location().UUID()), string(msg.UUID()), "👍")
-				disClient.MessageReactionAdd(string(from.Location().UUID()), string(msg.UUID()), "👎")
-			}
-		}
 		return
 	}
 
 	// Check if the message is in a channel we're monitoring
 	channel := from.Location().UUID()
 	proto := from.Protocol()
-	if _, ok := qa.channels[proto]; !ok {
+	qa.channelsLock.RLock()
+	channels, ok := qa.channels[proto]
+	qa.channelsLock.RUnlock()
+	if !ok {
 		return
 	}
 	found := false
-	for _, v := range qa.channels[proto] {
+	for _, v := range channels {
 		if v == "*" || onelib.UUID(v) == channel {
 			found = true
 			break
@@ -645,12 +674,12 @@ func (qa *QAPlugin) OnMessageWithText(from onelib.Sender, msg onelib.Message) {
 
 	txt := strings.ToLower(msg.Text())
 	if onelib.GetBoolConfig(NAME, "reply_to_mentions") && msg.Mentioned() {
-		qa.ask_question(msg, from)
+		qa.ask_question(onelib.PluginContext(NAME), msg, from)
 	} else if onelib.GetBoolConfig(NAME, "reply_to_questions") {
 		// Check if txt contains any of the strings in qa.expertise, and ends in a question mark
 		for _, v := range qa.expertise {
 			if strings.Contains(txt, v) && strings.HasSuffix(txt, "?") {
-				qa.ask_question(msg, from)
+				qa.ask_question(onelib.PluginContext(NAME), msg, from)
 				break
 			}
 		}
@@ -697,7 +726,29 @@ func (qa *QAPlugin) OnMessageUpdate(from onelib.Sender, update onelib.Message) {
 
 // Implements returns a map of commands and monitor the plugin implements.
 func (qa *QAPlugin) Implements() (map[string]onelib.Command, *onelib.Monitor) {
-	return map[string]onelib.Command{"q": qa.ask_question, "question": qa.ask_question, "stats": qa.stats}, qa.monitor
+	return map[string]onelib.Command{"stats": qa.stats}, qa.monitor
+}
+
+// CommandSpecs describes the commands returned by Implements.
+func (qa *QAPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:           "question",
+			Aliases:        []string{"q"},
+			ContextCommand: qa.ask_question,
+			Usage:          "<question>",
+			Description:    "Answers a question using OpenAI and the knowledgebase.",
+			RateLimits: []*onelib.RateLimit{
+				{Scope: onelib.ScopeUser, Burst: 3, Per: time.Minute},
+				{Scope: onelib.ScopeGlobal, Burst: 20, Per: time.Minute},
+			},
+		},
+		{
+			Name:        "stats",
+			Usage:       "[yyyy-mm]",
+			Description: "Shows the approval rating of answers within a month.",
+		},
+	}
 }
 
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
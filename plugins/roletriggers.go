@@ -20,6 +20,9 @@ const (
 	DB_TABLE = "roletriggers"
 )
 
+// log tags lines with the name of the plugin
+var log = onelib.NewLog(NAME)
+
 // Load returns the Plugin object.
 func Load() onelib.Plugin {
 	return &RoleTriggersPlugin{
@@ -52,7 +55,7 @@ func handlereact(sender onelib.Sender, msg onelib.Message) {
 		err = disLoc.Client.GuildMemberRoleRemove(string(disLoc.GuildID), string(sender.UUID()), roleId)
 	}
 	if err != nil {
-		onelib.Error.Println("["+NAME+"] Error adding/removing role:", err)
+		log.Error.Println("Error adding/removing role:", err)
 	}
 }
 
@@ -60,13 +63,17 @@ func roleid(msg onelib.Message, sender onelib.Sender) {
 	if sender.Protocol() != "discord" {
 		return
 	}
-	txt := msg.Text()
-	if txt == "" || len(txt) < 5 || txt[:2] != "<@" {
-		return
+	sender.Location().SendText("RoleID: " + string(onelib.CommandArgs(msg).UUID("role")))
+}
+
+// emojiName returns the name of an emoji as given in a message (Ex: ":smile:", "<:custom:123>", or "😀").
+func emojiName(emoji string) string {
+	if len(emoji) > 2 && emoji[0] == ':' {
+		return emoji[1 : len(emoji)-1]
+	} else if len(emoji) > 5 && emoji[0] == '<' {
+		return strings.Split(emoji, ":")[1]
 	}
-	// disLoc := sender.Location().(*discord.DiscordLocation)
-	roleId := txt[3 : len(txt)-1]
-	sender.Location().SendText("RoleID: " + roleId)
+	return emoji
 }
 
 // !addtrigger msgID emojiName @role
@@ -74,38 +81,11 @@ func addtrigger(msg onelib.Message, sender onelib.Sender) {
 	if sender.Protocol() != "discord" {
 		return
 	}
-	if sender.UUID() != discord.DiscordAdminId {
-		return
-	}
-	txt := msg.Text()
-	if txt == "" || len(txt) < 9 {
-		return
-	}
-	splitTxt := strings.Split(txt, " ")
-	if len(splitTxt) != 3 {
-		return
-	}
-	// Get msg id
-	msgId := splitTxt[0]
-	// Get emoji name
-	if len(splitTxt[1]) < 1 {
-		return
-	}
-	var emojiName string
-	if splitTxt[1][0] == ':' {
-		emojiName = splitTxt[1][1 : len(splitTxt[1])-1]
-	} else if len(splitTxt[1]) > 5 && splitTxt[1][0] == '<' {
-		emojiName = strings.Split(splitTxt[1], ":")[1]
-	} else {
-		emojiName = splitTxt[1]
-	}
-	// Get role id
-	if len(splitTxt[2]) < 5 || splitTxt[2][:2] != "<@" {
-		return
-	}
-	roleId := splitTxt[2][3 : len(splitTxt[2])-1]
+	args := onelib.CommandArgs(msg)
+	msgId := args.String("messageID")
+	roleId := string(args.UUID("role"))
 
-	err := onelib.Db.PutString(DB_TABLE, msgId+"_"+emojiName, roleId)
+	err := onelib.Db.PutString(DB_TABLE, msgId+"_"+emojiName(args.String("emoji")), roleId)
 	if err != nil {
 		sender.Location().SendText("Failed to add trigger: " + err.Error())
 		return
@@ -117,38 +97,15 @@ func removetrigger(msg onelib.Message, sender onelib.Sender) {
 	if sender.Protocol() != "discord" {
 		return
 	}
-	if sender.UUID() != discord.DiscordAdminId {
-		return
-	}
-	txt := msg.Text()
-	if txt == "" || len(txt) < 9 {
-		return
-	}
-	splitTxt := strings.Split(txt, " ")
-	if len(splitTxt) != 2 {
-		return
-	}
-	// Get msg id
-	msgId := splitTxt[0]
-	// Get emoji name
-	if len(splitTxt[1]) < 1 {
-		return
-	}
-	var emojiName string
-	if splitTxt[1][0] == ':' {
-		emojiName = splitTxt[1][1 : len(splitTxt[1])-1]
-	} else if len(splitTxt[1]) > 5 && splitTxt[1][0] == '<' {
-		emojiName = strings.Split(splitTxt[1], ":")[1]
-	} else {
-		emojiName = splitTxt[1]
-	}
+	args := onelib.CommandArgs(msg)
+	key := args.String("messageID") + "_" + emojiName(args.String("emoji"))
 
-	_, err := onelib.Db.GetString(DB_TABLE, msgId+"_"+emojiName)
+	_, err := onelib.Db.GetString(DB_TABLE, key)
 	if err != nil {
 		sender.Location().SendText("Failed to find trigger: " + err.Error())
 		return
 	}
-	err = onelib.Db.Remove(DB_TABLE, msgId+"_"+emojiName)
+	err = onelib.Db.Remove(DB_TABLE, key)
 	if err != nil {
 		sender.Location().SendText("Failed to remove trigger: " + err.Error())
 		return
@@ -181,6 +138,38 @@ func (rt *RoleTriggersPlugin) Implements() (map[string]onelib.Command, *onelib.M
 	return map[string]onelib.Command{"roleid": roleid, "addtrigger": addtrigger, "at": addtrigger, "removetrigger": removetrigger, "rt": removetrigger}, rt.monitor
 }
 
+// CommandSpecs describes the commands returned by Implements.
+func (rt *RoleTriggersPlugin) CommandSpecs() []*onelib.CommandSpec {
+	return []*onelib.CommandSpec{
+		{
+			Name:        "roleid",
+			Args:        []*onelib.Arg{{Name: "role", Type: onelib.ArgRole}},
+			Description: "Shows the ID of a role.",
+		},
+		{
+			Name:    "addtrigger",
+			Aliases: []string{"at"},
+			Args: []*onelib.Arg{
+				{Name: "messageID", Type: onelib.ArgString},
+				{Name: "emoji", Type: onelib.ArgString},
+				{Name: "role", Type: onelib.ArgRole},
+			},
+			Description: "Gives users the role while they react to the message with the emoji.",
+			Permission:  onelib.PermissionAdmin,
+		},
+		{
+			Name:    "removetrigger",
+			Aliases: []string{"rt"},
+			Args: []*onelib.Arg{
+				{Name: "messageID", Type: onelib.ArgString},
+				{Name: "emoji", Type: onelib.ArgString},
+			},
+			Description: "Removes a trigger added by addtrigger.",
+			Permission:  onelib.PermissionAdmin,
+		},
+	}
+}
+
 // Remove is necessary to satisfy the Plugin interface, it does nothing.
 func (rt *RoleTriggersPlugin) Remove() {
 }
@@ -0,0 +1,89 @@
+#!/usr/bin/env python3
+# Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+"""An example OneBot RPC plugin, see README.md in this directory for the protocol.
+
+Add it to onebot.toml with:
+
+[[rpc_plugins]]
+name = "example"
+command = ["python3", "plugins/rpc/example.py"]
+"""
+
+import json
+import sys
+import threading
+
+NAME = "example"
+LONGNAME = "Example RPC Plugin"
+VERSION = "v0.0.0"
+
+COMMANDS = [
+    {
+        "name": "shout",
+        "description": "Repeats text back in upper case.",
+        "args": [{"name": "text", "type": "text"}],
+    },
+]
+
+write_lock = threading.Lock()
+next_id = 0
+
+
+def write(msg):
+    msg["jsonrpc"] = "2.0"
+    with write_lock:
+        sys.stdout.write(json.dumps(msg) + "\n")
+        sys.stdout.flush()
+
+
+def notify(method, params):
+    write({"method": method, "params": params})
+
+
+def request(method, params):
+    """Sends a request to OneBot without waiting on the answer."""
+    global next_id
+    next_id += 1
+    write({"id": next_id, "method": method, "params": params})
+
+
+def reply(sender, text):
+    location = sender["location"]
+    request("send_text", {"protocol": location["protocol"], "location": location["uuid"], "text": text})
+
+
+def command(params):
+    if params["command"] == "shout":
+        reply(params["sender"], params["args"]["text"].upper())
+
+
+def handle(msg):
+    method, params = msg.get("method"), msg.get("params") or {}
+    if method == "initialize":
+        return {"name": NAME, "long_name": LONGNAME, "version": VERSION, "commands": COMMANDS, "monitor": []}
+    if method == "command":
+        return command(params)
+    if method == "shutdown":
+        return {}
+    raise KeyError(method)
+
+
+def main():
+    for line in sys.stdin:
+        msg = json.loads(line)
+        if "method" not in msg:
+            continue  # an answer to one of our requests
+        try:
+            result = handle(msg)
+            if "id" in msg:
+                write({"id": msg["id"], "result": result if result is not None else {}})
+        except KeyError:
+            if "id" in msg:
+                write({"id": msg["id"], "error": {"code": -32601, "message": "method not found"}})
+        if msg.get("method") == "shutdown":
+            break
+
+
+if __name__ == "__main__":
+    main()
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -27,9 +28,19 @@ const (
 	VERSION = "v0.0.0"
 
 	DB_TABLE = "bluesky"
+
+	// maxImageSize is the largest image which can be posted, in bytes
+	maxImageSize = 1000000
+
+	// recvJob and syncFollowersJob are the IDs of the scheduled jobs polling the feed, and syncing followers
+	recvJob          = NAME + "-recv"
+	syncFollowersJob = NAME + "-syncfollowers"
 )
 
 var (
+	// log tags lines with the name of the protocol
+	log = onelib.NewProtocolLog(NAME)
+
 	blueskyHandle   string
 	blueskyPassword string
 	feedCount       int
@@ -37,71 +48,97 @@ var (
 	followFreq      int
 
 	blueskyDid onelib.UUID
+
+	configSchema = &onelib.ConfigSchema{Section: NAME, Keys: []*onelib.ConfigKey{
+		{Name: "handle", Type: onelib.ConfigString, Required: true, Description: "The handle on Bluesky of the account to use."},
+		{Name: "password", Type: onelib.ConfigString, Required: true, Secret: true, Description: "The password of the Bluesky account."},
+		{Name: "feed_count", Type: onelib.ConfigInt, Default: 50, Description: "The number of posts to fetch at once per poll."},
+		{Name: "feed_freq", Type: onelib.ConfigInt, Default: 10, Description: "The number of seconds to wait in between polls."},
+		{Name: "follow_freq", Type: onelib.ConfigInt, Default: 60, Description: "The number of seconds to wait in between syncing followers."},
+	}}
+
+	// outbox queues every post, spacing them out to stay under Bluesky's rate limits
+	outbox = onelib.NewOutbox(NAME, 2*time.Second)
 )
 
 func loadConfig() {
 	// BlueskyServer = onelib.GetTextConfig(NAME, "server")
-	blueskyHandle = onelib.GetTextConfig(NAME, "handle")
-	blueskyPassword = onelib.GetTextConfig(NAME, "password")
-	feedCount, _ = onelib.GetIntConfig(NAME, "feed_count")
-	feedFreq, _ = onelib.GetIntConfig(NAME, "feed_freq")
-	followFreq, _ = onelib.GetIntConfig(NAME, "follow_freq")
+	cfg := onelib.Config(NAME)
+	blueskyHandle = cfg.String("handle")
+	blueskyPassword = cfg.String("password")
+	feedCount = cfg.Int("feed_count")
+	feedFreq = cfg.Int("feed_freq")
+	followFreq = cfg.Int("follow_freq")
 }
 
 // Load connects to Bluesky, and sets up listeners. It's required for OneBot.
 func Load() onelib.Protocol {
+	if err := onelib.RegisterConfig(configSchema); err != nil {
+		panic(err)
+	}
 	loadConfig()
 	err := createSession(blueskyHandle, blueskyPassword)
 	if err != nil {
-		onelib.Error.Println("["+NAME+"] Error creating session:", err)
+		log.Error.Println("Error creating session:", err)
 	}
-	bsProto := Bluesky{prefix: onelib.DefaultPrefix, nickname: blueskyHandle, seenPosts: make(map[string]bool), stop: make(chan bool)}
-	go bsProto.recv(bsProto.stop)
-	go syncFollowers(bsProto.stop)
+	bsProto := &Bluesky{nickname: blueskyHandle, seenPosts: make(map[string]bool)}
+	onelib.Scheduler.Handle(NAME, "recv", bsProto.recv)
+	onelib.Scheduler.Handle(NAME, "syncfollowers", syncFollowers)
+	scheduleEvery(recvJob, "recv", feedFreq)
+	scheduleEvery(syncFollowersJob, "syncfollowers", followFreq)
 
-	return onelib.Protocol(&bsProto)
+	return onelib.Protocol(bsProto)
 }
 
-func syncFollowers(stop chan bool) {
-	for {
-		select {
-		case <-stop:
-			return
-		default:
+// scheduleEvery schedules the handler to run every freq seconds.
+func scheduleEvery(id, handler string, freq int) {
+	if freq <= 0 {
+		log.Error.Printf("Not scheduling %s, its frequency isn't set.\n", handler)
+		return
+	}
+	err := onelib.Scheduler.Schedule(&onelib.Job{ID: id, Owner: NAME, Handler: handler, Every: time.Duration(freq) * time.Second})
+	if err != nil {
+		log.Error.Printf("Error scheduling %s: %s\n", handler, err)
+	}
+}
+
+// syncFollowers follows everyone following us, and unfollows everyone who isn't.
+func syncFollowers(ctx context.Context, job *onelib.Job) error {
+	follows, err := getFollowsMap()
+	if err != nil {
+		return fmt.Errorf("error getting follows: %w", err)
+	}
+	followers, err := getFollowersMap()
+	if err != nil {
+		return fmt.Errorf("error getting followers: %w", err)
+	}
+	// See who follows us, but we don't follow them and follow them
+	for follower := range followers {
+		if !follows[follower] {
+			err = followUser(follower)
+			if err != nil {
+				log.Error.Println("Error following user:", err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second):
+			}
+		} else {
+			delete(follows, follower)
 		}
-		follows, err := getFollowsMap()
-		if err != nil {
-			onelib.Error.Println("["+NAME+"] Error getting follows:", err)
-			time.Sleep(time.Duration(followFreq) * time.Second)
-			continue
+	}
+	// See who we follow, but they don't follow us and unfollow them
+	for follow := range follows {
+		if ctx.Err() != nil {
+			return nil
 		}
-		followers, err := getFollowersMap()
+		err = unfollowUser(follow)
 		if err != nil {
-			onelib.Error.Println("["+NAME+"] Error getting followers:", err)
-			time.Sleep(time.Duration(followFreq) * time.Second)
-			continue
+			log.Error.Println("Error unfollowing user:", err)
 		}
-		// See who follows us, but we don't follow them and follow them
-		for follower := range followers {
-			if !follows[follower] {
-				err = followUser(follower)
-				time.Sleep(time.Second)
-				if err != nil {
-					onelib.Error.Println("["+NAME+"] Error following user:", err)
-				}
-			} else {
-				delete(follows, follower)
-			}
-		}
-		// See who we follow, but they don't follow us and unfollow them
-		for follow := range follows {
-			err = unfollowUser(follow)
-			if err != nil {
-				onelib.Error.Println("["+NAME+"] Error unfollowing user:", err)
-			}
-		}
-		time.Sleep(time.Duration(followFreq) * time.Second)
 	}
+	return nil
 }
 
 func followUser(did string) error {
@@ -247,7 +284,7 @@ func getAuthInfo() *xrpc.AuthInfo {
 	if err == nil {
 		err := json.Unmarshal([]byte(jsonAuth), &auth)
 		if err != nil {
-			onelib.Error.Println("["+NAME+"] Error unmarshalling auth_json:", err)
+			log.Error.Println("Error unmarshalling auth_json:", err)
 		}
 	}
 	return &auth
@@ -279,58 +316,80 @@ func createSession(handle, password string) error {
 	return nil
 }
 
-func post(text string, reply *bsky.FeedPost_ReplyRef) (string, string, error) {
+func post(text string, reply *bsky.FeedPost_ReplyRef, embed *bsky.FeedPost_Embed) (string, string, error) {
+	// reformat the text
+	// replace all "**" with nothing
+	text = strings.ReplaceAll(text, "**", "")
+	return postFacets(text, nil, reply, embed)
+}
+
+// postFacets posts text with facets, adding facets for any URLs and "@handle" mentions in text which facets don't
+// already cover.
+func postFacets(text string, facets []*bsky.RichtextFacet, reply *bsky.FeedPost_ReplyRef, embed *bsky.FeedPost_Embed) (string, string, error) {
 	auth := getAuthInfo()
 	xrpcc, err := getXrpcClient(auth)
 	if err != nil {
 		return "", "", err
 	}
 
-	// reformat the text
-	// replace all "**" with nothing
-	text = strings.ReplaceAll(text, "**", "")
 	// find all URLs in text, create RichtextFacet_Link for each
 	relaxed := xurls.Relaxed()
 	urls := relaxed.FindAllStringIndex(text, -1)
-	var facets []*bsky.RichtextFacet
-	if len(urls) > 0 {
-		facets = make([]*bsky.RichtextFacet, len(urls))
-		for i, u := range urls {
-			// skip the entry if it's a mention
-			var out string
-			if u[0] > 0 && text[u[0]-1] == '@' {
-				out = "https://staging.bsky.app/profile/" + text[u[0]:u[1]]
-				u[0] -= 1
-			} else if len(text[u[0]:u[1]]) > len("https://") && text[u[0]:u[1]][0:len("https://")] == "https://" {
-				out = text[u[0]:u[1]]
+	for _, u := range urls {
+		if u[0] > 0 && text[u[0]-1] == '@' {
+			u[0] -= 1
+		}
+		if facetsOverlap(facets, u[0], u[1]) {
+			continue
+		}
+		var out string
+		feature := new(bsky.RichtextFacet_Features_Elem)
+		if text[u[0]] == '@' {
+			// it's a mention, link to the profile if the handle can't be resolved
+			handle := text[u[0]+1 : u[1]]
+			if resolved, err := atproto.IdentityResolveHandle(context.TODO(), xrpcc, handle); err == nil {
+				feature.RichtextFacet_Mention = &bsky.RichtextFacet_Mention{Did: resolved.Did}
 			} else {
-				out = "https://" + text[u[0]:u[1]]
+				out = "https://staging.bsky.app/profile/" + handle
 			}
-			facets[i] = &bsky.RichtextFacet{
-				Index: &bsky.RichtextFacet_ByteSlice{
-					ByteStart: int64(u[0]),
-					ByteEnd:   int64(u[1]),
-				},
-				Features: []*bsky.RichtextFacet_Features_Elem{
-					&bsky.RichtextFacet_Features_Elem{
-						RichtextFacet_Link: &bsky.RichtextFacet_Link{
-							Uri: out,
-						},
-					},
-				},
+		} else if len(text[u[0]:u[1]]) > len("https://") && text[u[0]:u[1]][0:len("https://")] == "https://" {
+			out = text[u[0]:u[1]]
+		} else {
+			out = "https://" + text[u[0]:u[1]]
+		}
+		if feature.RichtextFacet_Mention == nil {
+			feature.RichtextFacet_Link = &bsky.RichtextFacet_Link{
+				Uri: out,
 			}
 		}
+		facets = append(facets, &bsky.RichtextFacet{
+			Index: &bsky.RichtextFacet_ByteSlice{
+				ByteStart: int64(u[0]),
+				ByteEnd:   int64(u[1]),
+			},
+			Features: []*bsky.RichtextFacet_Features_Elem{feature},
+		})
 	}
 
-	resp, err := atproto.RepoCreateRecord(context.TODO(), xrpcc, &atproto.RepoCreateRecord_Input{
-		Collection: "app.bsky.feed.post",
-		Repo:       auth.Did,
-		Record: &lexutil.LexiconTypeDecoder{&bsky.FeedPost{
-			Text:      text,
-			CreatedAt: time.Now().Format("2006-01-02T15:04:05.000Z"),
-			Reply:     reply,
-			Facets:    facets,
-		}},
+	// Posts in the same thread are queued together, so a chain of replies stays in order
+	var thread onelib.UUID
+	if reply != nil && reply.Root != nil {
+		thread = onelib.UUID(reply.Root.Uri)
+	}
+	var resp *atproto.RepoCreateRecord_Output
+	err = outbox.Send(thread, func() error {
+		resp, err = atproto.RepoCreateRecord(context.TODO(), xrpcc, &atproto.RepoCreateRecord_Input{
+			Collection: "app.bsky.feed.post",
+			Repo:       auth.Did,
+			Record: &lexutil.LexiconTypeDecoder{&bsky.FeedPost{
+				Text:      text,
+				CreatedAt: time.Now().Format("2006-01-02T15:04:05.000Z"),
+				Reply:     reply,
+				Facets:    facets,
+				Embed:     embed,
+			}},
+		})
+		return retryable(err)
 	})
 	if err != nil {
 		return "", "", fmt.Errorf("failed to create post: %w", err)
@@ -342,6 +401,126 @@ func post(text string, reply *bsky.FeedPost_ReplyRef) (string, string, error) {
 	return resp.Uri, resp.Cid, nil
 }
 
+// retryable marks errors from Bluesky rate limiting, or being down as temporary, so the request is retried.
+func retryable(err error) error {
+	var status int
+	if err != nil {
+		if _, scanErr := fmt.Sscanf(err.Error(), "XRPC ERROR %d", &status); scanErr == nil && (status == http.StatusTooManyRequests || status >= http.StatusInternalServerError) {
+			return onelib.RetryAfter(err, 0)
+		}
+	}
+	return err
+}
+
+// facetsOverlap returns true if any of facets cover part of the bytes from start to end.
+func facetsOverlap(facets []*bsky.RichtextFacet, start, end int) bool {
+	for _, facet := range facets {
+		if facet.Index != nil && int64(start) < facet.Index.ByteEnd && int64(end) > facet.Index.ByteStart {
+			return true
+		}
+	}
+	return false
+}
+
+// spanFacets returns facets for the links and mentions in a document's spans (see onelib.Document.Spans). Mentions
+// of users who aren't on Bluesky are skipped.
+func spanFacets(spans []*onelib.Span) []*bsky.RichtextFacet {
+	facets := make([]*bsky.RichtextFacet, 0, len(spans))
+	for _, span := range spans {
+		feature := new(bsky.RichtextFacet_Features_Elem)
+		switch {
+		case span.URL != "":
+			feature.RichtextFacet_Link = &bsky.RichtextFacet_Link{Uri: span.URL}
+		case span.Mention != nil && span.Mention.Type == onelib.MentionUser && strings.HasPrefix(string(span.Mention.UUID), "did:"):
+			feature.RichtextFacet_Mention = &bsky.RichtextFacet_Mention{Did: string(span.Mention.UUID)}
+		default:
+			continue
+		}
+		facets = append(facets, &bsky.RichtextFacet{
+			Index:    &bsky.RichtextFacet_ByteSlice{ByteStart: int64(span.Start), ByteEnd: int64(span.End)},
+			Features: []*bsky.RichtextFacet_Features_Elem{feature},
+		})
+	}
+	return facets
+}
+
+// uploadImage uploads an image to be embedded in a post.
+func uploadImage(ctx context.Context, data []byte) (*lexutil.LexBlob, error) {
+	xrpcc, err := getXrpcClient(getAuthInfo())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := atproto.RepoUploadBlob(ctx, xrpcc, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload image: %w", err)
+	}
+	return resp.Blob, nil
+}
+
+// like likes the post, returning the URI of the like.
+func like(subject *bskyPost) (string, error) {
+	auth := getAuthInfo()
+	xrpcc, err := getXrpcClient(auth)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := atproto.RepoCreateRecord(context.TODO(), xrpcc, &atproto.RepoCreateRecord_Input{
+		Collection: "app.bsky.feed.like",
+		Repo:       auth.Did,
+		Record: &lexutil.LexiconTypeDecoder{Val: &bsky.FeedLike{
+			CreatedAt: time.Now().Format("2006-01-02T15:04:05.000Z"),
+			Subject:   subject.ref(),
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to like post: %w", err)
+	}
+	return resp.Uri, nil
+}
+
+// unlike deletes the like with likeURI.
+func unlike(likeURI string) error {
+	auth := getAuthInfo()
+	xrpcc, err := getXrpcClient(auth)
+	if err != nil {
+		return err
+	}
+
+	err = atproto.RepoDeleteRecord(context.TODO(), xrpcc, &atproto.RepoDeleteRecord_Input{
+		Collection: "app.bsky.feed.like",
+		Repo:       auth.Did,
+		Rkey:       likeURI[strings.LastIndex(likeURI, "/")+1:],
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unlike post: %w", err)
+	}
+	return nil
+}
+
+// deletePost deletes one of the bot's posts, identified by its UUID (see bskyPost.UUID).
+func deletePost(uuid onelib.UUID) error {
+	post := newBskyPost(uuid)
+	if post == nil {
+		return fmt.Errorf("'%s' isn't a post", uuid)
+	}
+	auth := getAuthInfo()
+	xrpcc, err := getXrpcClient(auth)
+	if err != nil {
+		return err
+	}
+
+	err = atproto.RepoDeleteRecord(context.TODO(), xrpcc, &atproto.RepoDeleteRecord_Input{
+		Collection: "app.bsky.feed.post",
+		Repo:       auth.Did,
+		Rkey:       post.uri[strings.LastIndex(post.uri, "/")+1:],
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete post: %w", err)
+	}
+	return nil
+}
+
 func getFeed(count int64) ([]*bsky.FeedDefs_FeedViewPost, error) {
 	auth := getAuthInfo()
 	xrpcc, err := getXrpcClient(auth)
@@ -363,9 +542,8 @@ type Bluesky struct {
 	/*
 	   Store useful data here such as connected rooms, admins, nickname, accepted prefixes, etc
 	*/
-	prefix   string
 	nickname string
-	stop     chan bool
+	lastCID  string
 
 	seenPosts map[string]bool
 }
@@ -392,107 +570,131 @@ func (bs *Bluesky) NewMessage(raw []byte) onelib.Message {
 }
 
 // Send sends a Message object to a location specified by to (usually a location or sender UUID).
-func (bs *Bluesky) Send(to onelib.UUID, msg onelib.Message) {
-	bs.SendText(to, msg.Text())
+func (bs *Bluesky) Send(to onelib.UUID, msg onelib.Message) (*onelib.SentMessage, error) {
+	return bs.SendText(to, msg.Text())
 }
 
 // SendText sends text to a location specified by to (usually a location or sender UUID).
 // However for Bluesky sending text can be to just ... the void. This only supports the void. See
 // blueskyLocation for replying to a thread.
-func (bs *Bluesky) SendText(to onelib.UUID, text string) {
-	post(text, nil)
+func (bs *Bluesky) SendText(to onelib.UUID, text string) (*onelib.SentMessage, error) {
+	uri, cid, err := post(text, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sentPost(uri, cid, to), nil
 }
 
 // SendFormattedText sends formatted text to a location specified by to (usually a location or sender UUID).
-func (bs *Bluesky) SendFormattedText(to onelib.UUID, text, formattedText string) {
-	bs.SendText(to, text)
+func (bs *Bluesky) SendFormattedText(to onelib.UUID, text, formattedText string) (*onelib.SentMessage, error) {
+	return bs.SendText(to, text)
 }
 
-// recv should be called after you've recieved data and built a Message object
-func (bs *Bluesky) recv(stop chan bool) {
-	var lastCID string
-	for {
-		select {
-		case <-stop:
-			return
-		default:
+// Delete deletes one of the bot's posts, Bluesky posts have no location so to is ignored. Bluesky doesn't support
+// editing posts.
+func (bs *Bluesky) Delete(to, messageID onelib.UUID) error {
+	return deletePost(messageID)
+}
+
+// recv polls the feed, processing any new posts. It's run by the scheduler every feed_freq seconds.
+func (bs *Bluesky) recv(ctx context.Context, job *onelib.Job) error {
+	feed, err := getFeed(int64(feedCount))
+	if err != nil || len(feed) == 0 {
+		createSession(blueskyHandle, blueskyPassword)
+		return fmt.Errorf("error getting feed: %v", err)
+	}
+	firstCID := feed[0].Post.Cid
+	for _, item := range feed {
+		post := item.Post
+		if post.Cid == bs.lastCID || post.Author.Handle == blueskyHandle || bs.seenPosts[post.Cid] {
+			break
 		}
-		feed, err := getFeed(int64(feedCount))
-		if err != nil || len(feed) == 0 {
-			onelib.Error.Println("["+NAME+"] Error getting feed:", err)
-			time.Sleep(time.Duration(feedFreq/2+1) * time.Second)
-			createSession(blueskyHandle, blueskyPassword)
-			time.Sleep(time.Duration(feedFreq/2+1) * time.Second)
+		if post == nil {
 			continue
 		}
-		firstCID := feed[0].Post.Cid
-		for _, item := range feed {
-			post := item.Post
-			if post.Cid == lastCID || post.Author.Handle == blueskyHandle || bs.seenPosts[post.Cid] {
-				break
-			}
-			if post == nil {
-				continue
-			}
-			bs.seenPosts[post.Cid] = true
+		bs.seenPosts[post.Cid] = true
 
-			reply := item.Reply
+		record := post.Record.Val.(*bsky.FeedPost)
 
-			mentioned := false
-			// TODO check if reply is to a post we made, and consider that a mention
+		mentioned := false
+		// TODO check if reply is to a post we made, and consider that a mention
 
-			for _, facet := range post.Record.Val.(*bsky.FeedPost).Facets {
-				if facet == nil {
-					continue
-				}
-				for _, feature := range facet.Features {
-					if feature == nil || feature.RichtextFacet_Mention == nil {
-						continue
-					}
-					if onelib.UUID(feature.RichtextFacet_Mention.Did) == blueskyDid {
-						mentioned = true
-						break
-					}
-				}
-				if mentioned {
-					break
-				}
+		mentions := facetMentions(record)
+		for _, mention := range mentions {
+			if mention.UUID == blueskyDid {
+				mentioned = true
+				break
 			}
+		}
 
-			msg := &bskyMessage{
-				bskyPost: &bskyPost{
-					cid: post.Cid,
-					uri: post.Uri,
-				},
-				text:      post.Record.Val.(*bsky.FeedPost).Text,
-				mentioned: mentioned,
+		msg := &bskyMessage{
+			bskyPost: &bskyPost{
+				cid: post.Cid,
+				uri: post.Uri,
+			},
+			text:      record.Text,
+			mentioned: mentioned,
+			mentions:  mentions,
+		}
+		if post.Embed != nil && post.Embed.EmbedImages_View != nil {
+			for i, image := range post.Embed.EmbedImages_View.Images {
+				msg.attachments = append(msg.attachments, &onelib.Attachment{Name: fmt.Sprintf("image%d.jpg", i+1), MIMEType: "image/jpeg", URL: image.Fullsize, Alt: image.Alt})
 			}
-			if reply != nil && reply.Root != nil {
+		}
+		if reply := record.Reply; reply != nil {
+			if reply.Root != nil {
 				msg.root = &bskyPost{
 					cid: reply.Root.Cid,
 					uri: reply.Root.Uri,
 				}
 			}
+			if reply.Parent != nil {
+				msg.parent = &bskyPost{
+					cid: reply.Parent.Cid,
+					uri: reply.Parent.Uri,
+				}
+			}
+		}
 
-			location := &bskyLocation{msg: msg}
+		location := &bskyLocation{msg: msg}
 
-			sender := &bskySender{
-				handle:   post.Author.Handle,
-				did:      post.Author.Did,
-				location: location,
-			}
+		sender := &bskySender{
+			handle:   post.Author.Handle,
+			did:      post.Author.Did,
+			location: location,
+		}
+
+		onelib.ProcessMessage([]string{"@" + blueskyHandle + " ", "@" + blueskyHandle + " /"}, msg, sender)
+	}
+	bs.lastCID = firstCID
+	return nil
+}
 
-			onelib.ProcessMessage([]string{bs.prefix, "@" + blueskyHandle + " ", "@" + blueskyHandle + " /"}, msg, sender)
+// facetMentions returns the users mentioned in a post, in the order they appear.
+func facetMentions(record *bsky.FeedPost) []*onelib.Mention {
+	var mentions []*onelib.Mention
+	for _, facet := range record.Facets {
+		if facet == nil {
+			continue
+		}
+		for _, feature := range facet.Features {
+			if feature == nil || feature.RichtextFacet_Mention == nil {
+				continue
+			}
+			mention := &onelib.Mention{Type: onelib.MentionUser, UUID: onelib.UUID(feature.RichtextFacet_Mention.Did)}
+			if index := facet.Index; index != nil && index.ByteStart >= 0 && index.ByteStart < index.ByteEnd && index.ByteEnd <= int64(len(record.Text)) {
+				mention.DisplayName = strings.TrimPrefix(record.Text[index.ByteStart:index.ByteEnd], "@")
+			}
+			mentions = append(mentions, mention)
 		}
-		lastCID = firstCID
-		time.Sleep(time.Duration(feedFreq) * time.Second)
 	}
+	return mentions
 }
 
 // Remove should disconnect any open connections making it so the bot can forget about the protocol cleanly.
 func (bs *Bluesky) Remove() {
-	bs.stop <- true
-	bs.stop <- true
+	onelib.Scheduler.Unschedule(recvJob)
+	onelib.Scheduler.Unschedule(syncFollowersJob)
 }
 
 type bskyPost struct {
@@ -500,22 +702,64 @@ type bskyPost struct {
 	uri string
 }
 
+// newBskyPost returns the post identified by uuid (see bskyPost.UUID), or nil if uuid isn't a post.
+func newBskyPost(uuid onelib.UUID) *bskyPost {
+	parts := strings.SplitN(string(uuid), "$", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil
+	}
+	return &bskyPost{cid: parts[0], uri: parts[1]}
+}
+
+func (bp *bskyPost) UUID() onelib.UUID {
+	if bp == nil {
+		return ""
+	}
+	return onelib.UUID(bp.cid + "$" + bp.uri)
+}
+
+func (bp *bskyPost) ref() *atproto.RepoStrongRef {
+	return &atproto.RepoStrongRef{Cid: bp.cid, Uri: bp.uri}
+}
+
 type bskyMessage struct {
 	*bskyPost
 	// root of the thread
 	root *bskyPost
+	// post being replied to
+	parent *bskyPost
 	// text of the post (may be empty)
 	text string
 	// whether or not we were mentioned in the post
 	mentioned bool
+	// images embedded in the post
+	attachments []*onelib.Attachment
+	// users mentioned in the post
+	mentions []*onelib.Mention
 }
 
 func (bm *bskyMessage) UUID() onelib.UUID {
-	return onelib.UUID(bm.cid + "$" + bm.uri)
+	return bm.bskyPost.UUID()
+}
+
+func (bm *bskyMessage) ReplyTo() onelib.UUID {
+	return bm.parent.UUID()
+}
+
+func (bm *bskyMessage) Thread() onelib.UUID {
+	return bm.root.UUID()
+}
+
+func (bm *bskyMessage) Attachments() []*onelib.Attachment {
+	return bm.attachments
+}
+
+func (bm *bskyMessage) Mentions() []*onelib.Mention {
+	return bm.mentions
 }
 
 func (bm *bskyMessage) Reaction() *onelib.Emoji {
-	onelib.Debug.Printf("[%s] Reactions not supported.\n", NAME)
+	log.Debug.Println("Reactions not supported.")
 	return nil
 }
 
@@ -531,7 +775,7 @@ func (bm *bskyMessage) StripPrefix(prefix string) onelib.Message {
 	if len(bm.text) > len(prefix) && strings.HasPrefix(bm.text, prefix) {
 		prefix = prefix + " "
 	}
-	return onelib.Message(&bskyMessage{text: strings.Replace(bm.text, prefix, "", 1)})
+	return onelib.Message(&bskyMessage{bskyPost: bm.bskyPost, root: bm.root, parent: bm.parent, mentioned: bm.mentioned, attachments: bm.attachments, mentions: bm.mentions, text: strings.Replace(bm.text, prefix, "", 1)})
 }
 
 func (bm *bskyMessage) Mentioned() bool {
@@ -573,20 +817,21 @@ func (bs *bskySender) Protocol() string {
 	return NAME
 }
 
-func (bs *bskySender) Send(msg onelib.Message) {
-	bs.SendText(msg.Text())
+func (bs *bskySender) Send(msg onelib.Message) (*onelib.SentMessage, error) {
+	return bs.SendText(msg.Text())
 }
 
-func (bs *bskySender) SendText(text string) {
-	_, _, err := post("@"+bs.handle+" "+text, nil)
+func (bs *bskySender) SendText(text string) (*onelib.SentMessage, error) {
+	uri, cid, err := post("@"+bs.handle+" "+text, nil, nil)
 	if err != nil {
-		onelib.Error.Printf("[%s] Error posting message: %s\n", NAME, err)
+		return nil, err
 	}
+	return sentPost(uri, cid, bs.UUID()), nil
 }
 
-func (bs *bskySender) SendFormattedText(text, formattedText string) {
+func (bs *bskySender) SendFormattedText(text, formattedText string) (*onelib.SentMessage, error) {
 	// TODO figure out formatted text
-	bs.SendText(text)
+	return bs.SendText(text)
 }
 
 // In Bluesky a message is also a location, a message can be a thread or become a thread.
@@ -610,60 +855,170 @@ func (bl *bskyLocation) UUID() onelib.UUID {
 	return bl.msg.UUID()
 }
 
-func (bl *bskyLocation) Send(msg onelib.Message) {
-	bl.SendText(bl.msg.Text())
+func (bl *bskyLocation) Send(msg onelib.Message) (*onelib.SentMessage, error) {
+	return bl.SendText(bl.msg.Text())
+}
+
+func (bl *bskyLocation) SendText(text string) (*onelib.SentMessage, error) {
+	return bl.Reply(bl.msg, text, "")
 }
 
-func (bl *bskyLocation) SendText(text string) {
-	var root *atproto.RepoStrongRef
-	if bl.msg.root != nil {
-		root = &atproto.RepoStrongRef{Cid: bl.msg.root.cid, Uri: bl.msg.root.uri}
-	} else {
-		root = &atproto.RepoStrongRef{Cid: bl.msg.cid, Uri: bl.msg.uri}
+// Reply posts text in reply to the post to, in the same thread. Text over 300 characters is broken up by word into a
+// chain of replies.
+func (bl *bskyLocation) Reply(to onelib.Message, text, formattedText string) (*onelib.SentMessage, error) {
+	parent, root := replyPosts(to)
+	if parent == nil {
+		return nil, fmt.Errorf("can't reply to '%s', it isn't a post", to.UUID())
+	}
+
+	var parts []onelib.UUID
+	reply := func(text string) error {
+		uri, cid, err := post(text, &bsky.FeedPost_ReplyRef{Parent: parent.ref(), Root: root.ref()}, nil)
+		if err != nil {
+			return err
+		}
+		parent = &bskyPost{cid: cid, uri: uri}
+		parts = append(parts, parent.UUID())
+		return nil
 	}
 
 	// If text is over 300 characters, break it up by word into multiple posts
 	if len(text) > 300 {
 		words := strings.Fields(text)
 		text = ""
-		last_uri := bl.msg.uri
-		last_cid := bl.msg.cid
 		for _, word := range words {
 			if len(text)+len(word)+1 > 300 {
-				var err error
-				last_uri, last_cid, err = post(strings.TrimSpace(text),
-					&bsky.FeedPost_ReplyRef{
-						Parent: &atproto.RepoStrongRef{Cid: last_cid, Uri: last_uri},
-						Root:   root,
-					})
-				if err != nil {
-					onelib.Error.Printf("[%s] Error posting message: %s\n", NAME, err)
-					return
+				if err := reply(strings.TrimSpace(text)); err != nil {
+					return nil, err
 				}
 				text = ""
-				time.Sleep(time.Second * 2)
 			}
 			text += word + " "
 		}
-		if len(text) > 0 {
-			post(strings.TrimSpace(text),
-				&bsky.FeedPost_ReplyRef{
-					Parent: &atproto.RepoStrongRef{Cid: last_cid, Uri: last_uri},
-					Root:   root,
-				})
+		text = strings.TrimSpace(text)
+	}
+	if len(text) > 0 {
+		if err := reply(text); err != nil {
+			return nil, err
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("nothing to post")
+	}
+	sent := onelib.NewSentMessage(parts[0], to.UUID(), NAME)
+	if len(parts) > 1 {
+		sent.Parts = parts
+	}
+	return sent, nil
+}
+
+// sentPost returns a handle to the post which was sent to location.
+func sentPost(uri, cid string, location onelib.UUID) *onelib.SentMessage {
+	return onelib.NewSentMessage((&bskyPost{cid: cid, uri: uri}).UUID(), location, NAME)
+}
+
+// replyPosts returns the posts a reply to msg should reference, nil if msg isn't a post.
+func replyPosts(msg onelib.Message) (parent, root *bskyPost) {
+	parent = newBskyPost(msg.UUID())
+	root = parent
+	if _, thread := onelib.ReplyTo(msg); thread != "" {
+		if threadRoot := newBskyPost(thread); threadRoot != nil {
+			root = threadRoot
 		}
-	} else {
-		post(text,
-			&bsky.FeedPost_ReplyRef{
-				Parent: &atproto.RepoStrongRef{Cid: bl.msg.cid, Uri: bl.msg.uri},
-				Root:   root,
-			})
 	}
+	return
+}
+
+// SendAttachment posts the image in reply to the post, with text. Only images up to maxImageSize can be posted.
+func (bl *bskyLocation) SendAttachment(ctx context.Context, attachment *onelib.Attachment, text string) (*onelib.SentMessage, error) {
+	data, err := attachment.Data(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !attachment.IsImage() {
+		return nil, fmt.Errorf("%w: only images can be posted", onelib.ErrNotSupported)
+	}
+	if len(data) > maxImageSize {
+		return nil, fmt.Errorf("image '%s' is larger than %d bytes", attachment.Name, maxImageSize)
+	}
+	blob, err := uploadImage(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	parent, root := replyPosts(bl.msg)
+	embed := &bsky.FeedPost_Embed{EmbedImages: &bsky.EmbedImages{Images: []*bsky.EmbedImages_Image{{Alt: attachment.Alt, Image: blob}}}}
+	uri, cid, err := post(text, &bsky.FeedPost_ReplyRef{Parent: parent.ref(), Root: root.ref()}, embed)
+	if err != nil {
+		return nil, err
+	}
+	return sentPost(uri, cid, bl.UUID()), nil
+}
+
+// SendDocument posts the document in reply to the post, with its links and mentions as facets. Documents over 300
+// characters are posted as plain text, broken up into a chain of replies (see Reply).
+func (bl *bskyLocation) SendDocument(doc *onelib.Document) (*onelib.SentMessage, error) {
+	text, spans := doc.Spans(bl)
+	if len(text) > 300 {
+		return bl.SendText(doc.PlainText(bl))
+	}
+	parent, root := replyPosts(bl.msg)
+	if parent == nil {
+		return nil, fmt.Errorf("can't reply to '%s', it isn't a post", bl.msg.UUID())
+	}
+	uri, cid, err := postFacets(text, spanFacets(spans), &bsky.FeedPost_ReplyRef{Parent: parent.ref(), Root: root.ref()}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sentPost(uri, cid, bl.UUID()), nil
 }
 
-func (bl *bskyLocation) SendFormattedText(text, formattedText string) {
+func (bl *bskyLocation) SendFormattedText(text, formattedText string) (*onelib.SentMessage, error) {
 	// TODO: Proper formatted text
-	bl.SendText(text)
+	return bl.SendText(text)
+}
+
+// Delete deletes one of the bot's posts.
+func (bl *bskyLocation) Delete(messageID onelib.UUID) error {
+	return deletePost(messageID)
+}
+
+// React likes the post, Bluesky has no other reactions so emoji is ignored.
+func (bl *bskyLocation) React(messageID onelib.UUID, emoji string) error {
+	subject := newBskyPost(messageID)
+	if subject == nil {
+		return fmt.Errorf("'%s' isn't a post", messageID)
+	}
+	likeURI, err := like(subject)
+	if err != nil {
+		return err
+	}
+	return onelib.Db.PutString(DB_TABLE, "like_"+subject.uri, likeURI)
+}
+
+// Unreact removes the bot's like from the post, Bluesky has no other reactions so emoji is ignored.
+func (bl *bskyLocation) Unreact(messageID onelib.UUID, emoji string) error {
+	subject := newBskyPost(messageID)
+	if subject == nil {
+		return fmt.Errorf("'%s' isn't a post", messageID)
+	}
+	likeURI, err := onelib.Db.GetString(DB_TABLE, "like_"+subject.uri)
+	if err != nil || likeURI == "" {
+		return nil // We haven't liked the post
+	}
+	if err = unlike(likeURI); err != nil {
+		return err
+	}
+	return onelib.Db.Remove(DB_TABLE, "like_"+subject.uri)
+}
+
+// Mention returns "@" followed by the user's handle, which is turned into a mention facet when posted. Bluesky has no
+// roles, or locations to mention.
+func (bl *bskyLocation) Mention(mention *onelib.Mention) (string, string) {
+	name := mention.DisplayName
+	if name == "" {
+		name = string(mention.UUID)
+	}
+	return "@" + name, "@" + name
 }
 
 func (bl *bskyLocation) Protocol() string {
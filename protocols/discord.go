@@ -4,7 +4,11 @@ package main
 
 import (
 	"fmt"
+	"mime"
+	"path"
+	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/TheDiscordian/onebot/libs/discord"
 	"github.com/TheDiscordian/onebot/onelib"
@@ -18,9 +22,15 @@ const (
 	LONGNAME = "Discord"
 	// VERSION of the script
 	VERSION = "v0.0.0"
+
+	// messageCacheSize is how many recent messages are remembered, so edits and deletes can include the old message
+	messageCacheSize = 1000
 )
 
 var (
+	// log tags lines with the name of the protocol
+	log = onelib.NewProtocolLog(NAME)
+
 	// discordAuthUser FIXME set this somewhere so we can filter out messages from ourselves (see: recv)
 	discordAuthUser string
 	// discordAuthToken if blank, falls back onto pass
@@ -35,6 +45,9 @@ var (
 func loadConfig() {
 	discordAuthToken = onelib.GetTextConfig(NAME, "auth_token")
 	discord.DiscordAdminId = onelib.UUID(onelib.GetTextConfig(NAME, "admin_id"))
+	if discord.DiscordAdminId != "" {
+		onelib.Permissions.Grant(NAME, "", discord.DiscordAdminId, onelib.PermissionAdmin)
+	}
 }
 
 // Load connects to Discord, and sets up listeners. It's required for OneBot.
@@ -42,61 +55,58 @@ func Load() onelib.Protocol {
 	loadConfig()
 
 	if discordAuthToken == "" {
-		onelib.Error.Panicln("discordAuthToken can't be blank.")
+		log.Error.Panicln("discordAuthToken can't be blank.")
 	}
 	client, err := discordgo.New("Bot " + discordAuthToken) // FIXME maybe make this a global of a "discord lib" (wrap discordgo client in our own struct, extending as needed)
 	if err != nil {
-		onelib.Error.Panicln(err)
+		log.Error.Panicln(err)
 	}
 
-	discordSession := &Discord{client: &discord.DiscordClient{Session: client}, prefix: onelib.DefaultPrefix, nickname: onelib.DefaultNickname}
+	discordSession := &Discord{client: &discord.DiscordClient{Session: client}, nickname: onelib.DefaultNickname, channels: new(channelMap)}
+	discordSession.channels.cMap = make(map[string]*channelInfo, 1)
+	discordSession.messages = onelib.NewMessageCache(messageCacheSize)
+	discordSession.channels.lock = new(sync.RWMutex)
 
 	client.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) { // OnMessageCreate...
 		if m.Type == discordgo.MessageTypeDefault {
-			var (
-				displayName string
-				sender      *discordSender
-				user        *discordgo.User
-			)
-
-			msg := &discordMessage{text: m.Content, id: onelib.UUID(m.ID)}
-			dc := &discord.DiscordClient{Session: client}
-			dl := &discord.DiscordLocation{Client: dc, Uuid: onelib.UUID(m.ChannelID), GuildID: onelib.UUID(m.GuildID)}
-
-			// Check if we were mentioned
-			if strings.Contains(m.Content, fmt.Sprintf("<@%s>", string(discordId))) {
-				msg.mentioned = true
-			} else if m.MessageReference != nil { // Check if we were replied to
-				originalMessage, err := s.ChannelMessage(m.ChannelID, m.MessageReference.MessageID) // TODO: Check if this is an API call each time, if so, maybe we should cache msgs
-				if err == nil && originalMessage.Author.ID == string(discordId) {
-					msg.mentioned = true
-				}
-			}
-
-			if m.Member != nil && m.Member.Nick != "" {
-				displayName = m.Member.Nick
-			} else if m.Author != nil {
-				displayName = m.Author.Username
-			}
-			if m.Author != nil {
-				user = m.Author
-			} else if m.Member != nil && m.Member.User != nil {
-				user = m.Member.User
-			}
-
-			if user != nil {
-				sender = &discordSender{uuid: onelib.UUID(user.ID), username: user.Username + "#" + user.Discriminator, displayName: displayName, location: dl}
-			} else {
-				onelib.Error.Println("Error processing message, contains no UUID:", m)
+			msg, sender := newDiscordMessage(s, m.Message)
+			if sender == nil {
+				log.Error.Println("Error processing message, contains no UUID:", m)
 				return
 			}
+			discordSession.messages.Put(msg.id, msg, sender)
 			discordSession.recv(onelib.Message(msg), onelib.Sender(sender))
-			onelib.Debug.Printf("%s: %s\n", displayName, msg.Text())
+			log.Debug.Printf("%s: %s\n", sender.displayName, msg.Text())
 		} else {
-			onelib.Debug.Printf("Message (type: %v): %v\n", m.Type, m)
+			log.Debug.Printf("Message (type: %v): %v\n", m.Type, m)
 		}
 	})
 
+	client.AddHandler(func(s *discordgo.Session, m *discordgo.MessageUpdate) {
+		if m.Author == nil { // embeds being resolved, not an edit
+			return
+		}
+		msg, sender := newDiscordMessage(s, m.Message)
+		edit := &onelib.MessageEdit{New: msg}
+		if old := discordSession.messages.Get(msg.id); old != nil {
+			if old.Message.Text() == msg.Text() {
+				return
+			}
+			edit.Old = old.Message
+		}
+		discordSession.messages.Put(msg.id, msg, sender)
+		discordSession.edit(edit, sender)
+	})
+
+	client.AddHandler(func(s *discordgo.Session, m *discordgo.MessageDelete) {
+		del := &onelib.MessageDelete{UUID: onelib.UUID(m.ID)}
+		if old := discordSession.messages.Delete(del.UUID); old != nil {
+			del.Old = old.Message
+			del.Sender = old.Sender
+		}
+		discordSession.delete(del, &discord.DiscordLocation{Client: &discord.DiscordClient{Session: client}, Uuid: onelib.UUID(m.ChannelID), GuildID: onelib.UUID(m.GuildID)})
+	})
+
 	client.AddHandler(func(s *discordgo.Session, m *discordgo.MessageReactionAdd) {
 		if m.Emoji.ID == "" {
 			m.Emoji.ID = m.Emoji.Name
@@ -123,6 +133,51 @@ func Load() onelib.Protocol {
 		discordSession.update(msg, sender)
 	})
 
+	client.AddHandler(func(s *discordgo.Session, m *discordgo.PresenceUpdate) {
+		if m.User == nil {
+			return
+		}
+		update := &onelib.PresenceUpdate{Type: onelib.PresenceStatus, Status: string(m.Status)}
+		if m.Game != nil {
+			update.StatusText = m.Game.Name
+		}
+		discordSession.presence(update, newGuildSender(client, m.GuildID, m.User, m.Nick))
+	})
+
+	client.AddHandler(func(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
+		discordSession.presence(&onelib.PresenceUpdate{Type: onelib.PresenceJoin}, newGuildSender(client, m.GuildID, m.User, m.Nick))
+	})
+
+	client.AddHandler(func(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
+		discordSession.presence(&onelib.PresenceUpdate{Type: onelib.PresenceLeave}, newGuildSender(client, m.GuildID, m.User, m.Nick))
+	})
+
+	client.AddHandler(func(s *discordgo.Session, m *discordgo.GuildBanAdd) {
+		discordSession.presence(&onelib.PresenceUpdate{Type: onelib.PresenceBan}, newGuildSender(client, m.GuildID, m.User, ""))
+	})
+
+	// Remember channel names and topics, so updates can carry the old values
+	client.AddHandler(func(s *discordgo.Session, g *discordgo.GuildCreate) {
+		for _, channel := range g.Channels {
+			discordSession.channels.Swap(channel.ID, &channelInfo{name: channel.Name, topic: channel.Topic})
+		}
+	})
+
+	client.AddHandler(func(s *discordgo.Session, c *discordgo.ChannelUpdate) {
+		old := discordSession.channels.Swap(c.ID, &channelInfo{name: c.Name, topic: c.Topic})
+		if old == nil {
+			// Not seen before, so there's nothing to compare against, the cache is seeded for the next update
+			return
+		}
+		dl := &discord.DiscordLocation{Client: &discord.DiscordClient{Session: client}, Uuid: onelib.UUID(c.ID), GuildID: onelib.UUID(c.GuildID)}
+		if old.topic != c.Topic {
+			discordSession.locationUpdate(&onelib.LocationUpdate{Type: onelib.LocationTopic, Old: old.topic, New: c.Topic}, dl)
+		}
+		if old.name != c.Name {
+			discordSession.locationUpdate(&onelib.LocationUpdate{Type: onelib.LocationName, Old: old.name, New: c.Name}, dl)
+		}
+	})
+
 	// Add a handler for the Ready event
 	client.AddHandlerOnce(func(s *discordgo.Session, r *discordgo.Ready) {
 		// Retrieve the user ID
@@ -131,7 +186,7 @@ func Load() onelib.Protocol {
 
 	err = discordSession.client.Open()
 	if err != nil {
-		onelib.Error.Panicln(err)
+		log.Error.Panicln(err)
 		return nil
 	}
 
@@ -139,10 +194,12 @@ func Load() onelib.Protocol {
 }
 
 type discordMessage struct {
-	id                  onelib.UUID
+	id, replyTo         onelib.UUID
 	formattedText, text string
 	emoji               *onelib.Emoji
 	mentioned           bool
+	attachments         []*onelib.Attachment
+	mentions            []*onelib.Mention
 }
 
 func (mm *discordMessage) Mentioned() bool {
@@ -153,6 +210,23 @@ func (mm *discordMessage) UUID() onelib.UUID {
 	return mm.id
 }
 
+func (mm *discordMessage) ReplyTo() onelib.UUID {
+	return mm.replyTo
+}
+
+// Thread always returns an empty UUID, as Discord threads are channels of their own.
+func (mm *discordMessage) Thread() onelib.UUID {
+	return ""
+}
+
+func (mm *discordMessage) Attachments() []*onelib.Attachment {
+	return mm.attachments
+}
+
+func (mm *discordMessage) Mentions() []*onelib.Mention {
+	return mm.mentions
+}
+
 func (mm *discordMessage) Reaction() *onelib.Emoji {
 	return mm.emoji
 }
@@ -169,13 +243,129 @@ func (mm *discordMessage) StripPrefix(prefix string) onelib.Message {
 	if len(mm.text) > len(prefix) {
 		prefix = prefix + " "
 	}
-	return onelib.Message(&discordMessage{text: strings.Replace(mm.text, prefix, "", 1), formattedText: strings.Replace(mm.formattedText, prefix, "", 1)})
+	return onelib.Message(&discordMessage{id: mm.id, replyTo: mm.replyTo, mentioned: mm.mentioned, attachments: mm.attachments, mentions: mm.mentions, text: strings.Replace(mm.text, prefix, "", 1), formattedText: strings.Replace(mm.formattedText, prefix, "", 1)})
 }
 
 func (mm *discordMessage) Raw() []byte {
 	return []byte(mm.text)
 }
 
+// newDiscordMessage returns a message and its sender from a discordgo message. The sender is nil if the message has no
+// author.
+func newDiscordMessage(s *discordgo.Session, m *discordgo.Message) (*discordMessage, *discordSender) {
+	var (
+		displayName string
+		sender      *discordSender
+		user        *discordgo.User
+	)
+
+	msg := &discordMessage{text: m.Content, id: onelib.UUID(m.ID)}
+	dc := &discord.DiscordClient{Session: s}
+	dl := &discord.DiscordLocation{Client: dc, Uuid: onelib.UUID(m.ChannelID), GuildID: onelib.UUID(m.GuildID)}
+
+	if m.MessageReference != nil {
+		msg.replyTo = onelib.UUID(m.MessageReference.MessageID)
+	}
+	msg.mentions = parseMentions(s, m)
+	for _, a := range m.Attachments {
+		msg.attachments = append(msg.attachments, &onelib.Attachment{Name: a.Filename, MIMEType: mime.TypeByExtension(path.Ext(a.Filename)), Size: int64(a.Size), URL: a.URL})
+	}
+
+	// Check if we were mentioned
+	if strings.Contains(m.Content, fmt.Sprintf("<@%s>", string(discordId))) {
+		msg.mentioned = true
+	} else if m.MessageReference != nil { // Check if we were replied to
+		originalMessage, err := s.ChannelMessage(m.ChannelID, m.MessageReference.MessageID) // TODO: Check if this is an API call each time, if so, maybe we should cache msgs
+		if err == nil && originalMessage.Author.ID == string(discordId) {
+			msg.mentioned = true
+		}
+	}
+
+	if m.Member != nil && m.Member.Nick != "" {
+		displayName = m.Member.Nick
+	} else if m.Author != nil {
+		displayName = m.Author.Username
+	}
+	if m.Author != nil {
+		user = m.Author
+	} else if m.Member != nil && m.Member.User != nil {
+		user = m.Member.User
+	}
+
+	if user != nil {
+		sender = &discordSender{uuid: onelib.UUID(user.ID), username: user.Username + "#" + user.Discriminator, displayName: displayName, location: dl}
+	}
+	return msg, sender
+}
+
+// mentionPattern matches user, role, and channel mentions (Ex: "<@123>", "<@!123>", "<@&123>", "<#123>").
+var mentionPattern = regexp.MustCompile(`<(@!?|@&|#)(\d+)>`)
+
+// parseMentions returns the users, roles, and channels mentioned in m, in the order they appear.
+func parseMentions(s *discordgo.Session, m *discordgo.Message) []*onelib.Mention {
+	var mentions []*onelib.Mention
+	for _, match := range mentionPattern.FindAllStringSubmatch(m.Content, -1) {
+		mention := &onelib.Mention{UUID: onelib.UUID(match[2])}
+		switch match[1] {
+		case "@&":
+			mention.Type = onelib.MentionRole
+			if role, err := s.State.Role(m.GuildID, match[2]); err == nil {
+				mention.DisplayName = role.Name
+			}
+		case "#":
+			mention.Type = onelib.MentionLocation
+			if channel, err := s.State.Channel(match[2]); err == nil {
+				mention.DisplayName = channel.Name
+			}
+		default:
+			mention.Type = onelib.MentionUser
+			for _, user := range m.Mentions {
+				if user.ID == match[2] {
+					mention.DisplayName = user.Username
+				}
+			}
+		}
+		mentions = append(mentions, mention)
+	}
+	return mentions
+}
+
+// newGuildSender returns a sender for events which happen in a guild, rather than a channel. The location's UUID is the
+// guild's ID.
+func newGuildSender(client *discordgo.Session, guildID string, user *discordgo.User, nick string) *discordSender {
+	dl := &discord.DiscordLocation{Client: &discord.DiscordClient{Session: client}, Uuid: onelib.UUID(guildID), GuildID: onelib.UUID(guildID)}
+	sender := &discordSender{location: dl, displayName: nick}
+	if user != nil {
+		sender.uuid = onelib.UUID(user.ID)
+		if user.Username != "" {
+			sender.username = user.Username + "#" + user.Discriminator
+			if sender.displayName == "" {
+				sender.displayName = user.Username
+			}
+		}
+	}
+	return sender
+}
+
+// channelInfo is what's remembered about a channel, to tell what changed when it's updated.
+type channelInfo struct {
+	name, topic string
+}
+
+type channelMap struct {
+	cMap map[string]*channelInfo
+	lock *sync.RWMutex
+}
+
+// Swap stores info for the channel, returning what was stored before (if anything).
+func (cm *channelMap) Swap(channelID string, info *channelInfo) (old *channelInfo) {
+	cm.lock.Lock()
+	old = cm.cMap[channelID]
+	cm.cMap[channelID] = info
+	cm.lock.Unlock()
+	return
+}
+
 type discordSender struct {
 	displayName, username string
 	location              *discord.DiscordLocation
@@ -206,16 +396,16 @@ func (ms *discordSender) Protocol() string {
 	return NAME
 }
 
-func (ms *discordSender) Send(msg onelib.Message) {
-	ms.location.Client.Send(ms.uuid, msg)
+func (ms *discordSender) Send(msg onelib.Message) (*onelib.SentMessage, error) {
+	return ms.location.Client.Send(ms.uuid, msg)
 }
 
-func (ms *discordSender) SendText(text string) {
-	ms.location.Client.SendText(ms.uuid, text)
+func (ms *discordSender) SendText(text string) (*onelib.SentMessage, error) {
+	return ms.location.Client.SendText(ms.uuid, text)
 }
 
-func (ms *discordSender) SendFormattedText(text, formattedText string) {
-	ms.location.Client.SendFormattedText(ms.uuid, text, formattedText)
+func (ms *discordSender) SendFormattedText(text, formattedText string) (*onelib.SentMessage, error) {
+	return ms.location.Client.SendFormattedText(ms.uuid, text, formattedText)
 }
 
 // Discord is the Protocol object used for handling anything Discord related.
@@ -223,9 +413,10 @@ type Discord struct {
 	/*
 	   Store useful data here such as connected rooms, admins, nickname, accepted prefixes, etc
 	*/
-	prefix   string
 	nickname string
 	client   *discord.DiscordClient
+	channels *channelMap
+	messages *onelib.MessageCache
 }
 
 // Name returns the name of the plugin, usually the filename.
@@ -249,18 +440,28 @@ func (dis *Discord) NewMessage(raw []byte) onelib.Message {
 }
 
 // Send sends a Message object to a location specified by to (usually a location or sender UUID).
-func (dis *Discord) Send(to onelib.UUID, msg onelib.Message) {
-	dis.client.Send(to, msg)
+func (dis *Discord) Send(to onelib.UUID, msg onelib.Message) (*onelib.SentMessage, error) {
+	return dis.client.Send(to, msg)
 }
 
 // SendText sends text to a location specified by to (usually a location or sender UUID).
-func (dis *Discord) SendText(to onelib.UUID, text string) {
-	dis.client.SendText(to, text)
+func (dis *Discord) SendText(to onelib.UUID, text string) (*onelib.SentMessage, error) {
+	return dis.client.SendText(to, text)
 }
 
 // SendFormattedText sends formatted text to a location specified by to (usually a location or sender UUID).
-func (dis *Discord) SendFormattedText(to onelib.UUID, text, formattedText string) {
-	dis.client.SendFormattedText(to, text, formattedText)
+func (dis *Discord) SendFormattedText(to onelib.UUID, text, formattedText string) (*onelib.SentMessage, error) {
+	return dis.client.SendFormattedText(to, text, formattedText)
+}
+
+// Edit replaces the text of a message the bot sent to a location specified by to.
+func (dis *Discord) Edit(to, messageID onelib.UUID, text, formattedText string) error {
+	return dis.client.Edit(to, messageID, text, formattedText)
+}
+
+// Delete deletes the message in a location specified by to.
+func (dis *Discord) Delete(to, messageID onelib.UUID) error {
+	return dis.client.Delete(to, messageID)
 }
 
 // GetUserDisplayName returns a user's display name from a UUID
@@ -269,7 +470,7 @@ func (dis *Discord) SendFormattedText(to onelib.UUID, text, formattedText string
 // recv should be called after you've recieved data and built a Message object
 func (dis *Discord) recv(msg onelib.Message, sender onelib.Sender) {
 	if string(sender.UUID()) != discordAuthUser {
-		onelib.ProcessMessage([]string{dis.prefix}, msg, sender)
+		onelib.ProcessMessage([]string{"<@" + string(discordId) + "> ", "<@!" + string(discordId) + "> "}, msg, sender)
 	}
 }
 
@@ -280,6 +481,30 @@ func (dis *Discord) update(msg onelib.Message, sender onelib.Sender) {
 	}
 }
 
+// edit should be called after you've recieved a message edit
+func (dis *Discord) edit(edit *onelib.MessageEdit, sender onelib.Sender) {
+	if sender.UUID() != discordId {
+		onelib.ProcessEdit(edit, sender)
+	}
+}
+
+// delete should be called after you've recieved a message deletion
+func (dis *Discord) delete(del *onelib.MessageDelete, location onelib.Location) {
+	onelib.ProcessDelete(del, location)
+}
+
+// presence should be called after you've recieved a presence or membership update
+func (dis *Discord) presence(update *onelib.PresenceUpdate, sender onelib.Sender) {
+	if sender.UUID() != "" && sender.UUID() != discordId {
+		onelib.ProcessPresence(update, sender)
+	}
+}
+
+// locationUpdate should be called after you've recieved a channel update
+func (dis *Discord) locationUpdate(update *onelib.LocationUpdate, location onelib.Location) {
+	onelib.ProcessLocationUpdate(update, location)
+}
+
 // Remove
 func (dis *Discord) Remove() {
 	dis.client.Session.Close()
@@ -25,7 +25,7 @@ func Load() onelib.Protocol {
 	/*
 	   Code to be executed on-load goes here (connects)
 	*/
-	return onelib.Protocol(&FirstProtocol{prefix: onelib.DefaultPrefix, nickname: onelib.DefaultNickname})
+	return onelib.Protocol(&FirstProtocol{nickname: onelib.DefaultNickname})
 }
 
 // FirstProtocol is the Protocol object used for handling anything FirstProtocol related.
@@ -33,7 +33,6 @@ type FirstProtocol struct {
 	/*
 	   Store useful data here such as connected rooms, admins, nickname, accepted prefixes, etc
 	*/
-	prefix   string
 	nickname string
 }
 
@@ -58,23 +57,25 @@ func (fp *FirstProtocol) NewMessage(raw []byte) onelib.Message {
 }
 
 // Send sends a Message object to a location specified by to (usually a location or sender UUID).
-func (fp *FirstProtocol) Send(to onelib.UUID, msg onelib.Message) {
-	// code here
+func (fp *FirstProtocol) Send(to onelib.UUID, msg onelib.Message) (*onelib.SentMessage, error) {
+	return fp.SendFormattedText(to, msg.Text(), msg.FormattedText())
 }
 
 // SendText sends text to a location specified by to (usually a location or sender UUID).
-func (fp *FirstProtocol) SendText(to onelib.UUID, text string) {
+func (fp *FirstProtocol) SendText(to onelib.UUID, text string) (*onelib.SentMessage, error) {
 	// code here
+	return nil, onelib.ErrNotSupported
 }
 
 // SendFormattedText sends formatted text to a location specified by to (usually a location or sender UUID).
-func (fp *FirstProtocol) SendFormattedText(to onelib.UUID, text, formattedText string) {
+func (fp *FirstProtocol) SendFormattedText(to onelib.UUID, text, formattedText string) (*onelib.SentMessage, error) {
 	// code here
+	return nil, onelib.ErrNotSupported
 }
 
 // recv should be called after you've recieved data and built a Message object
 func (fp *FirstProtocol) recv(msg onelib.Message, sender onelib.Sender) {
-	onelib.ProcessMessage([]string{fp.prefix}, msg, sender)
+	onelib.ProcessMessage([]string{fp.nickname + ": "}, msg, sender)
 }
 
 // Remove should disconnect any open connections making it so the bot can forget about the protocol cleanly.
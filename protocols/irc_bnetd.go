@@ -22,6 +22,9 @@ const (
 )
 
 var (
+	// log tags lines with the name of the protocol
+	log = onelib.NewProtocolLog(NAME)
+
 	// Nick for the bot to use (keep in mind bnetd requires this nick to correlate to an existing account)
 	bnetNick string
 	// Bnet server like "bnet.thedisco.zone:6667"
@@ -30,8 +33,17 @@ var (
 	bnetPass string
 	// Channels to automatically join (comma separated)
 	bnetAutoJoin string
+	// Send documents with mIRC formatting codes, most bnetd clients don't display them
+	bnetColors bool
 
 	bnetConn net.Conn
+	// bnetOutbox queues messages sent to the server, spacing them out so the server doesn't drop them as flooding
+	bnetOutbox = onelib.NewOutbox(NAME, bnetLineInterval)
+	// bnetTopics holds the topic of each joined channel, only accessed by handleConnection
+	bnetTopics = make(map[string]string)
+	// bnetSources holds the last full source ("nick!user@host") seen for each nick, so events which only name a nick
+	// (Ex: KICK) use the same UUID as the user's other events. Only accessed by handleConnection
+	bnetSources = make(map[string]string)
 )
 
 func loadConfig() {
@@ -39,13 +51,14 @@ func loadConfig() {
 	bnetServer = onelib.GetTextConfig(NAME, "server")
 	bnetPass = onelib.GetTextConfig(NAME, "pass")
 	bnetAutoJoin = onelib.GetTextConfig(NAME, "auto_join")
+	bnetColors = onelib.GetBoolConfig(NAME, "colors")
 }
 
 // Load connects to BnetProtocol, and sets up listeners. It's required for OneBot.
 func Load() onelib.Protocol {
 	loadConfig()
 
-	bnetClient := &BnetProtocol{prefix: onelib.DefaultPrefix}
+	bnetClient := new(BnetProtocol)
 
 	go handleConnection(bnetClient)
 
@@ -57,7 +70,7 @@ func handleConnection(c *BnetProtocol) {
 		var err error
 		bnetConn, err = net.Dial("tcp", bnetServer)
 		if err != nil {
-			onelib.Error.Println("[bnet]", err)
+			log.Error.Println(err)
 			time.Sleep(time.Second * 30)
 			continue
 		}
@@ -89,6 +102,7 @@ func handleConnection(c *BnetProtocol) {
 				msg := &bnetMessage{text: strings.Join(splitMsg[3:], " ")}
 				splitMsg[0] = splitMsg[0][1:]
 				senderNick := strings.Split(splitMsg[0], "!")[0]
+				bnetSources[senderNick] = splitMsg[0]
 				var loc *bnetLocation
 				if splitMsg[2] != bnetNick {
 					loc = &bnetLocation{displayName: splitMsg[2], uuid: onelib.UUID(splitMsg[2])}
@@ -97,9 +111,59 @@ func handleConnection(c *BnetProtocol) {
 				}
 				sender := &bnetSender{displayName: senderNick, location: loc, uuid: onelib.UUID(splitMsg[0])}
 				c.recv(msg, sender)
+			} else if splitMsg[1] == "332" && len(splitMsg) > 3 { // topic sent on join
+				bnetTopics[splitMsg[3]] = ircTrailing(splitMsg, 4)
+			} else if len(splitMsg) > 2 {
+				c.handleEvent(splitMsg)
 			}
-			//onelib.Debug.Println("[bnet]", msgStr)
+			//log.Debug.Println(msgStr)
+		}
+	}
+}
+
+// ircTrailing returns the parameters of an IRC message from i onwards, without the leading ':'.
+func ircTrailing(splitMsg []string, i int) string {
+	if len(splitMsg) <= i {
+		return ""
+	}
+	return strings.TrimPrefix(strings.Join(splitMsg[i:], " "), ":")
+}
+
+// handleEvent processes membership and topic changes. splitMsg is the IRC message split on spaces.
+func (bp *BnetProtocol) handleEvent(splitMsg []string) {
+	source := strings.TrimPrefix(splitMsg[0], ":")
+	nick := strings.Split(source, "!")[0]
+	if nick == bnetNick {
+		return
+	}
+	bnetSources[nick] = source
+	channel := strings.TrimPrefix(splitMsg[2], ":")
+	loc := &bnetLocation{displayName: channel, uuid: onelib.UUID(channel)}
+	sender := &bnetSender{displayName: nick, location: loc, uuid: onelib.UUID(source)}
+	switch splitMsg[1] {
+	case "JOIN":
+		onelib.ProcessPresence(&onelib.PresenceUpdate{Type: onelib.PresenceJoin}, sender)
+	case "PART":
+		onelib.ProcessPresence(&onelib.PresenceUpdate{Type: onelib.PresenceLeave, Reason: ircTrailing(splitMsg, 3)}, sender)
+	case "QUIT":
+		delete(bnetSources, nick)
+		sender.location = new(bnetLocation)
+		onelib.ProcessPresence(&onelib.PresenceUpdate{Type: onelib.PresenceLeave, Reason: ircTrailing(splitMsg, 2)}, sender)
+	case "KICK":
+		if len(splitMsg) < 4 || splitMsg[3] == bnetNick {
+			return
+		}
+		// KICK only names the kicked user's nick, so their UUID is the bare nick if they haven't been seen yet
+		kickedSource, ok := bnetSources[splitMsg[3]]
+		if !ok {
+			kickedSource = splitMsg[3]
 		}
+		kicked := &bnetSender{displayName: splitMsg[3], location: loc, uuid: onelib.UUID(kickedSource)}
+		onelib.ProcessPresence(&onelib.PresenceUpdate{Type: onelib.PresenceKick, By: onelib.UUID(source), Reason: ircTrailing(splitMsg, 4)}, kicked)
+	case "TOPIC":
+		update := &onelib.LocationUpdate{Type: onelib.LocationTopic, Old: bnetTopics[channel], New: ircTrailing(splitMsg, 3), By: onelib.UUID(source)}
+		bnetTopics[channel] = update.New
+		onelib.ProcessLocationUpdate(update, loc)
 	}
 }
 
@@ -108,7 +172,6 @@ type BnetProtocol struct {
 	/*
 	   Store useful data here such as connected rooms, admins, nickname, accepted prefixes, etc
 	*/
-	prefix string
 }
 
 // Name returns the name of the plugin, usually the filename.
@@ -132,23 +195,23 @@ func (bp *BnetProtocol) NewMessage(raw []byte) onelib.Message {
 }
 
 // Send sends a Message object to a location specified by to (usually a location or sender UUID).
-func (bp *BnetProtocol) Send(to onelib.UUID, msg onelib.Message) {
-	bnetSendText(to, msg.Text())
+func (bp *BnetProtocol) Send(to onelib.UUID, msg onelib.Message) (*onelib.SentMessage, error) {
+	return bnetSendText(to, msg.Text())
 }
 
 // SendText sends text to a location specified by to (usually a location or sender UUID).
-func (bp *BnetProtocol) SendText(to onelib.UUID, text string) {
-	bnetSendText(to, text)
+func (bp *BnetProtocol) SendText(to onelib.UUID, text string) (*onelib.SentMessage, error) {
+	return bnetSendText(to, text)
 }
 
 // SendFormattedText sends formatted text to a location specified by to (usually a location or sender UUID).
-func (bp *BnetProtocol) SendFormattedText(to onelib.UUID, text, formattedText string) {
-	bnetSendText(to, text)
+func (bp *BnetProtocol) SendFormattedText(to onelib.UUID, text, formattedText string) (*onelib.SentMessage, error) {
+	return bnetSendText(to, text)
 }
 
 // recv should be called after you've recieved data and built a Message object
 func (bp *BnetProtocol) recv(msg onelib.Message, sender onelib.Sender) {
-	onelib.ProcessMessage([]string{bp.prefix}, msg, sender)
+	onelib.ProcessMessage([]string{bnetNick + ": ", bnetNick + ", "}, msg, sender)
 }
 
 // Remove should disconnect any open connections making it so the bot can forget about the protocol cleanly.
@@ -167,12 +230,12 @@ func (bm *bnetMessage) Mentioned() bool {
 }
 
 func (bm *bnetMessage) UUID() onelib.UUID {
-	onelib.Debug.Printf("[%s] Message UUIDs not supported.\n", NAME)
+	log.Debug.Println("Message UUIDs not supported.")
 	return onelib.UUID("")
 }
 
 func (bm *bnetMessage) Reaction() *onelib.Emoji {
-	onelib.Debug.Printf("[%s] Reactions not supported.\n", NAME)
+	log.Debug.Println("Reactions not supported.")
 	return nil
 }
 
@@ -195,15 +258,30 @@ func (bm *bnetMessage) Raw() []byte {
 	return []byte(bm.text)
 }
 
-func bnetSendText(to onelib.UUID, text string) {
+// bnetLineInterval is how long to wait between lines sent to the server, so it doesn't drop them as flooding.
+const bnetLineInterval = 200 * time.Millisecond
+
+// bnetSendText sends text to a channel or user, a line at a time. The lines are queued together, so they aren't
+// interleaved with other messages to the same channel or user. If writing a line times out, the send is retried from
+// that line. IRC messages have no IDs, so the handle returned only says where and when it was sent.
+func bnetSendText(to onelib.UUID, text string) (*onelib.SentMessage, error) {
 	lines := strings.Split(text, "\n")
-	for _, msg := range lines {
-		_, err := bnetConn.Write([]byte(fmt.Sprintf("PRIVMSG %s :%s\r\n", string(to), msg)))
-		if err != nil {
-			onelib.Error.Println(err)
+	sent := 0
+	err := bnetOutbox.Send(to, func() error {
+		for ; sent < len(lines); sent++ {
+			if sent > 0 {
+				time.Sleep(bnetLineInterval)
+			}
+			if _, err := bnetConn.Write([]byte(fmt.Sprintf("PRIVMSG %s :%s\r\n", string(to), lines[sent]))); err != nil {
+				return err // Retried by the outbox if it's a timeout (see onelib.Retryable)
+			}
 		}
-		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return onelib.NewSentMessage("", to, NAME), nil
 }
 
 type bnetSender struct {
@@ -236,16 +314,16 @@ func (bs *bnetSender) Protocol() string {
 	return NAME
 }
 
-func (bs *bnetSender) Send(msg onelib.Message) {
-	bnetSendText(bs.uuid, msg.Text())
+func (bs *bnetSender) Send(msg onelib.Message) (*onelib.SentMessage, error) {
+	return bnetSendText(bs.uuid, msg.Text())
 }
 
-func (bs *bnetSender) SendText(text string) {
-	bnetSendText(bs.uuid, text)
+func (bs *bnetSender) SendText(text string) (*onelib.SentMessage, error) {
+	return bnetSendText(bs.uuid, text)
 }
 
-func (bs *bnetSender) SendFormattedText(text, formattedText string) {
-	bnetSendText(bs.uuid, text)
+func (bs *bnetSender) SendFormattedText(text, formattedText string) (*onelib.SentMessage, error) {
+	return bnetSendText(bs.uuid, text)
 }
 
 type bnetLocation struct {
@@ -269,16 +347,33 @@ func (bl *bnetLocation) UUID() onelib.UUID {
 	return bl.uuid
 }
 
-func (bl *bnetLocation) Send(msg onelib.Message) {
-	bnetSendText(bl.uuid, msg.Text())
+func (bl *bnetLocation) Send(msg onelib.Message) (*onelib.SentMessage, error) {
+	return bnetSendText(bl.uuid, msg.Text())
+}
+
+func (bl *bnetLocation) SendText(text string) (*onelib.SentMessage, error) {
+	return bnetSendText(bl.uuid, text)
 }
 
-func (bl *bnetLocation) SendText(text string) {
-	bnetSendText(bl.uuid, text)
+func (bl *bnetLocation) SendFormattedText(text, formattedText string) (*onelib.SentMessage, error) {
+	return bnetSendText(bl.uuid, text)
 }
 
-func (bl *bnetLocation) SendFormattedText(text, formattedText string) {
-	bnetSendText(bl.uuid, text)
+// SendDocument sends the document as plain text, or with mIRC formatting codes if enabled.
+func (bl *bnetLocation) SendDocument(doc *onelib.Document) (*onelib.SentMessage, error) {
+	if bnetColors {
+		return bnetSendText(bl.uuid, doc.IRC(bl))
+	}
+	return bnetSendText(bl.uuid, doc.PlainText(bl))
+}
+
+// Mention returns the user's nick, IRC has no other kind of mention.
+func (bl *bnetLocation) Mention(mention *onelib.Mention) (string, string) {
+	name := mention.DisplayName
+	if name == "" {
+		name = string(mention.UUID)
+	}
+	return name, name
 }
 
 func (bl *bnetLocation) Protocol() string {
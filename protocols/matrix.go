@@ -3,10 +3,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"html"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/TheDiscordian/onebot/onelib"
 	"github.com/matrix-org/gomatrix"
@@ -19,9 +27,15 @@ const (
 	LONGNAME = "Matrix"
 	// VERSION of the script
 	VERSION = "v0.0.0"
+
+	// messageCacheSize is how many recent messages are remembered, so edits and redactions can include the old message
+	messageCacheSize = 1000
 )
 
 var (
+	// log tags lines with the name of the protocol
+	log = onelib.NewProtocolLog(NAME)
+
 	// matrixHomeServer
 	matrixHomeServer string
 	// matrixAuthUser
@@ -30,6 +44,9 @@ var (
 	matrixAuthToken string
 	// matrixAuthPass
 	matrixAuthPass string
+
+	// outbox queues every event sent, homeservers tell us how long to back off when rate limiting
+	outbox = onelib.NewOutbox(NAME, 100*time.Millisecond)
 )
 
 func loadConfig() {
@@ -84,10 +101,137 @@ func (cli *matrixClient) MarkRead(roomID, eventID string) error {
 }
 
 type matrixProtocolMessage struct {
-	Format        string `json:"format"`
-	Msgtype       string `json:"msgtype"`
-	Body          string `json:"body"`
-	FormattedBody string `json:"formatted_body"`
+	Format        string                 `json:"format,omitempty"`
+	Msgtype       string                 `json:"msgtype"`
+	Body          string                 `json:"body"`
+	FormattedBody string                 `json:"formatted_body,omitempty"`
+	RelatesTo     *matrixRelatesTo       `json:"m.relates_to,omitempty"`
+	NewContent    *matrixProtocolMessage `json:"m.new_content,omitempty"` // the replacement content of an edit
+}
+
+// matrixRelatesTo relates a message to another, as a reply, or as part of a thread. See
+// https://spec.matrix.org/v1.4/client-server-api/#rich-replies and https://spec.matrix.org/v1.4/client-server-api/#threading
+type matrixRelatesTo struct {
+	RelType       string           `json:"rel_type,omitempty"`
+	EventID       string           `json:"event_id,omitempty"`
+	IsFallingBack bool             `json:"is_falling_back,omitempty"`
+	InReplyTo     *matrixInReplyTo `json:"m.in_reply_to,omitempty"`
+	Key           string           `json:"key,omitempty"` // the emoji of a reaction
+}
+
+// matrixFileMessage is the content of an m.image, m.video, m.audio, or m.file message. See
+// https://spec.matrix.org/v1.4/client-server-api/#mimage
+type matrixFileMessage struct {
+	Msgtype  string          `json:"msgtype"`
+	Body     string          `json:"body"`               // a caption if Filename is set, otherwise the file name
+	Filename string          `json:"filename,omitempty"` // the file name, if Body is a caption
+	URL      string          `json:"url"`
+	Info     *matrixFileInfo `json:"info,omitempty"`
+}
+
+type matrixFileInfo struct {
+	Mimetype string `json:"mimetype,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+// attachment returns the file sent in an m.image, m.video, m.audio, or m.file message's content, or nil if it isn't
+// one of those (or is encrypted).
+func (mc *matrixClient) attachment(msgtype string, content map[string]interface{}) *onelib.Attachment {
+	switch msgtype {
+	case "m.image", "m.video", "m.audio", "m.file":
+	default:
+		return nil
+	}
+	mxc, _ := content["url"].(string)
+	if !strings.HasPrefix(mxc, "mxc://") {
+		return nil
+	}
+	attachment := &onelib.Attachment{URL: mc.BuildBaseURL("_matrix/media/r0/download", strings.TrimPrefix(mxc, "mxc://"))}
+	if attachment.Name, _ = content["filename"].(string); attachment.Name == "" {
+		attachment.Name, _ = content["body"].(string)
+	}
+	if info, ok := content["info"].(map[string]interface{}); ok {
+		attachment.MIMEType, _ = info["mimetype"].(string)
+		if size, ok := info["size"].(float64); ok {
+			attachment.Size = int64(size)
+		}
+	}
+	return attachment
+}
+
+// matrixReaction is the content of an m.reaction event, see
+// https://spec.matrix.org/v1.4/client-server-api/#event-annotations-and-reactions
+type matrixReaction struct {
+	RelatesTo *matrixRelatesTo `json:"m.relates_to"`
+}
+
+type matrixInReplyTo struct {
+	EventID string `json:"event_id"`
+}
+
+// relations returns the event a message's content replies to, and the root of the thread it's in, if any.
+func relations(content map[string]interface{}) (replyTo, thread onelib.UUID) {
+	relatesTo, _ := content["m.relates_to"].(map[string]interface{})
+	if inReplyTo, ok := relatesTo["m.in_reply_to"].(map[string]interface{}); ok {
+		id, _ := inReplyTo["event_id"].(string)
+		replyTo = onelib.UUID(id)
+	}
+	if relatesTo["rel_type"] == "m.thread" {
+		id, _ := relatesTo["event_id"].(string)
+		thread = onelib.UUID(id)
+		// m.in_reply_to is only there for clients without thread support
+		if isFallingBack, _ := relatesTo["is_falling_back"].(bool); isFallingBack {
+			replyTo = ""
+		}
+	}
+	return
+}
+
+// pillPattern matches links to users and rooms (pills) in formatted text, see
+// https://spec.matrix.org/v1.4/client-server-api/#user-and-room-mentions
+var pillPattern = regexp.MustCompile(`<a href="https://matrix\.to/#/([^"?]+)[^"]*">(.*?)</a>`)
+
+// parseMentions returns the users and rooms mentioned by pills in formattedText, in the order they appear, followed by
+// any other users listed in the content's m.mentions.
+func parseMentions(content map[string]interface{}, formattedText string) []*onelib.Mention {
+	var mentions []*onelib.Mention
+	seen := make(map[onelib.UUID]bool)
+	for _, match := range pillPattern.FindAllStringSubmatch(formattedText, -1) {
+		id, err := url.PathUnescape(match[1])
+		if err != nil || id == "" {
+			continue
+		}
+		mention := &onelib.Mention{Type: onelib.MentionUser, UUID: onelib.UUID(id), DisplayName: html.UnescapeString(match[2])}
+		if id[0] == '#' || id[0] == '!' {
+			mention.Type = onelib.MentionLocation
+		} else if id[0] != '@' {
+			continue
+		}
+		seen[mention.UUID] = true
+		mentions = append(mentions, mention)
+	}
+	if m, ok := content["m.mentions"].(map[string]interface{}); ok {
+		userIDs, _ := m["user_ids"].([]interface{})
+		for _, userID := range userIDs {
+			if id, _ := userID.(string); id != "" && !seen[onelib.UUID(id)] {
+				mentions = append(mentions, &onelib.Mention{Type: onelib.MentionUser, UUID: onelib.UUID(id)})
+			}
+		}
+	}
+	return mentions
+}
+
+// stripReplyFallback removes the quote of the replied to message some clients add to the start of replies.
+func stripReplyFallback(text, formattedText string) (string, string) {
+	if strings.HasPrefix(text, "> ") {
+		if i := strings.Index(text, "\n\n"); i != -1 {
+			text = text[i+2:]
+		}
+	}
+	if i := strings.Index(formattedText, "</mx-reply>"); i != -1 {
+		formattedText = formattedText[i+len("</mx-reply>"):]
+	}
+	return text, formattedText
 }
 
 func (client *matrixClient) setAvatarToFile(fPath string) error {
@@ -109,7 +253,7 @@ func (client *matrixClient) setAvatarToFile(fPath string) error {
 	if err != nil {
 		return err
 	}
-	onelib.Info.Println("Avatar set! ContentURI:", resp.ContentURI)
+	log.Info.Println("Avatar set! ContentURI:", resp.ContentURI)
 	client.SetAvatarURL(resp.ContentURI)
 	return nil
 }
@@ -121,7 +265,7 @@ func Load() onelib.Protocol {
 
 	client, err := gomatrix.NewClient(matrixHomeServer, matrixAuthUser, matrixAuthToken)
 	if err != nil {
-		onelib.Error.Panicln(err)
+		log.Error.Panicln(err)
 	}
 	if matrixAuthToken == "" {
 		if matrixAuthUser == "" {
@@ -133,65 +277,197 @@ func Load() onelib.Protocol {
 			Password: matrixAuthPass,
 		})
 		if err != nil {
-			onelib.Error.Panicln(err)
+			log.Error.Panicln(err)
 		}
 		onelib.SetTextConfig(NAME, "auth_token", resp.AccessToken)
-		onelib.Info.Println("Access token (saved):", resp.AccessToken)
+		log.Info.Println("Access token (saved):", resp.AccessToken)
 		client.SetCredentials(resp.UserID, resp.AccessToken)
 	}
 	syncer := client.Syncer.(*gomatrix.DefaultSyncer)
 
-	matrix := &Matrix{client: &matrixClient{Client: client}, prefix: onelib.DefaultPrefix, nickname: onelib.DefaultNickname, knownMembers: new(memberMap)}
+	matrix := &Matrix{client: &matrixClient{Client: client}, nickname: onelib.DefaultNickname, knownMembers: new(memberMap), started: time.Now().UnixNano() / int64(time.Millisecond)}
 	matrix.knownMembers.mMap = make(map[onelib.UUID]*member, 1)
 	matrix.knownMembers.lock = new(sync.RWMutex)
+	matrix.messages = onelib.NewMessageCache(messageCacheSize)
+	matrix.reactions = onelib.NewMessageCache(messageCacheSize)
 
 	syncer.OnEventType("m.room.message", func(ev *gomatrix.Event) {
-		if ev.Content["msgtype"] != nil && ev.Content["msgtype"].(string) == "m.text" {
-			msg := &matrixMessage{text: ev.Content["body"].(string)} // FIXME just because msgtype is m.text, doesn't mean body *absolutely* exists
-			if ev.Content["format"] != nil && ev.Content["format"].(string) == "org.matrix.custom.html" {
-				msg.formattedText = ev.Content["formatted_body"].(string) // FIXME just because format is org.matrix.custom.html, doesn't mean formatted_body *absolutely* exists
+		content := ev.Content
+		var editOf string
+		if relatesTo, ok := ev.Content["m.relates_to"].(map[string]interface{}); ok && relatesTo["rel_type"] == "m.replace" {
+			if newContent, ok := ev.Content["m.new_content"].(map[string]interface{}); ok {
+				editOf, _ = relatesTo["event_id"].(string)
+				content = newContent
 			}
-			mc := &matrixClient{Client: client}
-			ml := &matrixLocation{Client: mc, uuid: onelib.UUID(ev.RoomID)}
-			var displayName string
-			tuser := matrix.knownMembers.Get(onelib.UUID(ev.Sender))
-			if tuser == nil {
-				resp, err := client.GetDisplayName(ev.Sender)
-				if err != nil {
-					onelib.Debug.Println("Error getting display name:", err)
-					displayName = ev.Sender
-				} else {
-					displayName = resp.DisplayName
+		}
+		msgtype, _ := content["msgtype"].(string)
+		if attachment := matrix.client.attachment(msgtype, content); msgtype == "m.text" || attachment != nil {
+			msg := &matrixMessage{id: onelib.UUID(ev.ID)}
+			msg.text, _ = content["body"].(string)
+			if format, _ := content["format"].(string); format == "org.matrix.custom.html" {
+				msg.formattedText, _ = content["formatted_body"].(string)
+			}
+			if attachment != nil {
+				msg.attachments = []*onelib.Attachment{attachment}
+				if msg.text == attachment.Name { // the body is only a caption if it isn't the file name
+					msg.text, msg.formattedText = "", ""
+				}
+			}
+			msg.mentions = parseMentions(content, msg.formattedText)
+			sender := matrix.newSender(ev)
+			if editOf != "" {
+				msg.id = onelib.UUID(editOf)
+				edit := &onelib.MessageEdit{New: msg}
+				if old := matrix.messages.Get(msg.id); old != nil {
+					edit.Old = old.Message
+					msg.replyTo, msg.thread = onelib.ReplyTo(old.Message)
 				}
-				matrix.knownMembers.Set(onelib.UUID(ev.Sender), &member{displayName: displayName})
+				matrix.messages.Put(msg.id, msg, sender)
+				matrix.edit(edit, sender)
 			} else {
-				displayName = tuser.displayName
+				msg.replyTo, msg.thread = relations(content)
+				if msg.replyTo != "" {
+					msg.text, msg.formattedText = stripReplyFallback(msg.text, msg.formattedText)
+				}
+				matrix.messages.Put(msg.id, msg, sender)
+				matrix.recv(onelib.Message(msg), onelib.Sender(sender))
 			}
-			sender := &matrixSender{uuid: onelib.UUID(ev.Sender), username: ev.Sender, displayName: displayName, location: ml}
-			matrix.recv(onelib.Message(msg), onelib.Sender(sender))
-			onelib.Debug.Printf("%s: %s\n", displayName, msg.Text())
+			log.Debug.Printf("%s: %s\n", sender.displayName, msg.Text())
 		} else {
-			onelib.Debug.Println("Message: ", ev)
+			log.Debug.Println("Message: ", ev)
 		}
 		err = matrix.client.MarkRead(ev.RoomID, ev.ID)
 		if err != nil {
-			onelib.Error.Println(err)
+			log.Error.Println(err)
 		}
 	})
 
+	syncer.OnEventType("m.reaction", func(ev *gomatrix.Event) {
+		if !matrix.isNew(ev) {
+			return
+		}
+		relatesTo, _ := ev.Content["m.relates_to"].(map[string]interface{})
+		target, _ := relatesTo["event_id"].(string)
+		key, _ := relatesTo["key"].(string)
+		if relatesTo["rel_type"] != "m.annotation" || target == "" || key == "" {
+			return
+		}
+		msg := &matrixMessage{id: onelib.UUID(target), emoji: &onelib.Emoji{ID: onelib.UUID(key), Name: key, Added: true}}
+		sender := matrix.newSender(ev)
+		matrix.reactions.Put(onelib.UUID(ev.ID), msg, sender)
+		matrix.update(msg, sender)
+	})
+
+	syncer.OnEventType("m.room.redaction", func(ev *gomatrix.Event) {
+		if ev.Redacts == "" || !matrix.isNew(ev) {
+			return
+		}
+		if reaction := matrix.reactions.Delete(onelib.UUID(ev.Redacts)); reaction != nil {
+			emoji := *reaction.Message.Reaction()
+			emoji.Added = false
+			matrix.update(&matrixMessage{id: reaction.Message.UUID(), emoji: &emoji}, reaction.Sender)
+			return
+		}
+		del := &onelib.MessageDelete{UUID: onelib.UUID(ev.Redacts)}
+		if old := matrix.messages.Delete(del.UUID); old != nil {
+			del.Old = old.Message
+			del.Sender = old.Sender
+			if old.Sender.UUID() != onelib.UUID(ev.Sender) {
+				del.By = onelib.UUID(ev.Sender)
+			}
+		}
+		matrix.delete(del, &matrixLocation{Client: &matrixClient{Client: client}, uuid: onelib.UUID(ev.RoomID)})
+	})
+
 	syncer.OnEventType("m.room.third_party_invite", func(ev *gomatrix.Event) {
-		onelib.Debug.Println("Third Party Invite: ", ev)
+		log.Debug.Println("Third Party Invite: ", ev)
 	})
 	syncer.OnEventType("m.room.member", func(ev *gomatrix.Event) {
-		if ev.Content["membership"] != nil && ev.Content["membership"].(string) == "invite" {
-			_, err = client.JoinRoom(ev.RoomID, "", nil)
-			if err != nil {
-				onelib.Error.Println(err)
+		if ev.StateKey == nil {
+			return
+		}
+		membership, _ := ev.Content["membership"].(string)
+		if *ev.StateKey == client.UserID {
+			if membership == "invite" {
+				_, err := client.JoinRoom(ev.RoomID, "", nil)
+				if err != nil {
+					log.Error.Println(err)
+				}
 			}
-		} else {
-			onelib.Debug.Println("Member: ", ev)
+			return
+		}
+		if !matrix.isNew(ev) {
+			return
+		}
+		displayName, _ := ev.Content["displayname"].(string)
+		if displayName == "" {
+			displayName = *ev.StateKey
+		}
+		prevMembership, _ := prevContent(ev)["membership"].(string)
+		update := new(onelib.PresenceUpdate)
+		switch membership {
+		case "join":
+			if prevMembership == "join" { // profile change
+				matrix.knownMembers.Set(onelib.UUID(*ev.StateKey), &member{displayName: displayName})
+				return
+			}
+			update.Type = onelib.PresenceJoin
+		case "leave":
+			if prevMembership == "ban" { // unban
+				return
+			}
+			update.Type = onelib.PresenceLeave
+			if ev.Sender != *ev.StateKey {
+				update.Type = onelib.PresenceKick
+			}
+		case "invite":
+			update.Type = onelib.PresenceInvite
+		case "ban":
+			update.Type = onelib.PresenceBan
+		default:
+			log.Debug.Println("Member: ", ev)
+			return
+		}
+		if ev.Sender != *ev.StateKey {
+			update.By = onelib.UUID(ev.Sender)
+		}
+		update.Reason, _ = ev.Content["reason"].(string)
+		ml := &matrixLocation{Client: &matrixClient{Client: client}, uuid: onelib.UUID(ev.RoomID)}
+		sender := &matrixSender{uuid: onelib.UUID(*ev.StateKey), username: *ev.StateKey, displayName: displayName, location: ml}
+		matrix.presence(update, sender)
+	})
+	syncer.OnEventType("m.room.topic", func(ev *gomatrix.Event) {
+		if !matrix.isNew(ev) {
+			return
 		}
+		update := &onelib.LocationUpdate{Type: onelib.LocationTopic, By: onelib.UUID(ev.Sender)}
+		update.New, _ = ev.Content["topic"].(string)
+		update.Old, _ = prevContent(ev)["topic"].(string)
+		matrix.locationUpdate(update, &matrixLocation{Client: &matrixClient{Client: client}, uuid: onelib.UUID(ev.RoomID), topic: update.New})
 	})
+	syncer.OnEventType("m.room.name", func(ev *gomatrix.Event) {
+		if !matrix.isNew(ev) {
+			return
+		}
+		update := &onelib.LocationUpdate{Type: onelib.LocationName, By: onelib.UUID(ev.Sender)}
+		update.New, _ = ev.Content["name"].(string)
+		update.Old, _ = prevContent(ev)["name"].(string)
+		matrix.locationUpdate(update, &matrixLocation{Client: &matrixClient{Client: client}, uuid: onelib.UUID(ev.RoomID), displayName: update.New})
+	})
+	client.Syncer = &matrixSyncer{DefaultSyncer: syncer, onPresence: func(ev *gomatrix.Event) {
+		if ev.Sender == client.UserID {
+			return
+		}
+		update := &onelib.PresenceUpdate{Type: onelib.PresenceStatus}
+		update.Status, _ = ev.Content["presence"].(string)
+		update.StatusText, _ = ev.Content["status_msg"].(string)
+		displayName, _ := ev.Content["displayname"].(string)
+		if displayName == "" {
+			displayName = ev.Sender
+		}
+		sender := &matrixSender{uuid: onelib.UUID(ev.Sender), username: ev.Sender, displayName: displayName, location: &matrixLocation{Client: &matrixClient{Client: client}}}
+		matrix.presence(update, sender)
+	}}
 
 	client.SetDisplayName(onelib.DefaultNickname)
 	// client.setAvatarToFile(onelib.DefaultAvatar) // TODO only do this if avatar hasn't been set yet
@@ -201,15 +477,49 @@ func Load() onelib.Protocol {
 		Status string `json:"status"`
 	}{"Test status"})*/
 	if err != nil {
-		onelib.Error.Println("Error setting presence:", err)
+		log.Error.Println("Error setting presence:", err)
 	}
 
 	go matrix.handleconnections()
 	return onelib.Protocol(matrix)
 }
 
+// matrixSyncer is gomatrix's DefaultSyncer, also passing presence events (which it ignores) to onPresence.
+type matrixSyncer struct {
+	*gomatrix.DefaultSyncer
+	onPresence func(ev *gomatrix.Event)
+}
+
+// ProcessResponse processes the sync response, then any presence events in it. The presence events in the first sync
+// are skipped, as they describe presence from before the bot connected.
+func (ms *matrixSyncer) ProcessResponse(res *gomatrix.RespSync, since string) error {
+	if err := ms.DefaultSyncer.ProcessResponse(res, since); err != nil {
+		return err
+	}
+	if since == "" {
+		return nil
+	}
+	for i := range res.Presence.Events {
+		ms.onPresence(&res.Presence.Events[i])
+	}
+	return nil
+}
+
+// prevContent returns the content of the state event ev replaced, if known.
+func prevContent(ev *gomatrix.Event) map[string]interface{} {
+	if ev.PrevContent != nil {
+		return ev.PrevContent
+	}
+	prev, _ := ev.Unsigned["prev_content"].(map[string]interface{})
+	return prev
+}
+
 type matrixMessage struct {
+	id, replyTo, thread onelib.UUID
 	formattedText, text string
+	emoji               *onelib.Emoji
+	attachments         []*onelib.Attachment
+	mentions            []*onelib.Mention
 }
 
 func (mm *matrixMessage) Mentioned() bool {
@@ -217,13 +527,27 @@ func (mm *matrixMessage) Mentioned() bool {
 }
 
 func (mm *matrixMessage) UUID() onelib.UUID {
-	onelib.Debug.Printf("[%s] Message UUIDs not yet supported.\n", NAME)
-	return onelib.UUID("")
+	return mm.id
+}
+
+func (mm *matrixMessage) ReplyTo() onelib.UUID {
+	return mm.replyTo
+}
+
+func (mm *matrixMessage) Thread() onelib.UUID {
+	return mm.thread
+}
+
+func (mm *matrixMessage) Attachments() []*onelib.Attachment {
+	return mm.attachments
+}
+
+func (mm *matrixMessage) Mentions() []*onelib.Mention {
+	return mm.mentions
 }
 
 func (mm *matrixMessage) Reaction() *onelib.Emoji {
-	onelib.Debug.Printf("[%s] Reactions not yet supported.\n", NAME)
-	return nil
+	return mm.emoji
 }
 
 func (mm *matrixMessage) Text() string {
@@ -238,7 +562,7 @@ func (mm *matrixMessage) StripPrefix(prefix string) onelib.Message {
 	if len(mm.text) > len(prefix) {
 		prefix = prefix + " "
 	}
-	return onelib.Message(&matrixMessage{text: strings.Replace(mm.text, prefix, "", 1), formattedText: strings.Replace(mm.formattedText, prefix, "", 1)})
+	return onelib.Message(&matrixMessage{id: mm.id, replyTo: mm.replyTo, thread: mm.thread, attachments: mm.attachments, mentions: mm.mentions, text: strings.Replace(mm.text, prefix, "", 1), formattedText: strings.Replace(mm.formattedText, prefix, "", 1)})
 }
 
 func (mm *matrixMessage) Raw() []byte {
@@ -275,16 +599,16 @@ func (ms *matrixSender) Protocol() string {
 	return NAME
 }
 
-func (ms *matrixSender) Send(msg onelib.Message) {
-	ms.location.Client.Send(ms.uuid, msg)
+func (ms *matrixSender) Send(msg onelib.Message) (*onelib.SentMessage, error) {
+	return ms.location.Client.Send(ms.uuid, msg)
 }
 
-func (ms *matrixSender) SendText(text string) {
-	ms.location.Client.SendText(ms.uuid, text)
+func (ms *matrixSender) SendText(text string) (*onelib.SentMessage, error) {
+	return ms.location.Client.SendText(ms.uuid, text)
 }
 
-func (ms *matrixSender) SendFormattedText(text, formattedText string) {
-	ms.location.Client.SendFormattedText(ms.uuid, text, formattedText)
+func (ms *matrixSender) SendFormattedText(text, formattedText string) (*onelib.SentMessage, error) {
+	return ms.location.Client.SendFormattedText(ms.uuid, text, formattedText)
 }
 
 type matrixLocation struct {
@@ -309,16 +633,60 @@ func (ml *matrixLocation) UUID() onelib.UUID {
 	return ml.uuid
 }
 
-func (ml *matrixLocation) Send(msg onelib.Message) {
-	ml.Client.Send(ml.uuid, msg)
+func (ml *matrixLocation) Send(msg onelib.Message) (*onelib.SentMessage, error) {
+	return ml.Client.Send(ml.uuid, msg)
+}
+
+func (ml *matrixLocation) SendText(text string) (*onelib.SentMessage, error) {
+	return ml.Client.SendText(ml.uuid, text)
+}
+
+func (ml *matrixLocation) SendFormattedText(text, formattedText string) (*onelib.SentMessage, error) {
+	return ml.Client.SendFormattedText(ml.uuid, text, formattedText)
+}
+
+func (ml *matrixLocation) Reply(to onelib.Message, text, formattedText string) (*onelib.SentMessage, error) {
+	return ml.Client.SendReply(ml.uuid, to, text, formattedText)
+}
+
+func (ml *matrixLocation) React(messageID onelib.UUID, emoji string) error {
+	_, err := ml.Client.sendEvent(ml.uuid, "m.reaction", &matrixReaction{RelatesTo: &matrixRelatesTo{RelType: "m.annotation", EventID: string(messageID), Key: emoji}})
+	return err
+}
+
+func (ml *matrixLocation) Unreact(messageID onelib.UUID, emoji string) error {
+	reactionID, err := ml.Client.ownReaction(string(ml.uuid), string(messageID), emoji)
+	if err != nil || reactionID == "" {
+		return err
+	}
+	_, err = ml.Client.RedactEvent(string(ml.uuid), reactionID, &gomatrix.ReqRedact{})
+	return err
+}
+
+// Edit replaces the text of a message the bot sent.
+func (ml *matrixLocation) Edit(messageID onelib.UUID, text, formattedText string) error {
+	return ml.Client.Edit(ml.uuid, messageID, text, formattedText)
+}
+
+// Delete redacts the message.
+func (ml *matrixLocation) Delete(messageID onelib.UUID) error {
+	return ml.Client.Delete(ml.uuid, messageID)
 }
 
-func (ml *matrixLocation) SendText(text string) {
-	ml.Client.SendText(ml.uuid, text)
+func (ml *matrixLocation) SendAttachment(ctx context.Context, attachment *onelib.Attachment, text string) (*onelib.SentMessage, error) {
+	return ml.Client.SendAttachment(ctx, ml.uuid, attachment, text)
 }
 
-func (ml *matrixLocation) SendFormattedText(text, formattedText string) {
-	ml.Client.SendFormattedText(ml.uuid, text, formattedText)
+// Mention returns a pill linking to the user or room. Matrix has no roles, so role mentions are plain text.
+func (ml *matrixLocation) Mention(mention *onelib.Mention) (string, string) {
+	name := mention.DisplayName
+	if name == "" {
+		name = string(mention.UUID)
+	}
+	if mention.Type == onelib.MentionRole {
+		return "@" + name, "@" + html.EscapeString(name)
+	}
+	return name, `<a href="https://matrix.to/#/` + url.PathEscape(string(mention.UUID)) + `">` + html.EscapeString(name) + `</a>`
 }
 
 func (ml *matrixLocation) Protocol() string {
@@ -329,24 +697,148 @@ type matrixClient struct {
 	*gomatrix.Client
 }
 
+// sendEvent queues an event to be sent to the room to (see outbox), returning a handle to it once it's sent.
+func (mc *matrixClient) sendEvent(to onelib.UUID, eventType string, content interface{}) (*onelib.SentMessage, error) {
+	var resp *gomatrix.RespSendEvent
+	err := outbox.Send(to, func() (err error) {
+		resp, err = mc.SendMessageEvent(string(to), eventType, content)
+		return retryable(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return onelib.NewSentMessage(onelib.UUID(resp.EventID), to, NAME), nil
+}
+
+// retryable marks errors from the homeserver rate limiting, or being down as temporary, so the event is sent again
+// once the homeserver says to.
+func retryable(err error) error {
+	httpErr, ok := err.(gomatrix.HTTPError)
+	if !ok {
+		return err
+	}
+	if httpErr.Code == http.StatusTooManyRequests {
+		var limited struct {
+			RetryAfterMs int64 `json:"retry_after_ms"`
+		}
+		json.Unmarshal(httpErr.Contents, &limited)
+		return onelib.RetryAfter(err, time.Duration(limited.RetryAfterMs)*time.Millisecond)
+	}
+	if httpErr.Code >= http.StatusInternalServerError {
+		return onelib.RetryAfter(err, 0)
+	}
+	return err
+}
+
 // Send sends a Message object to a location specified by to (usually a location or sender UUID).
-func (mc *matrixClient) Send(to onelib.UUID, msg onelib.Message) {
-	// code here
+func (mc *matrixClient) Send(to onelib.UUID, msg onelib.Message) (*onelib.SentMessage, error) {
+	if msg.FormattedText() == "" {
+		return mc.SendText(to, msg.Text())
+	}
+	return mc.SendFormattedText(to, msg.Text(), msg.FormattedText())
 }
 
 // SendText sends text to a location specified by to (usually a location or sender UUID).
-func (mc *matrixClient) SendText(to onelib.UUID, text string) {
-	_, err := mc.Client.SendText(string(to), text)
-	if err != nil {
-		onelib.Error.Println(err)
-	}
+func (mc *matrixClient) SendText(to onelib.UUID, text string) (*onelib.SentMessage, error) {
+	return mc.sendEvent(to, "m.room.message", gomatrix.TextMessage{MsgType: "m.text", Body: text})
 }
 
 // SendFormattedText sends formatted text to a location specified by to (usually a location or sender UUID).
-func (mc *matrixClient) SendFormattedText(to onelib.UUID, text, formattedText string) {
-	_, err := mc.SendMessageEvent(string(to), "m.room.message", &matrixProtocolMessage{Body: text, FormattedBody: formattedText, Format: "org.matrix.custom.html", Msgtype: "m.text"})
+func (mc *matrixClient) SendFormattedText(to onelib.UUID, text, formattedText string) (*onelib.SentMessage, error) {
+	return mc.sendEvent(to, "m.room.message", &matrixProtocolMessage{Body: text, FormattedBody: formattedText, Format: "org.matrix.custom.html", Msgtype: "m.text"})
+}
+
+// SendReply sends formatted text to a location specified by to, in reply to the message replyTo. If replyTo is in a
+// thread, so is the reply.
+func (mc *matrixClient) SendReply(to onelib.UUID, replyTo onelib.Message, text, formattedText string) (*onelib.SentMessage, error) {
+	msg := &matrixProtocolMessage{Body: text, Msgtype: "m.text", RelatesTo: &matrixRelatesTo{InReplyTo: &matrixInReplyTo{EventID: string(replyTo.UUID())}}}
+	if formattedText != "" {
+		msg.Format, msg.FormattedBody = "org.matrix.custom.html", formattedText
+	}
+	if _, thread := onelib.ReplyTo(replyTo); thread != "" {
+		msg.RelatesTo.RelType, msg.RelatesTo.EventID = "m.thread", string(thread)
+	}
+	return mc.sendEvent(to, "m.room.message", msg)
+}
+
+// Edit replaces the text of a message the bot sent to a location specified by to. Clients which don't support edits
+// show the new text as a new message, starting with "* ". See
+// https://spec.matrix.org/v1.4/client-server-api/#event-replacements
+func (mc *matrixClient) Edit(to, messageID onelib.UUID, text, formattedText string) error {
+	newContent := &matrixProtocolMessage{Body: text, Msgtype: "m.text"}
+	msg := &matrixProtocolMessage{Body: "* " + text, Msgtype: "m.text", NewContent: newContent,
+		RelatesTo: &matrixRelatesTo{RelType: "m.replace", EventID: string(messageID)}}
+	if formattedText != "" {
+		newContent.Format, newContent.FormattedBody = "org.matrix.custom.html", formattedText
+		msg.Format, msg.FormattedBody = "org.matrix.custom.html", "* "+formattedText
+	}
+	_, err := mc.sendEvent(to, "m.room.message", msg)
+	return err
+}
+
+// Delete redacts the message in a location specified by to.
+func (mc *matrixClient) Delete(to, messageID onelib.UUID) error {
+	return outbox.Send(to, func() error {
+		_, err := mc.RedactEvent(string(to), string(messageID), &gomatrix.ReqRedact{})
+		return retryable(err)
+	})
+}
+
+// SendAttachment uploads the file to the content repository, then sends it to a location specified by to (usually a
+// location or sender UUID), with text as its caption.
+func (mc *matrixClient) SendAttachment(ctx context.Context, to onelib.UUID, attachment *onelib.Attachment, text string) (*onelib.SentMessage, error) {
+	data, err := attachment.Data(ctx)
 	if err != nil {
-		onelib.Error.Println(err)
+		return nil, err
+	}
+	var resp *gomatrix.RespMediaUpload
+	err = outbox.Send(to, func() error {
+		resp, err = mc.UploadToContentRepo(bytes.NewReader(data), attachment.MIMEType, int64(len(data)))
+		return retryable(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	msg := &matrixFileMessage{Msgtype: "m.file", Body: attachment.Name, URL: resp.ContentURI, Info: &matrixFileInfo{Mimetype: attachment.MIMEType, Size: attachment.Size}}
+	if text != "" {
+		msg.Body, msg.Filename = text, attachment.Name
+	}
+	for _, kind := range []string{"image", "video", "audio"} {
+		if strings.HasPrefix(attachment.MIMEType, kind+"/") {
+			msg.Msgtype = "m." + kind
+		}
+	}
+	return mc.sendEvent(to, "m.room.message", msg)
+}
+
+// ownReaction returns the ID of the bot's reaction with key to eventID in roomID, or an empty string if it hasn't
+// reacted with key. See https://spec.matrix.org/v1.4/client-server-api/#get_matrixclientv1roomsroomidrelationseventidreltypeeventtype
+func (mc *matrixClient) ownReaction(roomID, eventID, key string) (string, error) {
+	var from string
+	for {
+		u, _ := url.Parse(mc.BuildBaseURL("_matrix/client/v1/rooms", roomID, "relations", eventID, "m.annotation", "m.reaction"))
+		if from != "" {
+			q := u.Query()
+			q.Set("from", from)
+			u.RawQuery = q.Encode()
+		}
+		var resp struct {
+			Chunk     []*gomatrix.Event `json:"chunk"`
+			NextBatch string            `json:"next_batch"`
+		}
+		if err := mc.MakeRequest("GET", u.String(), nil, &resp); err != nil {
+			return "", err
+		}
+		for _, ev := range resp.Chunk {
+			relatesTo, _ := ev.Content["m.relates_to"].(map[string]interface{})
+			if ev.Sender == mc.UserID && relatesTo["key"] == key {
+				return ev.ID, nil
+			}
+		}
+		if resp.NextBatch == "" {
+			return "", nil
+		}
+		from = resp.NextBatch
 	}
 }
 
@@ -378,17 +870,44 @@ type Matrix struct {
 	/*
 	   Store useful data here such as connected rooms, admins, nickname, accepted prefixes, etc
 	*/
-	prefix       string
 	nickname     string
 	client       *matrixClient
 	knownMembers *memberMap
+	messages     *onelib.MessageCache
+	reactions    *onelib.MessageCache // recent reactions by event ID, so their redactions can be passed on as removed reactions
+	started      int64                // when the protocol was loaded in unix milliseconds, older state events are ignored
+}
+
+// newSender returns the sender of ev, looking up their display name if it isn't known yet.
+func (matrix *Matrix) newSender(ev *gomatrix.Event) *matrixSender {
+	var displayName string
+	tuser := matrix.knownMembers.Get(onelib.UUID(ev.Sender))
+	if tuser == nil {
+		resp, err := matrix.client.GetDisplayName(ev.Sender)
+		if err != nil {
+			log.Debug.Println("Error getting display name:", err)
+			displayName = ev.Sender
+		} else {
+			displayName = resp.DisplayName
+		}
+		matrix.knownMembers.Set(onelib.UUID(ev.Sender), &member{displayName: displayName})
+	} else {
+		displayName = tuser.displayName
+	}
+	ml := &matrixLocation{Client: &matrixClient{Client: matrix.client.Client}, uuid: onelib.UUID(ev.RoomID)}
+	return &matrixSender{uuid: onelib.UUID(ev.Sender), username: ev.Sender, displayName: displayName, location: ml}
+}
+
+// isNew returns true if ev happened after the protocol was loaded.
+func (matrix *Matrix) isNew(ev *gomatrix.Event) bool {
+	return ev.Timestamp >= matrix.started
 }
 
 // TODO finish this, only proof of concept right now
 func (matrix *Matrix) handleconnections() {
 	for {
 		if err := matrix.client.Sync(); err != nil {
-			onelib.Debug.Println("Sync() returned ", err)
+			log.Debug.Println("Sync() returned ", err)
 		}
 	}
 }
@@ -414,18 +933,28 @@ func (matrix *Matrix) NewMessage(raw []byte) onelib.Message {
 }
 
 // Send sends a Message object to a location specified by to (usually a location or sender UUID).
-func (matrix *Matrix) Send(to onelib.UUID, msg onelib.Message) {
-	matrix.client.Send(to, msg)
+func (matrix *Matrix) Send(to onelib.UUID, msg onelib.Message) (*onelib.SentMessage, error) {
+	return matrix.client.Send(to, msg)
 }
 
 // SendText sends text to a location specified by to (usually a location or sender UUID).
-func (matrix *Matrix) SendText(to onelib.UUID, text string) {
-	matrix.client.SendText(to, text)
+func (matrix *Matrix) SendText(to onelib.UUID, text string) (*onelib.SentMessage, error) {
+	return matrix.client.SendText(to, text)
 }
 
 // SendFormattedText sends formatted text to a location specified by to (usually a location or sender UUID).
-func (matrix *Matrix) SendFormattedText(to onelib.UUID, text, formattedText string) {
-	matrix.client.SendFormattedText(to, text, formattedText)
+func (matrix *Matrix) SendFormattedText(to onelib.UUID, text, formattedText string) (*onelib.SentMessage, error) {
+	return matrix.client.SendFormattedText(to, text, formattedText)
+}
+
+// Edit replaces the text of a message the bot sent to a location specified by to.
+func (matrix *Matrix) Edit(to, messageID onelib.UUID, text, formattedText string) error {
+	return matrix.client.Edit(to, messageID, text, formattedText)
+}
+
+// Delete redacts the message in a location specified by to.
+func (matrix *Matrix) Delete(to, messageID onelib.UUID) error {
+	return matrix.client.Delete(to, messageID)
 }
 
 // GetUserDisplayName returns a user's display name from a UUID
@@ -434,10 +963,41 @@ func (matrix *Matrix) SendFormattedText(to onelib.UUID, text, formattedText stri
 // recv should be called after you've recieved data and built a Message object
 func (matrix *Matrix) recv(msg onelib.Message, sender onelib.Sender) {
 	if string(sender.UUID()) != matrixAuthUser {
-		onelib.ProcessMessage([]string{matrix.prefix}, msg, sender)
+		onelib.ProcessMessage([]string{matrix.nickname + ": ", matrixAuthUser + ": ", matrixAuthUser + " "}, msg, sender)
 	}
 }
 
+// update should be called after you've recieved a reaction
+func (matrix *Matrix) update(msg onelib.Message, sender onelib.Sender) {
+	if string(sender.UUID()) != matrixAuthUser {
+		onelib.ProcessUpdate(msg, sender)
+	}
+}
+
+// edit should be called after you've recieved a message edit
+func (matrix *Matrix) edit(edit *onelib.MessageEdit, sender onelib.Sender) {
+	if string(sender.UUID()) != matrixAuthUser {
+		onelib.ProcessEdit(edit, sender)
+	}
+}
+
+// delete should be called after you've recieved a redaction
+func (matrix *Matrix) delete(del *onelib.MessageDelete, location onelib.Location) {
+	onelib.ProcessDelete(del, location)
+}
+
+// presence should be called after you've recieved a presence or membership update
+func (matrix *Matrix) presence(update *onelib.PresenceUpdate, sender onelib.Sender) {
+	if string(sender.UUID()) != matrixAuthUser {
+		onelib.ProcessPresence(update, sender)
+	}
+}
+
+// locationUpdate should be called after you've recieved a room update
+func (matrix *Matrix) locationUpdate(update *onelib.LocationUpdate, location onelib.Location) {
+	onelib.ProcessLocationUpdate(update, location)
+}
+
 // Remove currently doesn't do anything.
 func (matrix *Matrix) Remove() {
 	matrix.client.SetStatus("offline", "")
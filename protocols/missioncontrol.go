@@ -27,6 +27,9 @@ const (
 )
 
 var (
+	// log tags lines with the name of the protocol
+	log = onelib.NewProtocolLog(NAME)
+
 	MissionControlPort int
 	Users *users
 )
@@ -96,6 +99,8 @@ func Load() onelib.Protocol {
 	http.HandleFunc("/login", serveLogin)
 	http.HandleFunc("/settings", serveSettings)
 	http.HandleFunc("/plugins", servePlugins)
+	http.HandleFunc("/jobs", serveJobs)
+	http.HandleFunc("/unschedulejob", unscheduleJobHandler)
 	http.HandleFunc("/plugin", getPluginHTML)
 	http.HandleFunc("/do", doPluginAction)
 	http.HandleFunc("/adduser", addUserHandler)
@@ -118,13 +123,13 @@ func servePage(w http.ResponseWriter, r *http.Request, page string, loggedIn boo
 	// Load template from protocols/missioncontrol/page.tmpl
 	index, err := ioutil.ReadFile("protocols/missioncontrol/"+page+".tmpl")
 	if err != nil {
-		onelib.Error.Println(err)
+		log.Error.Println(err)
 		fmt.Fprintf(w, "Internal server error.")
 		return
 	}
 	indexTpl, err := template.New("index").Parse(string(index))
 	if err != nil {
-		onelib.Error.Println(err)
+		log.Error.Println(err)
 		fmt.Fprintf(w, "Internal server error.")
 		return
 	}
@@ -134,6 +139,7 @@ func servePage(w http.ResponseWriter, r *http.Request, page string, loggedIn boo
 	var (
 		pluginCount, protocolCount int
 		plugins []string
+		jobs []*onelib.Job
 	)
 	if loggedIn {
 		switch page {
@@ -142,6 +148,8 @@ func servePage(w http.ResponseWriter, r *http.Request, page string, loggedIn boo
 			protocolCount = len(onelib.Protocols.List())
 		case "plugins":
 			plugins = missioncontrol.Plugins.List()
+		case "jobs":
+			jobs = onelib.Scheduler.List()
 		}
 	}
 
@@ -152,6 +160,8 @@ func servePage(w http.ResponseWriter, r *http.Request, page string, loggedIn boo
 		LoggedIn bool
 		Users []string    // List of users registered with Mission Control
 		Plugins []string  // List of plugins loaded which support Mission Control
+		Jobs []*onelib.Job // List of scheduled jobs
+		Running func(id string) bool // Returns true if the job is running
 	}{
 		PluginCount: pluginCount,
 		ProtocolCount: protocolCount,
@@ -159,11 +169,13 @@ func servePage(w http.ResponseWriter, r *http.Request, page string, loggedIn boo
 		LoggedIn: loggedIn,
 		Users: Users.List(),
 		Plugins: plugins,
+		Jobs: jobs,
+		Running: onelib.Scheduler.Running,
 	}
 
 	err = indexTpl.Execute(w, indexVars)
 	if err != nil {
-		onelib.Error.Println(err)
+		log.Error.Println(err)
 		fmt.Fprintf(w, "Internal server error.")
 		return
 	}
@@ -281,6 +293,27 @@ func servePlugins(w http.ResponseWriter, r *http.Request) {
 	servePage(w, r, "plugins", true)
 }
 
+func serveJobs(w http.ResponseWriter, r *http.Request) {
+	if !loggedIn(r) {
+		serveLogin(w, r)
+		return
+	}
+	servePage(w, r, "jobs", true)
+}
+
+func unscheduleJobHandler(w http.ResponseWriter, r *http.Request) {
+	if !loggedIn(r) {
+		serveLogin(w, r)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if err := onelib.Scheduler.Unschedule(id); err != nil {
+		fmt.Fprintf(w, "%s", err)
+		return
+	}
+	fmt.Fprintf(w, "%s", id)
+}
+
 func logout(w http.ResponseWriter, r *http.Request) {
 	ses, err := r.Cookie("session")
 	if err != nil || len(Users.List()) == 0 {
@@ -387,7 +420,7 @@ func addUserHandler(w http.ResponseWriter, r *http.Request) {
 	_, err := addUser(username, password)
 	if err != nil {
 		errMsg := fmt.Sprintf("Error creating user: %s", err)
-		onelib.Error.Printf("[%s] %s", NAME, errMsg)
+		log.Error.Printf("%s", errMsg)
 		fmt.Fprintf(w, errMsg)
 		return
 	}
@@ -416,7 +449,7 @@ func serveLogin(w http.ResponseWriter, r *http.Request) {
 		// First login, create the user
 		session, err := addUser(username, password)
 		if err != nil {
-			onelib.Error.Printf("[%s] Error creating user: %s", NAME, err)
+			log.Error.Printf("Error creating user: %s", err)
 			serveFirstLogin(w, r)
 			return
 		}
@@ -478,23 +511,25 @@ func (mc *MissionControl) NewMessage(raw []byte) onelib.Message {
 }
 
 // Send sends a Message object to a location specified by to (usually a location or sender UUID).
-func (mc *MissionControl) Send(to onelib.UUID, msg onelib.Message) {
-	// code here
+func (mc *MissionControl) Send(to onelib.UUID, msg onelib.Message) (*onelib.SentMessage, error) {
+	return mc.SendFormattedText(to, msg.Text(), msg.FormattedText())
 }
 
 // SendText sends text to a location specified by to (usually a location or sender UUID).
-func (mc *MissionControl) SendText(to onelib.UUID, text string) {
+func (mc *MissionControl) SendText(to onelib.UUID, text string) (*onelib.SentMessage, error) {
 	// code here
+	return nil, onelib.ErrNotSupported
 }
 
 // SendFormattedText sends formatted text to a location specified by to (usually a location or sender UUID).
-func (mc *MissionControl) SendFormattedText(to onelib.UUID, text, formattedText string) {
+func (mc *MissionControl) SendFormattedText(to onelib.UUID, text, formattedText string) (*onelib.SentMessage, error) {
 	// code here
+	return nil, onelib.ErrNotSupported
 }
 
 // recv should be called after you've recieved data and built a Message object
 func (mc *MissionControl) recv(msg onelib.Message, sender onelib.Sender) {
-	onelib.ProcessMessage([]string{onelib.DefaultPrefix}, msg, sender)
+	onelib.ProcessMessage(nil, msg, sender)
 }
 
 // Remove should disconnect any open connections making it so the bot can forget about the protocol cleanly.
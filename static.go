@@ -0,0 +1,10 @@
+// Copyright (c) 2020-2022, The OneBot Contributors. All rights reserved.
+
+//go:build static
+
+package main
+
+import (
+	// Compiles every plugin and protocol into OneBot, generated by tools/gen_static.sh
+	_ "github.com/TheDiscordian/onebot/static"
+)